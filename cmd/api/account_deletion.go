@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/wesleybruno/golang-monolito/internal/store"
+)
+
+type DeleteAccountPayload struct {
+	Password string `json:"password" validate:"required,max=72"`
+}
+
+// DeleteAccount godoc
+//
+//	@Summary		Deletes my account
+//	@Description	Schedules the deletion of the authenticated user's account after a grace period. Logging in again cancels it
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		DeleteAccountPayload	true	"Current password"
+//	@Success		202		{object}	store.User
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/user/me [delete]
+func (app *application) deleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+
+	var payload DeleteAccountPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	// the cached user carries no password hash, always check against the database
+	user, err := app.store.Users.GetById(ctx, getUserFromCtx(r).ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if !user.Password.Matches(payload.Password) {
+		app.unauthorizedErrorResponse(w, r, errors.New("invalid password"))
+		return
+	}
+
+	at := time.Now().Add(app.config.deletion.gracePeriod)
+	if err := app.store.Users.ScheduleDeletion(ctx, user.ID, at); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.invalidateUsers(ctx, user.ID)
+	user.DeletionScheduledAt = &at
+
+	if err := app.jsonResponse(w, http.StatusAccepted, user); err != nil {
+		app.internalServerError(w, r, err)
+	}
+
+}
+
+// purgeDeletedAccounts removes the accounts whose grace period is over,
+// following the configured deletion policy.
+func (app *application) purgeDeletedAccounts(ctx context.Context) error {
+	for {
+		ids, err := app.store.Users.GetDueDeletions(ctx, time.Now(), 100)
+		if err != nil {
+			return err
+		}
+
+		if len(ids) == 0 {
+			return nil
+		}
+
+		for _, id := range ids {
+			purged, err := app.store.Users.Purge(ctx, id, app.config.deletion.anonymize)
+			if err != nil {
+				if errors.Is(err, store.ErrNotFound) {
+					// cancelled by a login in the meantime
+					continue
+				}
+				return err
+			}
+
+			app.invalidateUsers(ctx, id)
+			app.deleteMedia(ctx, purged.Avatar)
+			app.deleteMedia(ctx, purged.Banner)
+
+			for _, key := range purged.ExportFiles {
+				if err := app.exports.Delete(ctx, key); err != nil {
+					app.logger.Warnw("error deleting data export", "key", key, "error", err)
+				}
+			}
+
+			app.logger.Infow("account purged", "user", id, "anonymized", app.config.deletion.anonymize)
+		}
+	}
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/wesleybruno/golang-monolito/internal/mailer"
+	"github.com/wesleybruno/golang-monolito/internal/store"
+)
+
+const impersonatorCtx userKey = "impersonator"
+
+// SearchUsers godoc
+//
+//	@Summary		Searches users
+//	@Description	Searches users by email, username and account status. Restricted to admins
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			email		query		string	false	"Part of the email"
+//	@Param			username	query		string	false	"Part of the username"
+//	@Param			status		query		string	false	"active, inactive, pending_deletion or deleted"
+//	@Param			limit		query		int		false	"Limit"
+//	@Param			since		query		string	false	"Oldest created_at, RFC 3339 or relative to now like -24h"
+//	@Param			until		query		string	false	"Newest created_at (exclusive), RFC 3339 or relative to now like -1h"
+//	@Param			offset		query		int		false	"Offset"
+//	@Success		200			{object}	[]store.User
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users [get]
+func (app *application) searchUsersHandler(w http.ResponseWriter, r *http.Request) {
+
+	aq := store.AdminUserQuery{
+		Limit:  20,
+		Offset: 0,
+	}
+
+	aq, err := aq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(aq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	users, err := app.store.Users.Search(r.Context(), aq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, users); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// GetUserDetails godoc
+//
+//	@Summary		Fetches a user's details
+//	@Description	Fetches every detail of a user, including accounts pending deletion. Restricted to admins
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			userId	path		int	true	"User ID"
+//	@Success		200		{object}	store.User
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userId} [get]
+func (app *application) getUserDetailsHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userId"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user, err := app.store.Users.GetById(r.Context(), userID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r.Context(), getUserFromCtx(r).ID, "user.view", &user.ID, nil)
+
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+type UpdateUserRolePayload struct {
+	RoleID int64 `json:"role_id" validate:"required,gte=1"`
+}
+
+// UpdateUserRole godoc
+//
+//	@Summary		Changes a user's role
+//	@Description	Changes the role of a user. Restricted to admins
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			userId	path		int						true	"User ID"
+//	@Param			payload	body		UpdateUserRolePayload	true	"Role payload"
+//	@Success		204		{string}	string					"Role changed"
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userId} [patch]
+func (app *application) updateUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userId"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var payload UpdateUserRolePayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	admin := getUserFromCtx(r)
+
+	// admins can't lock themselves out
+	if userID == admin.ID {
+		app.badRequestResponse(w, r, fmt.Errorf("you can't change your own role"))
+		return
+	}
+
+	ctx := r.Context()
+
+	if err := app.store.Users.SetRole(ctx, userID, payload.RoleID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.invalidateUsers(ctx, userID)
+	app.audit(ctx, admin.ID, "user.role_changed", &userID, map[string]any{"role_id": payload.RoleID})
+
+	if err := app.jsonResponseNoData(w, http.StatusNoContent); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// AdminActivateUser godoc
+//
+//	@Summary		Activates a user
+//	@Description	Activates a user without the invitation token. Restricted to admins
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			userId	path		int		true	"User ID"
+//	@Success		204		{string}	string	"User activated"
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userId}/activate [put]
+func (app *application) adminActivateUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userId"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	if err := app.store.Users.ActivateByID(ctx, userID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.invalidateUsers(ctx, userID)
+	app.audit(ctx, getUserFromCtx(r).ID, "user.activated", &userID, nil)
+
+	if err := app.jsonResponseNoData(w, http.StatusNoContent); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// ForcePasswordReset godoc
+//
+//	@Summary		Forces a password reset
+//	@Description	Locks the account until the user picks a new password through the link sent by email. Restricted to admins
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			userId	path		int		true	"User ID"
+//	@Success		202		{string}	string	"Reset link sent"
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userId}/password-reset [post]
+func (app *application) forcePasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userId"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	user, err := app.store.Users.GetById(ctx, userID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	plainToken := uuid.New().String()
+
+	// hash the token for storage but keep the plain token for email
+	hash := sha256.Sum256([]byte(plainToken))
+	hashToken := hex.EncodeToString(hash[:])
+
+	if err := app.store.Users.ForcePasswordReset(ctx, user.ID, hashToken, app.config.mail.exp); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.invalidateUsers(ctx, user.ID)
+	app.audit(ctx, getUserFromCtx(r).ID, "user.password_reset_forced", &user.ID, nil)
+
+	isProdEnv := app.config.env == "production"
+	vars := struct {
+		Username string
+		ResetURL string
+	}{
+		Username: user.Username,
+		ResetURL: fmt.Sprintf("%s/reset-password/%s", app.config.frontendURL, plainToken),
+	}
+
+	if _, err := app.mailer.Send(mailer.PasswordResetTemplate, user.Username, user.Email, vars, !isProdEnv); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponseNoData(w, http.StatusAccepted); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// ImpersonateUser godoc
+//
+//	@Summary		Impersonates a user
+//	@Description	Issues a short lived token acting as the user. The token names the admin in its "act" claim, is rejected on admin routes and every write made with it is audited
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			userId	path		int		true	"User ID"
+//	@Success		201		{string}	string	"Token"
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userId}/impersonate [post]
+func (app *application) impersonateUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userId"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	admin := getUserFromCtx(r)
+
+	target, err := app.store.Users.GetById(ctx, userID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// never hand out the powers of an equal or higher role
+	if target.ID == admin.ID || target.Role.Level >= admin.Role.Level {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	expiresAt := time.Now().Add(app.config.auth.token.impersonationExp)
+
+	claims := jwt.MapClaims{
+		"sub": target.ID,
+		"act": map[string]any{"sub": admin.ID},
+		"imp": true,
+		"exp": expiresAt.Unix(),
+		"iat": time.Now().Unix(),
+		"nbf": time.Now().Unix(),
+		"iss": app.config.auth.token.iss,
+		"aud": app.config.auth.token.iss,
+	}
+
+	token, err := app.auth.GenerateToken(claims)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.audit(ctx, admin.ID, "user.impersonated", &target.ID, map[string]any{"expires_at": expiresAt})
+
+	if err := app.jsonResponse(w, http.StatusCreated, token); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// GetAuditLog godoc
+//
+//	@Summary		Lists the admin audit log
+//	@Description	Lists admin actions, most recent first, optionally about a single user. Restricted to admins
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			user_id	query		int		false	"Target user ID"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			since	query		string	false	"Oldest created_at, RFC 3339 or relative to now like -24h"
+//	@Param			until	query		string	false	"Newest created_at (exclusive), RFC 3339 or relative to now like -1h"
+//	@Param			cursor	query		string	false	"Cursor returned by the previous page"
+//	@Success		200		{object}	[]store.AuditLogEntry
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/audit-log [get]
+func (app *application) getAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+
+	var targetUserID int64
+	if v := r.URL.Query().Get("user_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		targetUserID = id
+	}
+
+	cq := store.PaginationCursorQuery{
+		Limit: 20,
+	}
+
+	cq, err := cq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(cq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	entries, next, err := app.store.Audit.List(r.Context(), targetUserID, cq)
+	if err != nil {
+		switch err {
+		case store.ErrInvalidCursor:
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	var cursors pageCursors
+	if next != nil {
+		cursors.Next = next.Encode()
+	}
+
+	if err := app.paginatedJsonResponse(w, http.StatusOK, entries, cursors); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// audit records an admin action. Failures are logged, the action itself
+// already happened.
+func (app *application) audit(ctx context.Context, actorID int64, action string, targetUserID *int64, metadata map[string]any) {
+	entry := &store.AuditLogEntry{
+		ActorID:      &actorID,
+		Action:       action,
+		TargetUserID: targetUserID,
+		Metadata:     metadata,
+	}
+
+	if err := app.store.Audit.Create(ctx, entry); err != nil {
+		app.logger.Errorw("error writing audit log", "action", action, "actor", actorID, "error", err)
+	}
+}
+
+func getImpersonatorFromCtx(r *http.Request) (int64, bool) {
+	id, ok := r.Context().Value(impersonatorCtx).(int64)
+	return id, ok
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
@@ -20,10 +21,16 @@ import (
 	"github.com/wesleybruno/golang-monolito/docs"
 	"github.com/wesleybruno/golang-monolito/internal/auth"
 	"github.com/wesleybruno/golang-monolito/internal/env"
+	"github.com/wesleybruno/golang-monolito/internal/events"
+	"github.com/wesleybruno/golang-monolito/internal/feed"
+	"github.com/wesleybruno/golang-monolito/internal/filestore"
+	"github.com/wesleybruno/golang-monolito/internal/gateway"
 	"github.com/wesleybruno/golang-monolito/internal/mailer"
 	"github.com/wesleybruno/golang-monolito/internal/ratelimiter"
+	"github.com/wesleybruno/golang-monolito/internal/scheduler"
 	"github.com/wesleybruno/golang-monolito/internal/store"
 	"github.com/wesleybruno/golang-monolito/internal/store/cache"
+	"github.com/wesleybruno/golang-monolito/internal/webhooks"
 )
 
 type application struct {
@@ -34,18 +41,107 @@ type application struct {
 	auth        auth.Authenticator
 	cache       cache.Storage
 	rateLimiter ratelimiter.Limiter
+	media       filestore.Storage
+	exports     filestore.Storage
+	events      events.Broker
+	gateway     *gateway.Hub
+	webhooks    *webhooks.Sender
+	scheduler   *scheduler.Scheduler
+	wg          sync.WaitGroup
+	done        chan struct{}
+	// closing is closed as soon as shutdown starts, ending long-lived streams
+	closing chan struct{}
 }
 
 type config struct {
-	dbConfig    dbConfig
-	addr        string
-	env         string
-	apiUrl      string
-	frontendURL string
-	mail        mail
-	auth        authConfig
-	cache       redisCfg
-	rateLimiter ratelimiter.Config
+	dbConfig      dbConfig
+	addr          string
+	env           string
+	apiUrl        string
+	frontendURL   string
+	mail          mail
+	auth          authConfig
+	cache         redisCfg
+	rateLimiter   ratelimiter.Config
+	media         mediaConfig
+	export        exportConfig
+	deletion      deletionConfig
+	feed          feedConfig
+	explore       exploreConfig
+	stream        streamConfig
+	notifications notificationsConfig
+	webhooks      webhookConfig
+}
+
+type webhookConfig struct {
+	// pollInterval is how often deliveries due for a retry are looked for
+	pollInterval time.Duration
+	timeout      time.Duration
+	// lease is how long an attempted delivery is kept from other dispatchers
+	lease       time.Duration
+	maxAttempts int
+	// retries wait backoff, doubling after each failure up to maxBackoff
+	backoff    time.Duration
+	maxBackoff time.Duration
+	// webhooks are disabled after this many failed attempts in a row
+	disableAfter int
+	workers      int
+}
+
+type notificationsConfig struct {
+	// digestInterval is the least time between two digests of a user
+	digestInterval time.Duration
+	// digestSize is how many notifications a digest lists at most
+	digestSize int
+}
+
+type streamConfig struct {
+	// heartbeat is how often idle streams send a comment, keeping proxies
+	// from closing them
+	heartbeat time.Duration
+	// retry is the reconnection delay advertised to clients
+	retry time.Duration
+}
+
+type feedConfig struct {
+	// authors with this many followers aren't fanned out to timelines,
+	// their posts are merged in when the feed is read
+	celebrityThreshold int64
+	ranking            feed.Weights
+	// rankingCandidates is how many of the newest posts the ranked feed scores
+	rankingCandidates int
+	// rankingWindow bounds the age of ranked posts when no since is given
+	rankingWindow time.Duration
+}
+
+type exploreConfig struct {
+	// refreshSchedule is the cron schedule of the refresh-explore job
+	refreshSchedule string
+	// cached results outlive a few refreshes, expiring when the job stops running
+	cacheExp time.Duration
+	// a tag trends against its average use over this many previous windows
+	baselinePeriods int
+	minTagPosts     int
+	// trendingTags is how many tags are kept per window
+	trendingTags int
+	// popularWindow bounds the age of the posts in the explore feed
+	popularWindow time.Duration
+	popularPosts  int
+}
+
+type deletionConfig struct {
+	gracePeriod time.Duration
+	anonymize   bool
+}
+
+type exportConfig struct {
+	dir string
+	exp time.Duration
+}
+
+type mediaConfig struct {
+	dir     string
+	baseURL string
 }
 
 type authConfig struct {
@@ -61,9 +157,10 @@ type redisCfg struct {
 }
 
 type tokenConfig struct {
-	secret string
-	exp    time.Duration
-	iss    string
+	secret           string
+	exp              time.Duration
+	impersonationExp time.Duration
+	iss              string
 }
 
 type basicConfig struct {
@@ -97,7 +194,7 @@ func (app *application) mount() http.Handler {
 	r.Use(middleware.Recoverer)
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{env.Config.CorsAllowedOrigin},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: false,
@@ -107,53 +204,218 @@ func (app *application) mount() http.Handler {
 	if app.config.rateLimiter.Enabled {
 		r.Use(app.RateLimiterMiddleware)
 	}
-	r.Use(middleware.Timeout(60 * time.Second))
-
 	r.Route("/v1", func(r chi.Router) {
+		// event streams and websockets last as long as the client stays
+		// connected, they are the only routes without a timeout
+		r.Group(func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.Get("/gateway", app.gatewayHandler)
+			r.Get("/user/feed/stream", app.feedStreamHandler)
+		})
 
-		docsUrl := fmt.Sprintf("%s/swagger/doc.json", app.config.addr)
-		r.Get("/swagger/*", httpSwagger.Handler(
-			httpSwagger.URL(docsUrl),
-		))
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.Timeout(60 * time.Second))
 
-		r.With(app.BasicAuthMiddleware()).Get("/health", app.healthCheckerHandler)
-		r.With(app.BasicAuthMiddleware()).Get("/debug/vars", expvar.Handler().ServeHTTP)
+			docsUrl := fmt.Sprintf("%s/swagger/doc.json", app.config.addr)
+			r.Get("/swagger/*", httpSwagger.Handler(
+				httpSwagger.URL(docsUrl),
+			))
 
-		r.Route("/post", func(r chi.Router) {
-			r.Use(app.AuthTokenMiddleware)
-			r.Post("/", app.createPostHandler)
+			r.With(app.BasicAuthMiddleware()).Get("/health", app.healthCheckerHandler)
+			r.With(app.BasicAuthMiddleware()).Get("/debug/vars", expvar.Handler().ServeHTTP)
+
+			r.Get("/media/*", app.mediaHandler)
+
+			r.Route("/post", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+				r.Post("/", app.createPostHandler)
 
-			r.Route("/{postId}", func(r chi.Router) {
-				r.Use(app.postsContextMiddleware)
+				r.Route("/{postId}", func(r chi.Router) {
+					r.Use(app.postsContextMiddleware)
 
-				r.Get("/", app.getPostHandler)
-				r.Patch("/", app.CheckPostOwnership("moderator", app.updatePostHandler))
-				r.Delete("/", app.CheckPostOwnership("admin", app.deletePostHandler))
+					r.Get("/", app.getPostHandler)
+					r.Patch("/", app.CheckPostOwnership("moderator", app.updatePostHandler))
+					r.Delete("/", app.CheckPostOwnership("admin", app.deletePostHandler))
+
+					r.Post("/comments", app.createCommentHandler)
+					r.Put("/reactions", app.reactToPostHandler)
+					r.Delete("/reactions", app.removeReactionHandler)
+				})
 			})
-		})
 
-		r.Route("/user", func(r chi.Router) {
+			r.Route("/user", func(r chi.Router) {
+
+				r.Put("/activate/{token}", app.activateUserHandler)
+				r.Put("/email/confirm/{token}", app.confirmEmailChangeHandler)
+				r.Get("/export/{exportId}/download", app.downloadDataExportHandler)
+
+				r.Route("/me", func(r chi.Router) {
+					r.Use(app.AuthTokenMiddleware)
+
+					r.Patch("/", app.updateProfileHandler)
+					r.Delete("/", app.deleteAccountHandler)
+					r.Put("/password", app.changePasswordHandler)
+					r.Put("/privacy", app.updatePrivacyHandler)
+					r.Put("/avatar", app.uploadAvatarHandler)
+					r.Put("/banner", app.uploadBannerHandler)
+					r.Get("/tags", app.getFollowedTagsHandler)
+
+					r.Post("/export", app.createDataExportHandler)
+					r.Get("/export/{exportId}", app.getDataExportHandler)
+
+					r.Route("/follow-requests", func(r chi.Router) {
+						r.Get("/", app.getPendingFollowRequestsHandler)
+						r.Put("/{userId}/accept", app.acceptFollowRequestHandler)
+						r.Put("/{userId}/reject", app.rejectFollowRequestHandler)
+					})
+				})
+
+				r.Route("/{userId}", func(r chi.Router) {
+					r.Use(app.AuthTokenMiddleware)
+
+					r.Get("/", app.getUserHandler)
+
+					r.Put("/follow", app.followUserHandler)
+					r.Put("/unfollow", app.unfollowUserHandler)
+					r.Get("/followers", app.getFollowersHandler)
+					r.Get("/following", app.getFollowingHandler)
+					r.Get("/follow-request", app.getFollowRequestHandler)
+
+					r.Put("/block", app.blockUserHandler)
+					r.Put("/unblock", app.unblockUserHandler)
+					r.Put("/mute", app.muteUserHandler)
+					r.Put("/unmute", app.unmuteUserHandler)
+				})
+
+				r.Group(func(r chi.Router) {
+					r.Use(app.AuthTokenMiddleware)
+					r.Get("/feed", app.getUserFeedHandler)
+				})
 
-			r.Put("/activate/{token}", app.activateUserHandler)
+			})
+			r.Route("/search", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
 
-			r.Route("/{userId}", func(r chi.Router) {
+				r.Get("/posts", app.searchPostsHandler)
+			})
+
+			r.Route("/tags/{tag}", func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware)
 
-				r.Get("/", app.getUserHandler)
+				r.Put("/follow", app.followTagHandler)
+				r.Put("/unfollow", app.unfollowTagHandler)
+			})
+
+			r.Route("/explore", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+
+				r.Get("/tags", app.getTrendingTagsHandler)
+				r.Get("/posts", app.getExplorePostsHandler)
+			})
+
+			r.Route("/notifications", func(r chi.Router) {
+				r.Get("/unsubscribe", app.confirmUnsubscribeHandler)
+				r.Post("/unsubscribe", app.unsubscribeHandler)
+
+				r.Group(func(r chi.Router) {
+					r.Use(app.AuthTokenMiddleware)
 
-				r.Put("/follow", app.followUserHandler)
-				r.Put("/unfollow", app.unfollowUserHandler)
+					r.Get("/", app.getNotificationsHandler)
+					r.Get("/unread-count", app.getUnreadNotificationCountHandler)
+					r.Put("/read", app.markAllNotificationsReadHandler)
+					r.Put("/{notificationId}/read", app.markNotificationReadHandler)
+					r.Get("/preferences", app.getNotificationPreferencesHandler)
+					r.Put("/preferences", app.updateNotificationPreferencesHandler)
+				})
 			})
 
-			r.Group(func(r chi.Router) {
+			r.Route("/conversations", func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware)
-				r.Get("/feed", app.getUserFeedHandler)
+
+				r.Get("/", app.getConversationsHandler)
+				r.Post("/", app.createConversationHandler)
+
+				r.Route("/{conversationId}", func(r chi.Router) {
+					r.Use(app.conversationsContextMiddleware)
+
+					r.Get("/", app.getConversationHandler)
+					r.Get("/messages", app.getMessagesHandler)
+					r.Post("/messages", app.sendMessageHandler)
+					r.Put("/read", app.markConversationReadHandler)
+				})
 			})
 
-		})
-		r.Route("/auth", func(r chi.Router) {
-			r.Post("/user", app.registerUserHandler)
-			r.Post("/token", app.createTokenHandler)
+			r.Route("/webhooks", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+
+				r.Get("/", app.getWebhooksHandler)
+				r.Post("/", app.createWebhookHandler)
+
+				r.Route("/{webhookId}", func(r chi.Router) {
+					r.Use(app.webhooksContextMiddleware)
+
+					r.Get("/", app.getWebhookHandler)
+					r.Patch("/", app.updateWebhookHandler)
+					r.Delete("/", app.deleteWebhookHandler)
+					r.Get("/deliveries", app.getWebhookDeliveriesHandler)
+				})
+			})
+
+			r.Route("/users", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+
+				r.Get("/search", app.searchUserByNameHandler)
+				r.Get("/suggestions", app.getUserSuggestionsHandler)
+			})
+
+			r.Route("/auth", func(r chi.Router) {
+				r.Post("/user", app.registerUserHandler)
+				r.Post("/token", app.createTokenHandler)
+				r.Put("/password/reset/{token}", app.resetPasswordHandler)
+			})
+
+			r.Route("/admin", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.RequireRole("admin"))
+
+				r.Get("/audit-log", app.getAuditLogHandler)
+
+				r.Route("/scheduler", func(r chi.Router) {
+					r.Get("/jobs", app.getScheduledJobsHandler)
+					r.Post("/jobs/{name}/run", app.triggerScheduledJobHandler)
+					r.Get("/runs", app.getScheduledRunsHandler)
+				})
+
+				r.Route("/jobs", func(r chi.Router) {
+					r.Get("/", app.getJobsHandler)
+					r.Post("/{jobId}/retry", app.retryJobHandler)
+				})
+
+				r.Route("/roles", func(r chi.Router) {
+					r.Get("/", app.getRolesHandler)
+					r.Post("/", app.createRoleHandler)
+
+					r.Route("/{roleId}", func(r chi.Router) {
+						r.Use(app.rolesContextMiddleware)
+
+						r.Get("/", app.getRoleHandler)
+						r.Patch("/", app.updateRoleHandler)
+						r.Delete("/", app.deleteRoleHandler)
+					})
+				})
+
+				r.Route("/users", func(r chi.Router) {
+					r.Get("/", app.searchUsersHandler)
+
+					r.Route("/{userId}", func(r chi.Router) {
+						r.Get("/", app.getUserDetailsHandler)
+						r.Patch("/", app.updateUserRoleHandler)
+						r.Put("/activate", app.adminActivateUserHandler)
+						r.Post("/password-reset", app.forcePasswordResetHandler)
+						r.Post("/impersonate", app.impersonateUserHandler)
+					})
+				})
+			})
 		})
 	})
 
@@ -175,6 +437,10 @@ func (app *application) run(mux http.Handler) error {
 		IdleTimeout:  time.Minute,
 	}
 
+	srv.RegisterOnShutdown(func() {
+		close(app.closing)
+	})
+
 	shutdown := make(chan error)
 
 	go func() {
@@ -188,7 +454,20 @@ func (app *application) run(mux http.Handler) error {
 
 		app.logger.Infow("signal caught", "signal", s.String())
 
-		shutdown <- srv.Shutdown(ctx)
+		// background tasks complete even when the server didn't shut down
+		// cleanly, the outcome is sent once everything stopped
+		err := srv.Shutdown(ctx)
+
+		// websockets are hijacked, the server doesn't wait for them
+		app.logger.Infow("draining websocket connections", "addr", app.config.addr)
+		err = errors.Join(err, app.gateway.Shutdown(ctx))
+
+		app.logger.Infow("completing background tasks", "addr", app.config.addr)
+
+		close(app.done)
+
+		app.wg.Wait()
+		shutdown <- err
 	}()
 
 	err := srv.ListenAndServe()
@@ -3,6 +3,7 @@ package main
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -10,6 +11,7 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/wesleybruno/golang-monolito/internal/jobs"
 	"github.com/wesleybruno/golang-monolito/internal/mailer"
 	"github.com/wesleybruno/golang-monolito/internal/store"
 )
@@ -71,7 +73,18 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	hash := sha256.Sum256([]byte(plainToken))
 	hashToken := hex.EncodeToString(hash[:])
 
-	err := app.store.Users.CreateAndInvite(ctx, user, hashToken, app.config.mail.exp)
+	// the welcome email is queued with the user, the worker sends it
+	activationURL := fmt.Sprintf("%s/confirm/%s", app.config.frontendURL, plainToken)
+	welcome, err := jobs.NewEmail(mailer.UserWelcomeTemplate, user.Username, user.Email, map[string]any{
+		"Username":      user.Username,
+		"ActivationURL": activationURL,
+	})
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	err = app.store.Users.CreateAndInvite(ctx, user, hashToken, app.config.mail.exp, welcome)
 	if err != nil {
 		switch err {
 		case store.ErrDuplicateEmail:
@@ -88,32 +101,6 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		User:  user,
 		Token: plainToken,
 	}
-	activationURL := fmt.Sprintf("%s/confirm/%s", app.config.frontendURL, plainToken)
-
-	isProdEnv := app.config.env == "production"
-	vars := struct {
-		Username      string
-		ActivationURL string
-	}{
-		Username:      user.Username,
-		ActivationURL: activationURL,
-	}
-
-	// send mail
-	status, err := app.mailer.Send(mailer.UserWelcomeTemplate, user.Username, user.Email, vars, !isProdEnv)
-	if err != nil {
-		app.logger.Errorw("error sending welcome email", "error", err)
-
-		// rollback user creation if email fails (SAGA pattern)
-		if err := app.store.Users.Delete(ctx, user.ID); err != nil {
-			app.logger.Errorw("error deleting user", "error", err)
-		}
-
-		app.internalServerError(w, r, err)
-		return
-	}
-
-	app.logger.Infow("Email sent", "status code", status)
 
 	if err := app.jsonResponse(w, http.StatusCreated, userWithToken); err != nil {
 		app.internalServerError(w, r, err)
@@ -195,6 +182,26 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if !user.Password.Matches(payload.Password) {
+		app.unauthorizedErrorResponse(w, r, errors.New("invalid credentials"))
+		return
+	}
+
+	if user.PasswordResetRequired {
+		app.unauthorizedErrorResponse(w, r, errors.New("password reset required, check your email"))
+		return
+	}
+
+	// logging in during the grace period keeps the account
+	if user.DeletionScheduledAt != nil {
+		if err := app.store.Users.CancelDeletion(r.Context(), user.ID); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		app.invalidateUsers(r.Context(), user.ID)
+	}
+
 	claims := jwt.MapClaims{
 		"sub": user.ID,
 		"exp": time.Now().Add(app.config.auth.token.exp).Unix(),
@@ -215,3 +222,59 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 }
+
+type ResetPasswordPayload struct {
+	Password string `json:"password" validate:"required,min=3,max=72"`
+}
+
+// resetPasswordHandler godoc
+//
+//	@Summary		Resets a password
+//	@Description	Sets a new password with the token sent when an admin forced a reset
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			token	path		string					true	"Password reset token"
+//	@Param			payload	body		ResetPasswordPayload	true	"New password"
+//	@Success		204		{string}	string					"Password reset"
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/auth/password/reset/{token} [put]
+func (app *application) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+
+	var payload ResetPasswordPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := &store.User{}
+	if err := user.Password.Set(payload.Password); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	token := chi.URLParam(r, "token")
+
+	if err := app.store.Users.ResetPassword(r.Context(), token, user); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.invalidateUsers(r.Context(), user.ID)
+
+	if err := app.jsonResponseNoData(w, http.StatusNoContent); err != nil {
+		app.internalServerError(w, r, err)
+	}
+
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// background runs fn outside of the request lifecycle. Panics are logged
+// instead of crashing the server and shutdown waits for running tasks.
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Errorw("background task panicked", "error", fmt.Sprintf("%v", err))
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// every runs fn each interval until the server shuts down.
+func (app *application) every(name string, interval time.Duration, fn func(ctx context.Context) error) {
+	app.background(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-app.done:
+				return
+			case <-ticker.C:
+				start := time.Now()
+				if err := fn(context.Background()); err != nil {
+					app.logger.Errorw("periodic task failed", "task", name, "error", err)
+					continue
+				}
+				app.logger.Infow("periodic task completed", "task", name, "duration", time.Since(start).String())
+			}
+		}
+	})
+}
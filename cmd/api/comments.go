@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/wesleybruno/golang-monolito/internal/store"
+	"github.com/wesleybruno/golang-monolito/internal/webhooks"
+)
+
+type CreateCommentPayload struct {
+	Content string `json:"content" validate:"required,max=1000"`
+}
+
+// CreateComment godoc
+//
+//	@Summary		Comments on a post
+//	@Description	Comments on a post, streaming the comment to the people viewing it
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			postId	path		int						true	"Post ID"
+//	@Param			payload	body		CreateCommentPayload	true	"Comment payload"
+//	@Success		201		{object}	store.Comment
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/post/{postId}/comments [post]
+func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Request) {
+
+	var payload CreateCommentPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	post := getPostFromCtx(r)
+	user := getUserFromCtx(r)
+
+	comment := &store.Comment{
+		UserId:  user.ID,
+		PostId:  post.ID,
+		Content: payload.Content,
+		User:    store.User{ID: user.ID, Username: user.Username, Avatar: user.Avatar},
+	}
+
+	if err := app.store.Comments.Create(r.Context(), comment); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.background(func() {
+		app.publishComment(context.Background(), comment)
+	})
+
+	app.notify(store.NewNotification{UserID: post.UserId, ActorID: user.ID, Kind: store.NotificationComment, PostID: &post.ID})
+	app.notifyMentions(user.ID, post.ID, &comment.ID, comment.Content)
+	app.emitWebhook(post.UserId, webhooks.EventCommentCreated, comment)
+
+	if err := app.jsonResponse(w, http.StatusCreated, comment); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/wesleybruno/golang-monolito/internal/store"
+)
+
+type conversationKey string
+
+const conversationCtx conversationKey = "conversation"
+
+type CreateConversationPayload struct {
+	// ParticipantIDs are the other participants, more than one makes a group
+	ParticipantIDs []int64 `json:"participant_ids" validate:"required,min=1,max=9,unique,dive,gt=0"`
+	Title          string  `json:"title" validate:"max=100"`
+	Message        string  `json:"message" validate:"max=2000"`
+}
+
+type SendMessagePayload struct {
+	Content string `json:"content" validate:"required,max=2000"`
+}
+
+type MarkConversationReadPayload struct {
+	// MessageID defaults to the latest message
+	MessageID *int64 `json:"message_id" validate:"omitempty,gt=0"`
+}
+
+// CreateConversation godoc
+//
+//	@Summary		Starts a conversation
+//	@Description	Starts a 1:1 conversation, or a group one with more than one participant, optionally with a first message. Starting a 1:1 conversation that exists returns it. Blocked users and private accounts the caller doesn't follow can't be added
+//	@Tags			messages
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateConversationPayload	true	"Conversation payload"
+//	@Success		201		{object}	store.Conversation			"Conversation started"
+//	@Success		200		{object}	store.Conversation			"Existing 1:1 conversation"
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error	"User is blocked or private"
+//	@Failure		404		{object}	error	"User not found"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/conversations [post]
+func (app *application) createConversationHandler(w http.ResponseWriter, r *http.Request) {
+
+	var payload CreateConversationPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	ctx := r.Context()
+
+	if slices.Contains(payload.ParticipantIDs, user.ID) {
+		app.badRequestResponse(w, r, errors.New("can't start a conversation with yourself"))
+		return
+	}
+
+	id, created, err := app.store.Conversations.Create(ctx, user.ID, payload.ParticipantIDs, payload.Title)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		case store.ErrBlocked, store.ErrPrivateAccount:
+			app.forbiddenResponse(w, r)
+		case store.ErrTooManyParticipants:
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	conversation, err := app.store.Conversations.GetByID(ctx, id, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if payload.Message != "" {
+		msg, err := app.sendMessage(ctx, conversation, user, payload.Message)
+		if err != nil {
+			switch err {
+			case store.ErrBlocked:
+				app.forbiddenResponse(w, r)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		conversation.LastMessage = msg
+		conversation.UpdatedAt = msg.CreatedAt
+	}
+
+	status := http.StatusCreated
+	if !created {
+		status = http.StatusOK
+	}
+
+	if err := app.jsonResponse(w, status, conversation); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// GetConversations godoc
+//
+//	@Summary		Lists my conversations
+//	@Description	Lists the caller's conversations, the most recently active first, with their last message and unread count
+//	@Tags			messages
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			since	query		string	false	"Oldest activity, RFC 3339 or relative to now like -24h"
+//	@Param			until	query		string	false	"Newest activity (exclusive), RFC 3339 or relative to now like -1h"
+//	@Param			cursor	query		string	false	"Cursor returned by the previous page"
+//	@Success		200		{object}	[]store.Conversation
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/conversations [get]
+func (app *application) getConversationsHandler(w http.ResponseWriter, r *http.Request) {
+
+	cq := store.PaginationCursorQuery{
+		Limit: 20,
+	}
+
+	cq, err := cq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(cq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+
+	conversations, next, err := app.store.Conversations.List(r.Context(), user.ID, cq)
+	if err != nil {
+		switch err {
+		case store.ErrInvalidCursor:
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	var cursors pageCursors
+	if next != nil {
+		cursors.Next = next.Encode()
+	}
+
+	if err := app.paginatedJsonResponse(w, http.StatusOK, conversations, cursors); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// GetConversation godoc
+//
+//	@Summary		Fetches a conversation
+//	@Description	Fetches one of the caller's conversations with its participants and their read receipts
+//	@Tags			messages
+//	@Accept			json
+//	@Produce		json
+//	@Param			conversationId	path		int	true	"Conversation ID"
+//	@Success		200				{object}	store.Conversation
+//	@Failure		404				{object}	error
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/{conversationId} [get]
+func (app *application) getConversationHandler(w http.ResponseWriter, r *http.Request) {
+
+	conversation := getConversationFromCtx(r)
+
+	if err := app.jsonResponse(w, http.StatusOK, conversation); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// GetMessages godoc
+//
+//	@Summary		Lists the messages of a conversation
+//	@Description	Pages through the history of a conversation, the newest messages first. Messages of users blocked by or blocking the caller are left out
+//	@Tags			messages
+//	@Accept			json
+//	@Produce		json
+//	@Param			conversationId	path		int		true	"Conversation ID"
+//	@Param			limit			query		int		false	"Limit"
+//	@Param			since			query		string	false	"Oldest created_at, RFC 3339 or relative to now like -24h"
+//	@Param			until			query		string	false	"Newest created_at (exclusive), RFC 3339 or relative to now like -1h"
+//	@Param			cursor			query		string	false	"Cursor returned by the previous page"
+//	@Success		200				{object}	[]store.Message
+//	@Failure		400				{object}	error
+//	@Failure		404				{object}	error
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/{conversationId}/messages [get]
+func (app *application) getMessagesHandler(w http.ResponseWriter, r *http.Request) {
+
+	cq := store.PaginationCursorQuery{
+		Limit: 50,
+	}
+
+	cq, err := cq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(cq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	conversation := getConversationFromCtx(r)
+	user := getUserFromCtx(r)
+
+	messages, next, err := app.store.Conversations.GetMessages(r.Context(), conversation.ID, user.ID, cq)
+	if err != nil {
+		switch err {
+		case store.ErrInvalidCursor:
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	var cursors pageCursors
+	if next != nil {
+		cursors.Next = next.Encode()
+	}
+
+	if err := app.paginatedJsonResponse(w, http.StatusOK, messages, cursors); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// SendMessage godoc
+//
+//	@Summary		Sends a message
+//	@Description	Sends a message to a conversation, streaming it to the other participants. 1:1 conversations end when either user blocks the other
+//	@Tags			messages
+//	@Accept			json
+//	@Produce		json
+//	@Param			conversationId	path		int					true	"Conversation ID"
+//	@Param			payload			body		SendMessagePayload	true	"Message payload"
+//	@Success		201				{object}	store.Message
+//	@Failure		400				{object}	error
+//	@Failure		403				{object}	error	"User is blocked"
+//	@Failure		404				{object}	error
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/{conversationId}/messages [post]
+func (app *application) sendMessageHandler(w http.ResponseWriter, r *http.Request) {
+
+	var payload SendMessagePayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	conversation := getConversationFromCtx(r)
+	user := getUserFromCtx(r)
+
+	msg, err := app.sendMessage(r.Context(), conversation, user, payload.Content)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		case store.ErrBlocked:
+			app.forbiddenResponse(w, r)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, msg); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// MarkConversationRead godoc
+//
+//	@Summary		Marks a conversation as read
+//	@Description	Moves the caller's read receipt up to a message, the latest one by default, and streams it to the other participants
+//	@Tags			messages
+//	@Accept			json
+//	@Produce		json
+//	@Param			conversationId	path		int							true	"Conversation ID"
+//	@Param			payload			body		MarkConversationReadPayload	false	"Read payload"
+//	@Success		200				{object}	store.ConversationParticipant
+//	@Failure		400				{object}	error
+//	@Failure		404				{object}	error	"Conversation or message not found"
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/{conversationId}/read [put]
+func (app *application) markConversationReadHandler(w http.ResponseWriter, r *http.Request) {
+
+	var payload MarkConversationReadPayload
+	if r.ContentLength != 0 {
+		if err := readJson(w, r, &payload); err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	conversation := getConversationFromCtx(r)
+	user := getUserFromCtx(r)
+
+	receipt, err := app.store.Conversations.MarkRead(r.Context(), conversation.ID, user.ID, payload.MessageID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	receipt.User = store.User{ID: user.ID, Username: user.Username, Avatar: user.Avatar}
+
+	app.publish(conversation.ParticipantIDs(user.ID), eventMessageRead, struct {
+		ConversationID int64 `json:"conversation_id"`
+		*store.ConversationParticipant
+	}{conversation.ID, receipt})
+
+	if err := app.jsonResponse(w, http.StatusOK, receipt); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// sendMessage adds a message of sender to conversation and streams it to
+// the other participants who can see it.
+func (app *application) sendMessage(ctx context.Context, conversation *store.Conversation, sender *store.User, content string) (*store.Message, error) {
+	msg := &store.Message{
+		ConversationID: conversation.ID,
+		SenderID:       sender.ID,
+		Content:        content,
+		Sender:         store.User{ID: sender.ID, Username: sender.Username, Avatar: sender.Avatar},
+	}
+
+	if err := app.store.Conversations.SendMessage(ctx, msg); err != nil {
+		return nil, err
+	}
+
+	recipients := conversation.ParticipantIDs(sender.ID)
+	app.background(func() {
+		blocked, err := app.store.Blocks.GetBlockedIDs(context.Background(), sender.ID)
+		if err != nil {
+			app.logger.Errorw("error listing blocked users", "user", sender.ID, "error", err)
+			return
+		}
+
+		recipients = slices.DeleteFunc(recipients, func(id int64) bool {
+			return slices.Contains(blocked, id)
+		})
+
+		app.publish(recipients, eventMessage, msg)
+	})
+
+	return msg, nil
+}
+
+func (app *application) conversationsContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "conversationId"), 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+		user := getUserFromCtx(r)
+
+		conversation, err := app.store.Conversations.GetByID(ctx, id, user.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, conversationCtx, conversation)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getConversationFromCtx(r *http.Request) *store.Conversation {
+	conversation, _ := r.Context().Value(conversationCtx).(*store.Conversation)
+	return conversation
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+
+	"github.com/wesleybruno/golang-monolito/internal/store"
+)
+
+const (
+	eventPost         = "post"
+	eventNotification = "notification"
+	eventMessage      = "message"
+	eventMessageRead  = "message_read"
+)
+
+// eventActor is the user behind an event.
+type eventActor struct {
+	ID       int64          `json:"id"`
+	Username string         `json:"username"`
+	Avatar   store.ImageSet `json:"avatar,omitempty"`
+}
+
+// publish sends an event to the streams of userIDs in the background. Streams
+// are best effort, failures are only logged.
+func (app *application) publish(userIDs []int64, eventType string, data any) {
+	app.background(func() {
+		if err := app.events.Publish(context.Background(), userIDs, eventType, data); err != nil {
+			app.logger.Errorw("error publishing event", "type", eventType, "error", err)
+		}
+	})
+}
+
+// publishPost streams a new post to its audience, shaped like a feed item.
+func (app *application) publishPost(ctx context.Context, post *store.Post, author *store.User, audience []int64) {
+	item := store.PostWithMetadata{
+		Post: *post,
+		User: store.User{ID: author.ID, Username: author.Username, Avatar: author.Avatar},
+	}
+
+	if err := app.events.Publish(ctx, audience, eventPost, item); err != nil {
+		app.logger.Errorw("error publishing post", "post", post.ID, "error", err)
+	}
+}
+
+// notify records a notification in the background and streams it, grouped
+// with the others of its kind, to the notified user, emailing it when they
+// asked for instant emails.
+func (app *application) notify(n store.NewNotification) {
+	app.background(func() {
+		ctx := context.Background()
+
+		id, err := app.store.Notifications.Add(ctx, n)
+		if err != nil {
+			app.logger.Errorw("error adding notification", "user", n.UserID, "kind", n.Kind, "error", err)
+			return
+		}
+
+		// the user doesn't want to hear from the actor
+		if id == 0 {
+			return
+		}
+
+		notification, err := app.store.Notifications.GetByID(ctx, n.UserID, id)
+		if err != nil {
+			app.logger.Errorw("error fetching notification", "id", id, "error", err)
+			return
+		}
+
+		if err := app.events.Publish(ctx, []int64{n.UserID}, eventNotification, notification); err != nil {
+			app.logger.Errorw("error publishing notification", "id", id, "error", err)
+		}
+
+		app.emailNotification(ctx, n.UserID, notification)
+	})
+}
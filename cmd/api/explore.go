@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/wesleybruno/golang-monolito/internal/store"
+)
+
+// refreshExplore recomputes the trending tags of every window and the pool
+// of popular posts, replacing the cached ones.
+func (app *application) refreshExplore(ctx context.Context) error {
+	for window := range store.TrendingWindows {
+		if _, err := app.computeTrendingTags(ctx, window); err != nil {
+			return err
+		}
+	}
+
+	_, err := app.computePopularPostIDs(ctx)
+	return err
+}
+
+func (app *application) computeTrendingTags(ctx context.Context, window string) ([]*store.TrendingTag, error) {
+	cfg := app.config.explore
+
+	tags, err := app.store.Posts.GetTrendingTags(ctx, store.TrendingWindows[window], cfg.baselinePeriods, cfg.minTagPosts, cfg.trendingTags)
+	if err != nil {
+		return nil, err
+	}
+
+	if app.config.cache.enabled {
+		if err := app.cache.Explore.SetTrendingTags(ctx, window, tags, app.exploreCacheExp()); err != nil {
+			return nil, err
+		}
+	}
+
+	return tags, nil
+}
+
+func (app *application) computePopularPostIDs(ctx context.Context) ([]int64, error) {
+	cfg := app.config.explore
+
+	ids, err := app.store.Posts.GetPopularPostIDs(ctx, time.Now().Add(-cfg.popularWindow), cfg.popularPosts)
+	if err != nil {
+		return nil, err
+	}
+
+	if app.config.cache.enabled {
+		if err := app.cache.Explore.SetPopularPostIDs(ctx, ids, app.exploreCacheExp()); err != nil {
+			return nil, err
+		}
+	}
+
+	return ids, nil
+}
+
+// exploreCacheExp outlives a few refreshes, so stale results expire when the
+// job stops running instead of being served forever.
+func (app *application) exploreCacheExp() time.Duration {
+	return app.config.explore.cacheExp
+}
+
+// getTrendingTags reads the cached trending tags of window, computing them
+// when the job hasn't run yet.
+func (app *application) getTrendingTags(ctx context.Context, window string) ([]*store.TrendingTag, error) {
+	if app.config.cache.enabled {
+		tags, err := app.cache.Explore.GetTrendingTags(ctx, window)
+		if err != nil {
+			return nil, err
+		}
+
+		if tags != nil {
+			return tags, nil
+		}
+	}
+
+	return app.computeTrendingTags(ctx, window)
+}
+
+// getPopularPostIDs reads the cached pool of popular posts, computing it
+// when the job hasn't run yet.
+func (app *application) getPopularPostIDs(ctx context.Context) ([]int64, error) {
+	if app.config.cache.enabled {
+		ids, err := app.cache.Explore.GetPopularPostIDs(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if ids != nil {
+			return ids, nil
+		}
+	}
+
+	return app.computePopularPostIDs(ctx)
+}
+
+// GetTrendingTags godoc
+//
+//	@Summary		Fetches the trending tags
+//	@Description	Fetches the tags used on public posts the most above their usual rate. Velocity compares the posts of the window with the average of the windows before it
+//	@Tags			explore
+//	@Accept			json
+//	@Produce		json
+//	@Param			window	query		string	false	"1h, 24h (default) or 7d"
+//	@Param			limit	query		int		false	"Limit"
+//	@Success		200		{object}	[]store.TrendingTag
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/explore/tags [get]
+func (app *application) getTrendingTagsHandler(w http.ResponseWriter, r *http.Request) {
+
+	tq := store.TrendingTagsQuery{
+		Window: "24h",
+		Limit:  10,
+	}
+
+	tq, err := tq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(tq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	tags, err := app.getTrendingTags(r.Context(), tq.Window)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tags[:min(tq.Limit, len(tags))]); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// GetExplorePosts godoc
+//
+//	@Summary		Fetches the explore feed
+//	@Description	Fetches popular public posts by people the caller doesn't follow
+//	@Tags			explore
+//	@Accept			json
+//	@Produce		json
+//	@Param			tag		query		string	false	"Only posts with this tag"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Success		200		{object}	[]store.PostWithMetadata
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/explore/posts [get]
+func (app *application) getExplorePostsHandler(w http.ResponseWriter, r *http.Request) {
+
+	eq := store.ExploreQuery{
+		Limit:  20,
+		Offset: 0,
+	}
+
+	eq, err := eq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(eq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	viewer := getUserFromCtx(r)
+
+	ids, err := app.getPopularPostIDs(ctx)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	posts, err := app.store.Posts.GetExplorePosts(ctx, viewer.ID, ids, eq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, posts); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/wesleybruno/golang-monolito/internal/auth"
+	"github.com/wesleybruno/golang-monolito/internal/export"
+	"github.com/wesleybruno/golang-monolito/internal/mailer"
+	"github.com/wesleybruno/golang-monolito/internal/store"
+)
+
+// CreateDataExport godoc
+//
+//	@Summary		Requests a copy of my personal data
+//	@Description	Starts an export of everything held about the authenticated user. A download link is emailed once it's ready
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Success		202	{object}	store.DataExport
+//	@Failure		409	{object}	error	"Export already in progress"
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/user/me/export [post]
+func (app *application) createDataExportHandler(w http.ResponseWriter, r *http.Request) {
+
+	user := getUserFromCtx(r)
+
+	dataExport, err := app.store.Exports.Create(r.Context(), user.ID)
+	if err != nil {
+		switch err {
+		case store.ErrExportInProgress:
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.background(func() {
+		app.runDataExport(dataExport.ID, user)
+	})
+
+	if err := app.jsonResponse(w, http.StatusAccepted, dataExport); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// GetDataExport godoc
+//
+//	@Summary		Fetches the status of a data export
+//	@Description	Fetches the status of one of the authenticated user's data exports
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			exportId	path		int	true	"Export ID"
+//	@Success		200			{object}	store.DataExport
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/user/me/export/{exportId} [get]
+func (app *application) getDataExportHandler(w http.ResponseWriter, r *http.Request) {
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "exportId"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+
+	dataExport, err := app.store.Exports.GetByID(r.Context(), id)
+	if err == nil && dataExport.UserID != user.ID {
+		err = store.ErrNotFound
+	}
+
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, dataExport); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// DownloadDataExport godoc
+//
+//	@Summary		Downloads a data export
+//	@Description	Downloads the ZIP of a completed data export through the signed link sent by email
+//	@Tags			users
+//	@Produce		application/zip
+//	@Param			exportId	path		int		true	"Export ID"
+//	@Param			expires		query		int		true	"Link expiry, unix seconds"
+//	@Param			signature	query		string	true	"Link signature"
+//	@Success		200			{file}		file
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Router			/user/export/{exportId}/download [get]
+func (app *application) downloadDataExportHandler(w http.ResponseWriter, r *http.Request) {
+
+	exportID := chi.URLParam(r, "exportId")
+	expires := r.URL.Query().Get("expires")
+	signature := r.URL.Query().Get("signature")
+
+	if !auth.VerifySignature(app.config.auth.token.secret, exportSignatureMessage(exportID, expires), signature) {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	id, err := strconv.ParseInt(exportID, 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	dataExport, err := app.store.Exports.GetByID(ctx, id)
+	if err == nil && dataExport.Status != store.ExportCompleted {
+		err = store.ErrNotFound
+	}
+
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	file, err := app.exports.Open(ctx, dataExport.FileKey)
+	if err != nil {
+		app.notFoundResponse(w, r, err)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="data-export-%d.zip"`, dataExport.ID))
+
+	if _, err := io.Copy(w, file); err != nil {
+		app.logger.Warnw("error sending data export", "id", dataExport.ID, "error", err)
+	}
+
+}
+
+// runDataExport builds the archive of a queued export and emails its link.
+func (app *application) runDataExport(exportID int64, user *store.User) {
+	ctx := context.Background()
+
+	fail := func(err error) {
+		app.logger.Errorw("data export failed", "id", exportID, "user", user.ID, "error", err)
+
+		if err := app.store.Exports.Fail(ctx, exportID, err.Error()); err != nil {
+			app.logger.Errorw("error marking data export as failed", "id", exportID, "error", err)
+		}
+	}
+
+	if err := app.store.Exports.MarkRunning(ctx, exportID); err != nil {
+		fail(err)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := export.WriteArchive(ctx, &buf, app.store.Exports, user.ID); err != nil {
+		fail(err)
+		return
+	}
+
+	key := fmt.Sprintf("%d/%d.zip", user.ID, exportID)
+	if err := app.exports.Put(ctx, key, &buf); err != nil {
+		fail(err)
+		return
+	}
+
+	expiresAt := time.Now().Add(app.config.export.exp)
+	if err := app.store.Exports.Complete(ctx, exportID, key, expiresAt); err != nil {
+		fail(err)
+		return
+	}
+
+	id := strconv.FormatInt(exportID, 10)
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	signature := auth.Sign(app.config.auth.token.secret, exportSignatureMessage(id, expires))
+
+	vars := struct {
+		Username    string
+		DownloadURL string
+		ExpiresAt   string
+	}{
+		Username:    user.Username,
+		DownloadURL: app.externalURL(fmt.Sprintf("/v1/user/export/%s/download?expires=%s&signature=%s", id, expires, signature)),
+		ExpiresAt:   expiresAt.UTC().Format(time.RFC1123),
+	}
+
+	isProdEnv := app.config.env == "production"
+	if _, err := app.mailer.Send(mailer.DataExportTemplate, user.Username, user.Email, vars, !isProdEnv); err != nil {
+		app.logger.Errorw("error sending data export email", "id", exportID, "error", err)
+		return
+	}
+
+	app.logger.Infow("data export completed", "id", exportID, "user", user.ID)
+}
+
+func exportSignatureMessage(exportID, expires string) string {
+	return "export:" + exportID + ":" + expires
+}
+
+// externalURL turns an API path into an absolute URL for links sent outside
+// of the API, such as emails.
+func (app *application) externalURL(path string) string {
+	base := strings.TrimSuffix(app.config.apiUrl, "/")
+
+	if !strings.Contains(base, "://") {
+		scheme := "https://"
+		if app.config.env != "production" {
+			scheme = "http://"
+		}
+		base = scheme + base
+	}
+
+	return base + path
+}
@@ -2,38 +2,46 @@ package main
 
 import (
 	"net/http"
+	"time"
 
+	"github.com/wesleybruno/golang-monolito/internal/feed"
 	"github.com/wesleybruno/golang-monolito/internal/store"
 )
 
 // getUserFeedHandler godoc
 //
 //	@Summary		Fetches the user feed
-//	@Description	Fetches the user feed
+//	@Description	Fetches the user feed. Pages are walked with the cursors of the response (also sent as a Link header) or, for older clients, with offset
 //	@Tags			feed
 //	@Accept			json
 //	@Produce		json
-//	@Param			since	query		string	false	"Since"
-//	@Param			until	query		string	false	"Until"
-//	@Param			limit	query		int		false	"Limit"
-//	@Param			offset	query		int		false	"Offset"
-//	@Param			sort	query		string	false	"Sort"
-//	@Param			tags	query		string	false	"Tags"
-//	@Param			search	query		string	false	"Search"
-//	@Success		200		{object}	[]store.PostWithMetadata
-//	@Failure		400		{object}	error
-//	@Failure		500		{object}	error
+//	@Param			since		query		string	false	"Oldest created_at, RFC 3339 or relative to now like -24h"
+//	@Param			until		query		string	false	"Newest created_at (exclusive), RFC 3339 or relative to now like -1h"
+//	@Param			limit		query		int		false	"Limit"
+//	@Param			offset		query		int		false	"Offset"
+//	@Param			cursor		query		string	false	"Cursor returned by another page, can't be combined with offset"
+//	@Param			sort		query		string	false	"Sort"
+//	@Param			tags		query		string	false	"Tags"
+//	@Param			tags_mode	query		string	false	"all (default), any or none of the tags"
+//	@Param			search		query		string	false	"Search"
+//	@Param			mode		query		string	false	"chronological (default) or ranked"
+//	@Param			explain		query		bool	false	"Adds the score breakdown of each post to the ranked feed"
+//	@Success		200			{object}	[]store.PostWithMetadata
+//	@Failure		400			{object}	error
+//	@Failure		500			{object}	error
 //	@Security		ApiKeyAuth
 //	@Router			/user/feed [get]
 func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Request) {
 
-	//TODO(refact): get id from auth
-	myId := int64(1)
+	user := getUserFromCtx(r)
+	myId := user.ID
 
 	fq := store.PaginationFeedQuery{
-		Limit:  20,
-		Offset: 0,
-		Sort:   "desc",
+		Limit:    20,
+		Offset:   0,
+		Sort:     "desc",
+		TagsMode: "all",
+		Mode:     "chronological",
 	}
 
 	fq, err := fq.Parse(r)
@@ -47,12 +55,89 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	posts, err := app.store.Posts.GetUserFeed(r.Context(), myId, fq)
+	ctx := r.Context()
+
+	if fq.Mode == "ranked" {
+		app.getRankedFeed(w, r, myId, fq)
+		return
+	}
+
+	var posts []*store.PostWithMetadata
+	var pc store.PageCursors
+	var cached bool
+
+	if app.canReadTimeline(fq) {
+		posts, pc, cached, err = app.getTimelineFeed(ctx, myId, fq)
+		if err != nil {
+			// the database can still serve the feed
+			app.logger.Errorw("error reading timeline", "user", myId, "error", err)
+		}
+	}
+
+	if !cached {
+		posts, pc, err = app.store.Posts.GetUserFeed(ctx, myId, fq)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	cursors := newPageCursors(pc)
+	setLinkHeader(w, r, cursors)
+
+	if err := app.paginatedJsonResponse(w, http.StatusOK, posts, cursors); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+type rankedPost struct {
+	*store.PostWithMetadata
+	Explanation *feed.Explanation `json:"explanation,omitempty"`
+}
+
+// getRankedFeed scores the newest posts of the feed and pages through them
+// by offset, the ranking not being stable enough for cursors.
+func (app *application) getRankedFeed(w http.ResponseWriter, r *http.Request, userID int64, fq store.PaginationFeedQuery) {
+
+	if fq.Since == nil {
+		since := time.Now().Add(-app.config.feed.rankingWindow)
+		fq.Since = &since
+	}
+
+	candidates, err := app.store.Posts.GetRankingCandidates(r.Context(), userID, fq, app.config.feed.rankingCandidates)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
+	now := time.Now()
+	signals := make([]feed.Signals, len(candidates))
+	for i, c := range candidates {
+		signals[i] = feed.Signals{
+			Age:            now.Sub(c.CreatedAt),
+			Comments:       c.CountComments,
+			Reactions:      c.CountReactions,
+			AuthorAffinity: c.AuthorAffinity,
+			TagAffinity:    c.TagAffinity,
+		}
+	}
+
+	order, explanations := feed.Rank(app.config.feed.ranking, signals)
+
+	start := min(fq.Offset, len(order))
+	end := min(start+fq.Limit, len(order))
+
+	posts := make([]rankedPost, 0, end-start)
+	for _, i := range order[start:end] {
+		post := rankedPost{PostWithMetadata: &candidates[i].PostWithMetadata}
+		if fq.Explain {
+			post.Explanation = &explanations[i]
+		}
+		posts = append(posts, post)
+	}
+
 	if err := app.jsonResponse(w, http.StatusOK, posts); err != nil {
 		app.internalServerError(w, r, err)
 		return
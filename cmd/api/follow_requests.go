@@ -0,0 +1,264 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/wesleybruno/golang-monolito/internal/store"
+	"github.com/wesleybruno/golang-monolito/internal/webhooks"
+)
+
+func (app *application) requestFollow(w http.ResponseWriter, r *http.Request, requesterId int64, targetId int64) {
+
+	req, err := app.store.FollowRequests.Create(r.Context(), requesterId, targetId)
+	if err != nil {
+		switch err {
+		case store.ErrDuplicateKey:
+			app.conflictResponse(w, r, err)
+		case store.ErrBlocked:
+			app.forbiddenResponse(w, r)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.notify(store.NewNotification{UserID: targetId, ActorID: requesterId, Kind: store.NotificationFollowRequest})
+
+	if err := app.jsonResponse(w, http.StatusAccepted, req); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// GetFollowRequest godoc
+//
+//	@Summary		Fetches my follow request to a user
+//	@Description	Fetches the status of the follow request sent to a private account
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int	true	"User ID"
+//	@Success		200		{object}	store.FollowRequest
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/user/{userID}/follow-request [get]
+func (app *application) getFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+
+	user := getUserFromCtx(r)
+
+	targetId, err := strconv.ParseInt(chi.URLParam(r, "userId"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	req, err := app.store.FollowRequests.Get(r.Context(), user.ID, targetId)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, req); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// GetPendingFollowRequests godoc
+//
+//	@Summary		Lists follow requests waiting for my answer
+//	@Description	Lists pending follow requests sent to the authenticated user, most recent first
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			since	query		string	false	"Oldest created_at, RFC 3339 or relative to now like -24h"
+//	@Param			until	query		string	false	"Newest created_at (exclusive), RFC 3339 or relative to now like -1h"
+//	@Param			cursor	query		string	false	"Cursor returned by the previous page"
+//	@Success		200		{object}	[]store.FollowRequest
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/user/me/follow-requests [get]
+func (app *application) getPendingFollowRequestsHandler(w http.ResponseWriter, r *http.Request) {
+
+	user := getUserFromCtx(r)
+
+	cq := store.PaginationCursorQuery{
+		Limit: 20,
+	}
+
+	cq, err := cq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(cq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	requests, next, err := app.store.FollowRequests.GetPending(r.Context(), user.ID, cq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var cursors pageCursors
+	if next != nil {
+		cursors.Next = next.Encode()
+	}
+
+	if err := app.paginatedJsonResponse(w, http.StatusOK, requests, cursors); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// AcceptFollowRequest godoc
+//
+//	@Summary		Accepts a follow request
+//	@Description	Accepts the pending follow request sent by a user
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int		true	"Requester ID"
+//	@Success		204		{string}	string	"Follow request accepted"
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/user/me/follow-requests/{userID}/accept [put]
+func (app *application) acceptFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+
+	user := getUserFromCtx(r)
+
+	requesterId, err := strconv.ParseInt(chi.URLParam(r, "userId"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	err = app.store.FollowRequests.Accept(r.Context(), user.ID, requesterId)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.invalidateUsers(r.Context(), user.ID, requesterId)
+	app.invalidateTimelines(r.Context(), requesterId)
+	app.notify(store.NewNotification{UserID: requesterId, ActorID: user.ID, Kind: store.NotificationFollowRequestAccepted})
+	app.emitWebhook(user.ID, webhooks.EventUserFollowed, followEvent{UserID: user.ID, FollowerID: requesterId})
+
+	if err := app.jsonResponseNoData(w, http.StatusNoContent); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// RejectFollowRequest godoc
+//
+//	@Summary		Rejects a follow request
+//	@Description	Rejects the pending follow request sent by a user
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int		true	"Requester ID"
+//	@Success		204		{string}	string	"Follow request rejected"
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/user/me/follow-requests/{userID}/reject [put]
+func (app *application) rejectFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+
+	user := getUserFromCtx(r)
+
+	requesterId, err := strconv.ParseInt(chi.URLParam(r, "userId"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	err = app.store.FollowRequests.Reject(r.Context(), user.ID, requesterId)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponseNoData(w, http.StatusNoContent); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+type UpdatePrivacyPayload struct {
+	IsPrivate *bool `json:"is_private" validate:"required"`
+}
+
+// UpdatePrivacy godoc
+//
+//	@Summary		Makes my account private or public
+//	@Description	Private accounts require approval of follow requests. Going public accepts every pending request
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		UpdatePrivacyPayload	true	"Privacy payload"
+//	@Success		204		{string}	string					"Privacy updated"
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/user/me/privacy [put]
+func (app *application) updatePrivacyHandler(w http.ResponseWriter, r *http.Request) {
+
+	var payload UpdatePrivacyPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+
+	if err := app.store.Users.SetPrivacy(r.Context(), user.ID, *payload.IsPrivate); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.invalidateUsers(r.Context(), user.ID)
+
+	if err := app.jsonResponseNoData(w, http.StatusNoContent); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/wesleybruno/golang-monolito/internal/store"
+)
+
+// GetFollowers godoc
+//
+//	@Summary		Lists the followers of a user
+//	@Description	Lists the users following a user, most recent first, using keyset pagination
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			since	query		string	false	"Oldest created_at, RFC 3339 or relative to now like -24h"
+//	@Param			until	query		string	false	"Newest created_at (exclusive), RFC 3339 or relative to now like -1h"
+//	@Param			cursor	query		string	false	"Cursor returned by the previous page"
+//	@Success		200		{object}	[]store.FollowListEntry
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/user/{userID}/followers [get]
+func (app *application) getFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	app.listFollows(w, r, app.store.Follower.GetFollowers)
+}
+
+// GetFollowing godoc
+//
+//	@Summary		Lists the users a user follows
+//	@Description	Lists the users followed by a user, most recent first, using keyset pagination
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			since	query		string	false	"Oldest created_at, RFC 3339 or relative to now like -24h"
+//	@Param			until	query		string	false	"Newest created_at (exclusive), RFC 3339 or relative to now like -1h"
+//	@Param			cursor	query		string	false	"Cursor returned by the previous page"
+//	@Success		200		{object}	[]store.FollowListEntry
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/user/{userID}/following [get]
+func (app *application) getFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	app.listFollows(w, r, app.store.Follower.GetFollowing)
+}
+
+type followListFunc func(ctx context.Context, userId int64, viewerId int64, cq store.PaginationCursorQuery) ([]*store.FollowListEntry, *store.Cursor, error)
+
+func (app *application) listFollows(w http.ResponseWriter, r *http.Request, list followListFunc) {
+
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userId"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	cq := store.PaginationCursorQuery{
+		Limit: 20,
+	}
+
+	cq, err = cq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(cq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	viewer := getUserFromCtx(r)
+
+	entries, next, err := list(r.Context(), userID, viewer.ID, cq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var cursors pageCursors
+	if next != nil {
+		cursors.Next = next.Encode()
+	}
+
+	if err := app.paginatedJsonResponse(w, http.StatusOK, entries, cursors); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
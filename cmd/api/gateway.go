@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wesleybruno/golang-monolito/internal/env"
+	"github.com/wesleybruno/golang-monolito/internal/gateway"
+	"github.com/wesleybruno/golang-monolito/internal/store"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// gatewayProtocol is the websocket subprotocol of the gateway. Browsers
+	// offer it next to "bearer.<jwt>", their only way to send the token.
+	gatewayProtocol = "gosocial"
+	// gatewayMaxViewers bounds the viewers listed when subscribing to a post
+	gatewayMaxViewers = 50
+	// typingInterval throttles the typing indicators of a connection
+	typingInterval = time.Second * 2
+
+	msgComment  = "comment"
+	msgPresence = "presence"
+	msgTyping   = "typing"
+)
+
+type presenceData struct {
+	User   eventActor `json:"user"`
+	Status string     `json:"status"`
+}
+
+type typingData struct {
+	User eventActor `json:"user"`
+}
+
+type subscribedData struct {
+	Viewers []eventActor `json:"viewers"`
+}
+
+// Gateway godoc
+//
+//	@Summary		Opens the websocket gateway
+//	@Description	Upgrades to a websocket carrying the caller's live notifications and, for the posts they subscribe to, new comments, viewers and typing indicators. Clients send JSON messages {"type": "subscribe" | "unsubscribe" | "typing" | "ping", "topic": "post:<id>"} and must send one at least every minute. Browsers pass the token as the "bearer.<jwt>" subprotocol next to "gosocial"
+//	@Tags			gateway
+//	@Success		101	{string}	string	"Switching protocols"
+//	@Failure		401	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/gateway [get]
+func (app *application) gatewayHandler(w http.ResponseWriter, r *http.Request) {
+
+	user := getUserFromCtx(r)
+
+	srv := websocket.Server{
+		Handshake: gatewayHandshake,
+		Handler: func(conn *websocket.Conn) {
+			app.serveGateway(conn, user)
+		},
+	}
+
+	srv.ServeHTTP(w, r)
+
+}
+
+// gatewayHandshake accepts browsers from the allowed origin only and picks
+// the gateway subprotocol.
+func gatewayHandshake(cfg *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	allowed := env.Config.CorsAllowedOrigin
+	if origin != "" && allowed != "*" && origin != allowed {
+		return errors.New("origin not allowed")
+	}
+
+	if len(cfg.Protocol) > 0 {
+		if !slices.Contains(cfg.Protocol, gatewayProtocol) {
+			return errors.New("unsupported subprotocol")
+		}
+		cfg.Protocol = []string{gatewayProtocol}
+	}
+
+	return nil
+}
+
+// websocketToken returns the token offered as a "bearer.<jwt>" subprotocol.
+func websocketToken(r *http.Request) string {
+	for _, protocol := range strings.Split(r.Header.Get("Sec-WebSocket-Protocol"), ",") {
+		if token, ok := strings.CutPrefix(strings.TrimSpace(protocol), "bearer."); ok {
+			return token
+		}
+	}
+	return ""
+}
+
+// deliverGatewayMessage keeps users from seeing the activity of the people
+// they blocked or are blocked by, and their own presence and typing.
+func deliverGatewayMessage(c *gateway.Client, msg gateway.Message) bool {
+	if msg.Sender == 0 {
+		return true
+	}
+
+	if msg.Sender == c.UserID {
+		return msg.Type == msgComment
+	}
+
+	return !c.Ignores(msg.Sender)
+}
+
+type gatewaySession struct {
+	app    *application
+	client *gateway.Client
+	user   *store.User
+	typing map[string]time.Time
+}
+
+func (app *application) serveGateway(conn *websocket.Conn, user *store.User) {
+	ctx := context.Background()
+
+	client, err := app.gateway.Connect(conn, user.ID)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	blocked, err := app.store.Blocks.GetBlockedIDs(ctx, user.ID)
+	if err != nil {
+		app.logger.Errorw("error loading blocked users for gateway", "user", user.ID, "error", err)
+	}
+	client.Ignore(blocked...)
+
+	// the notifications and feed posts streamed over SSE come through too
+	sub, err := app.events.Subscribe(ctx, user.ID)
+	if err != nil {
+		app.logger.Errorw("error subscribing gateway to events", "user", user.ID, "error", err)
+	} else {
+		defer sub.Close()
+
+		go func() {
+			for ev := range sub.C {
+				client.Send(gateway.Message{Type: ev.Type, ID: ev.ID, Data: ev.Data})
+			}
+			// the events fell behind, or the connection is over already
+			client.Close("slow consumer")
+		}()
+	}
+
+	s := &gatewaySession{
+		app:    app,
+		client: client,
+		user:   user,
+		typing: make(map[string]time.Time),
+	}
+
+	client.Run(s.handle)
+
+	for _, topic := range app.gateway.Disconnect(ctx, client) {
+		s.publishPresence(ctx, topic, "left")
+	}
+}
+
+func (s *gatewaySession) handle(msg gateway.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	switch msg.Type {
+	case "ping":
+		s.client.Send(gateway.Message{Type: "pong"})
+	case "subscribe":
+		s.subscribe(ctx, msg.Topic)
+	case "unsubscribe":
+		if s.app.gateway.Unsubscribe(ctx, s.client, msg.Topic) {
+			s.publishPresence(ctx, msg.Topic, "left")
+		}
+		s.client.Send(gateway.Message{Type: "unsubscribed", Topic: msg.Topic})
+	case "typing":
+		s.typingIn(ctx, msg.Topic)
+	default:
+		s.fail(msg.Topic, "unknown message type")
+	}
+}
+
+func (s *gatewaySession) subscribe(ctx context.Context, topic string) {
+	postID, ok := postTopicID(topic)
+	if !ok {
+		s.fail(topic, "unknown topic")
+		return
+	}
+
+	// the post must be visible to the caller, like when fetching it
+	if _, err := s.app.store.Posts.GetByID(ctx, postID, s.user.ID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			s.fail(topic, "post not found")
+		default:
+			s.app.logger.Errorw("error loading post for gateway", "post", postID, "error", err)
+			s.fail(topic, "internal error")
+		}
+		return
+	}
+
+	joined, err := s.app.gateway.Subscribe(ctx, s.client, topic)
+	if err != nil {
+		switch err {
+		case gateway.ErrTooManyTopics:
+			s.fail(topic, err.Error())
+		default:
+			s.app.logger.Errorw("error subscribing to topic", "topic", topic, "error", err)
+			s.fail(topic, "internal error")
+		}
+		return
+	}
+
+	viewers, err := s.viewers(ctx, topic)
+	if err != nil {
+		s.app.logger.Errorw("error listing topic viewers", "topic", topic, "error", err)
+	}
+
+	data, _ := json.Marshal(subscribedData{Viewers: viewers})
+	s.client.Send(gateway.Message{Type: "subscribed", Topic: topic, Data: data})
+
+	if joined {
+		s.publishPresence(ctx, topic, "joined")
+	}
+}
+
+// viewers lists the other members of topic the caller can see.
+func (s *gatewaySession) viewers(ctx context.Context, topic string) ([]eventActor, error) {
+	ids, err := s.app.gateway.Members(ctx, topic)
+	if err != nil {
+		return []eventActor{}, err
+	}
+
+	viewers := []eventActor{}
+	for _, id := range ids {
+		if len(viewers) == gatewayMaxViewers {
+			break
+		}
+		if id == s.user.ID || s.client.Ignores(id) {
+			continue
+		}
+
+		user, err := s.app.getUser(ctx, id)
+		if err != nil {
+			continue
+		}
+		viewers = append(viewers, eventActor{ID: user.ID, Username: user.Username, Avatar: user.Avatar})
+	}
+
+	return viewers, nil
+}
+
+func (s *gatewaySession) typingIn(ctx context.Context, topic string) {
+	if !s.app.gateway.Subscribed(s.client, topic) {
+		s.fail(topic, "not subscribed")
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(s.typing[topic]) < typingInterval {
+		return
+	}
+	s.typing[topic] = now
+
+	data, _ := json.Marshal(typingData{User: s.actor()})
+	if err := s.app.gateway.Publish(ctx, topic, gateway.Message{Type: msgTyping, Sender: s.user.ID, Data: data}); err != nil {
+		s.app.logger.Errorw("error publishing typing indicator", "topic", topic, "error", err)
+	}
+}
+
+func (s *gatewaySession) publishPresence(ctx context.Context, topic string, status string) {
+	data, _ := json.Marshal(presenceData{User: s.actor(), Status: status})
+	if err := s.app.gateway.Publish(ctx, topic, gateway.Message{Type: msgPresence, Sender: s.user.ID, Data: data}); err != nil {
+		s.app.logger.Errorw("error publishing presence", "topic", topic, "error", err)
+	}
+}
+
+func (s *gatewaySession) actor() eventActor {
+	return eventActor{ID: s.user.ID, Username: s.user.Username, Avatar: s.user.Avatar}
+}
+
+func (s *gatewaySession) fail(topic string, reason string) {
+	s.client.Send(gateway.Message{Type: "error", Topic: topic, Error: reason})
+}
+
+func postTopic(postID int64) string {
+	return "post:" + strconv.FormatInt(postID, 10)
+}
+
+func postTopicID(topic string) (int64, bool) {
+	id, ok := strings.CutPrefix(topic, "post:")
+	if !ok {
+		return 0, false
+	}
+
+	postID, err := strconv.ParseInt(id, 10, 64)
+	return postID, err == nil
+}
+
+// publishComment streams a new comment to the viewers of its post.
+func (app *application) publishComment(ctx context.Context, comment *store.Comment) {
+	data, err := json.Marshal(comment)
+	if err != nil {
+		app.logger.Errorw("error encoding comment", "comment", comment.ID, "error", err)
+		return
+	}
+
+	msg := gateway.Message{Type: msgComment, Sender: comment.UserId, Data: data}
+	if err := app.gateway.Publish(ctx, postTopic(comment.PostId), msg); err != nil {
+		app.logger.Errorw("error publishing comment", "comment", comment.ID, "error", err)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/wesleybruno/golang-monolito/internal/store"
+)
+
+// GetJobs godoc
+//
+//	@Summary		Lists background jobs
+//	@Description	Lists the jobs run by the worker, most recent first, without their payloads. Dead jobs ran out of attempts. Restricted to admins
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			status	query		string	false	"Status: pending, running, succeeded or dead"
+//	@Param			kind	query		string	false	"Job kind, like email.send"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			since	query		string	false	"Oldest created_at, RFC 3339 or relative to now like -24h"
+//	@Param			until	query		string	false	"Newest created_at (exclusive), RFC 3339 or relative to now like -1h"
+//	@Param			cursor	query		string	false	"Cursor returned by the previous page"
+//	@Success		200		{object}	[]store.Job
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/jobs [get]
+func (app *application) getJobsHandler(w http.ResponseWriter, r *http.Request) {
+
+	jq := store.JobQuery{
+		PaginationCursorQuery: store.PaginationCursorQuery{
+			Limit: 20,
+		},
+	}
+
+	jq, err := jq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(jq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	jobs, next, err := app.store.Jobs.List(r.Context(), jq)
+	if err != nil {
+		switch err {
+		case store.ErrInvalidCursor:
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	var cursors pageCursors
+	if next != nil {
+		cursors.Next = next.Encode()
+	}
+
+	if err := app.paginatedJsonResponse(w, http.StatusOK, jobs, cursors); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// RetryJob godoc
+//
+//	@Summary		Retries a dead job
+//	@Description	Queues a dead job again with a fresh set of attempts. Restricted to admins
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			jobId	path		int	true	"Job ID"
+//	@Success		200		{object}	store.Job
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error	"Job not found or not dead"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/jobs/{jobId}/retry [post]
+func (app *application) retryJobHandler(w http.ResponseWriter, r *http.Request) {
+
+	jobID, err := strconv.ParseInt(chi.URLParam(r, "jobId"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	job, err := app.store.Jobs.Retry(ctx, jobID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(ctx, getUserFromCtx(r).ID, "job.retried", nil, map[string]any{"job_id": job.ID, "kind": job.Kind})
+
+	if err := app.jsonResponse(w, http.StatusOK, job); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
@@ -2,9 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/wesleybruno/golang-monolito/internal/store"
 )
 
 var Validate *validator.Validate
@@ -50,6 +53,56 @@ func (app *application) jsonResponse(w http.ResponseWriter, status int, data any
 	return writeJson(w, status, &envelope{Data: data})
 }
 
+// pageCursors are the opaque tokens clients send back to fetch the
+// neighbouring pages of a keyset paginated listing.
+type pageCursors struct {
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+func newPageCursors(pc store.PageCursors) pageCursors {
+	var cursors pageCursors
+	if pc.Next != nil {
+		cursors.Next = pc.Next.Encode()
+	}
+	if pc.Prev != nil {
+		cursors.Prev = pc.Prev.Encode()
+	}
+	return cursors
+}
+
+// setLinkHeader advertises the cursors as RFC 8288 links to the same request
+// with the cursor swapped, dropping any offset.
+func setLinkHeader(w http.ResponseWriter, r *http.Request, cursors pageCursors) {
+	link := func(cursor, rel string) string {
+		qs := r.URL.Query()
+		qs.Del("offset")
+		qs.Set("cursor", cursor)
+		return fmt.Sprintf(`<%s?%s>; rel="%s"`, r.URL.Path, qs.Encode(), rel)
+	}
+
+	var links []string
+	if cursors.Next != "" {
+		links = append(links, link(cursors.Next, "next"))
+	}
+	if cursors.Prev != "" {
+		links = append(links, link(cursors.Prev, "prev"))
+	}
+
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
+
+func (app *application) paginatedJsonResponse(w http.ResponseWriter, status int, data any, cursors pageCursors) error {
+	type envelope struct {
+		Data    any         `json:"data"`
+		Cursors pageCursors `json:"cursors"`
+	}
+
+	return writeJson(w, status, &envelope{Data: data, Cursors: cursors})
+}
+
 func (app *application) jsonResponseNoData(w http.ResponseWriter, status int) error {
 	w.WriteHeader(status)
 	return nil
@@ -3,6 +3,7 @@ package main
 import (
 	"expvar"
 	"fmt"
+	"os"
 	"runtime"
 	"time"
 
@@ -10,10 +11,16 @@ import (
 	"github.com/wesleybruno/golang-monolito/internal/auth"
 	"github.com/wesleybruno/golang-monolito/internal/db"
 	"github.com/wesleybruno/golang-monolito/internal/env"
+	"github.com/wesleybruno/golang-monolito/internal/events"
+	"github.com/wesleybruno/golang-monolito/internal/feed"
+	"github.com/wesleybruno/golang-monolito/internal/filestore"
+	"github.com/wesleybruno/golang-monolito/internal/gateway"
 	"github.com/wesleybruno/golang-monolito/internal/mailer"
 	"github.com/wesleybruno/golang-monolito/internal/ratelimiter"
+	"github.com/wesleybruno/golang-monolito/internal/scheduler"
 	"github.com/wesleybruno/golang-monolito/internal/store"
 	"github.com/wesleybruno/golang-monolito/internal/store/cache"
+	"github.com/wesleybruno/golang-monolito/internal/webhooks"
 	"go.uber.org/zap"
 )
 
@@ -70,11 +77,63 @@ func main() {
 				pass: env.Config.AuthBasicPass,
 			},
 			token: tokenConfig{
-				secret: env.Config.JwtSecret,
-				exp:    time.Hour * 24 * 3, // 3 days
-				iss:    "goapi",
+				secret:           env.Config.JwtSecret,
+				exp:              time.Hour * 24 * 3, // 3 days
+				impersonationExp: time.Minute * 15,
+				iss:              "goapi",
 			},
 		},
+		media: mediaConfig{
+			dir:     env.GetString(env.Config.MediaDir, "./media"),
+			baseURL: env.GetString(env.Config.MediaBaseURL, "/v1/media"),
+		},
+		export: exportConfig{
+			dir: env.GetString(env.Config.ExportsDir, "./exports"),
+			exp: time.Hour * 48, // 2 days
+		},
+		feed: feedConfig{
+			celebrityThreshold: 10_000,
+			ranking: feed.Weights{
+				HalfLife:    env.GetDuration(env.Config.FeedRankingHalfLife, feed.DefaultWeights.HalfLife),
+				Recency:     env.GetFloat(env.Config.FeedWeightRecency, feed.DefaultWeights.Recency),
+				Engagement:  env.GetFloat(env.Config.FeedWeightEngagement, feed.DefaultWeights.Engagement),
+				Affinity:    env.GetFloat(env.Config.FeedWeightAffinity, feed.DefaultWeights.Affinity),
+				TagAffinity: env.GetFloat(env.Config.FeedWeightTagAffinity, feed.DefaultWeights.TagAffinity),
+			},
+			rankingCandidates: 500,
+			rankingWindow:     time.Hour * 24 * 7, // 7 days
+		},
+		explore: exploreConfig{
+			refreshSchedule: "*/5 * * * *",
+			cacheExp:        time.Minute * 15,
+			baselinePeriods: 7,
+			minTagPosts:     3,
+			trendingTags:    50,
+			popularWindow:   time.Hour * 48, // 2 days
+			popularPosts:    500,
+		},
+		stream: streamConfig{
+			heartbeat: time.Second * 15,
+			retry:     time.Second * 5,
+		},
+		notifications: notificationsConfig{
+			digestInterval: time.Hour * 24,
+			digestSize:     20,
+		},
+		webhooks: webhookConfig{
+			pollInterval: time.Second * 15,
+			timeout:      time.Second * 10,
+			lease:        time.Minute,
+			maxAttempts:  8,
+			backoff:      time.Second * 30,
+			maxBackoff:   time.Hour,
+			disableAfter: 20,
+			workers:      8,
+		},
+		deletion: deletionConfig{
+			gracePeriod: env.GetDuration(env.Config.DeletionGracePeriod, time.Hour*24*30), // 30 days
+			anonymize:   env.Config.DeletionPolicy != "delete",
+		},
 		rateLimiter: ratelimiter.Config{
 			RequestPerTimeFrame: env.Config.RateLimiterRequestCount,
 			TimeFrame:           time.Second * 30,
@@ -85,6 +144,12 @@ func main() {
 	logger := zap.Must(zap.NewProduction()).Sugar()
 	defer logger.Sync()
 
+	// a half-life that isn't positive turns every ranking score into NaN or Inf
+	if cfg.feed.ranking.HalfLife <= 0 {
+		logger.Warnw("invalid FEED_RANKING_HALF_LIFE, using the default", "value", cfg.feed.ranking.HalfLife, "default", feed.DefaultWeights.HalfLife)
+		cfg.feed.ranking.HalfLife = feed.DefaultWeights.HalfLife
+	}
+
 	db, err := db.New(cfg.dbConfig.addr, cfg.dbConfig.maxOpenConns, cfg.dbConfig.maxIdleConns, cfg.dbConfig.maxIdleTime)
 	if err != nil {
 		logger.Fatal(err)
@@ -112,6 +177,19 @@ func main() {
 		cfg.rateLimiter.TimeFrame,
 	)
 
+	media := filestore.NewLocalDisk(cfg.media.dir, cfg.media.baseURL)
+	exports := filestore.NewLocalDisk(cfg.export.dir, "")
+
+	var broker events.Broker = events.NewMemoryBroker()
+	var relay gateway.Relay = gateway.NewMemoryRelay()
+	if cfg.cache.enabled {
+		broker = events.NewRedisBroker(rdb, logger)
+		relay = gateway.NewRedisRelay(rdb, logger)
+	}
+
+	// the scheduler records which host ran each job
+	instance, _ := os.Hostname()
+
 	app := &application{
 		config:      cfg,
 		store:       store,
@@ -120,6 +198,14 @@ func main() {
 		mailer:      mailer,
 		auth:        jwtAuthenticator,
 		rateLimiter: rateLimiter,
+		media:       media,
+		exports:     exports,
+		events:      broker,
+		gateway:     gateway.NewHub(relay, logger, deliverGatewayMessage),
+		webhooks:    webhooks.NewSender(cfg.webhooks.timeout),
+		scheduler:   scheduler.New(store.Scheduler, logger, instance),
+		done:        make(chan struct{}),
+		closing:     make(chan struct{}),
 	}
 
 	// Metrics collected
@@ -131,6 +217,13 @@ func main() {
 		return runtime.NumGoroutine()
 	}))
 
+	app.every("deliver webhooks", cfg.webhooks.pollInterval, app.deliverWebhooks)
+
+	if err := app.scheduleJobs(); err != nil {
+		logger.Fatal(err)
+	}
+	app.runScheduler()
+
 	mux := app.mount()
 
 	logger.Fatal(app.run(mux))
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// purgeExpiredTokens removes invitation, email change and password reset
+// tokens nobody can use anymore.
+func (app *application) purgeExpiredTokens(ctx context.Context) error {
+	n, err := app.store.Users.PurgeExpiredTokens(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+
+	app.logger.Infow("expired tokens purged", "count", n)
+	return nil
+}
+
+// expireDataExports deletes the files of the data exports whose download
+// link expired.
+func (app *application) expireDataExports(ctx context.Context) error {
+	for {
+		keys, err := app.store.Exports.ExpireFiles(ctx, time.Now(), 100)
+		if err != nil {
+			return err
+		}
+
+		if len(keys) == 0 {
+			return nil
+		}
+
+		for _, key := range keys {
+			if err := app.exports.Delete(ctx, key); err != nil {
+				app.logger.Warnw("error deleting data export", "key", key, "error", err)
+			}
+		}
+	}
+}
+
+// recomputeFollowCounts corrects follower counts that drifted from the
+// followers table.
+func (app *application) recomputeFollowCounts(ctx context.Context) error {
+	ids, err := app.store.Follower.RecomputeCounts(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(ids) > 0 {
+		app.logger.Warnw("follow counts corrected", "users", len(ids))
+		app.invalidateUsers(ctx, ids...)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/wesleybruno/golang-monolito/internal/imaging"
+	"github.com/wesleybruno/golang-monolito/internal/store"
+)
+
+const maxImageUploadBytes = 5 << 20 // 5MB
+
+type imageSize struct {
+	label         string
+	width, height int
+}
+
+var profileImageSizes = map[string][]imageSize{
+	store.ProfileAvatar: {
+		{"48", 48, 48},
+		{"128", 128, 128},
+		{"512", 512, 512},
+	},
+	store.ProfileBanner: {
+		{"600x200", 600, 200},
+		{"1500x500", 1500, 500},
+	},
+}
+
+// UploadAvatar godoc
+//
+//	@Summary		Uploads my avatar
+//	@Description	Uploads a jpeg, png or gif avatar, resized to 48, 128 and 512 px squares
+//	@Tags			users
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			image	formData	file	true	"Avatar image, up to 5MB"
+//	@Success		200		{object}	store.ImageSet
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/user/me/avatar [put]
+func (app *application) uploadAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	app.uploadProfileImage(w, r, store.ProfileAvatar)
+}
+
+// UploadBanner godoc
+//
+//	@Summary		Uploads my profile banner
+//	@Description	Uploads a jpeg, png or gif banner, resized to 600x200 and 1500x500 px
+//	@Tags			users
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			image	formData	file	true	"Banner image, up to 5MB"
+//	@Success		200		{object}	store.ImageSet
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/user/me/banner [put]
+func (app *application) uploadBannerHandler(w http.ResponseWriter, r *http.Request) {
+	app.uploadProfileImage(w, r, store.ProfileBanner)
+}
+
+func (app *application) uploadProfileImage(w http.ResponseWriter, r *http.Request, kind string) {
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImageUploadBytes)
+
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	defer file.Close()
+
+	img, err := imaging.Decode(file)
+	if err != nil {
+		switch {
+		case errors.Is(err, imaging.ErrUnsupportedFormat), errors.Is(err, imaging.ErrTooLarge):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	user := getUserFromCtx(r)
+	ctx := r.Context()
+
+	uploadID := uuid.New().String()
+	images := store.ImageSet{}
+
+	for _, size := range profileImageSizes[kind] {
+		var buf bytes.Buffer
+		if err := imaging.EncodeJPEG(&buf, imaging.Thumbnail(img, size.width, size.height)); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		key := fmt.Sprintf("%ss/%d/%s_%s.jpg", kind, user.ID, uploadID, size.label)
+		if err := app.media.Put(ctx, key, &buf); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		images[size.label] = app.media.URL(key)
+	}
+
+	previous, err := app.store.Users.SetProfileImage(ctx, user.ID, kind, images)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.invalidateUsers(ctx, user.ID)
+	app.deleteMedia(ctx, previous)
+
+	if err := app.jsonResponse(w, http.StatusOK, images); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// deleteMedia removes the files of a replaced image set, failures only leave
+// orphan files behind so they are logged and ignored.
+func (app *application) deleteMedia(ctx context.Context, images store.ImageSet) {
+	prefix := app.media.URL("")
+
+	for _, url := range images {
+		key, ok := strings.CutPrefix(url, prefix)
+		if !ok {
+			continue
+		}
+
+		if err := app.media.Delete(ctx, key); err != nil {
+			app.logger.Warnw("error deleting media", "key", key, "error", err)
+		}
+	}
+}
+
+func (app *application) mediaHandler(w http.ResponseWriter, r *http.Request) {
+
+	file, err := app.media.Open(r.Context(), chi.URLParam(r, "*"))
+	if err != nil {
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+
+	if _, err := io.Copy(w, file); err != nil {
+		app.logger.Warnw("error serving media", "path", r.URL.Path, "error", err)
+	}
+
+}
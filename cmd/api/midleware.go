@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -12,10 +13,21 @@ import (
 	"github.com/wesleybruno/golang-monolito/internal/store"
 )
 
+func isWebsocketRequest(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
 func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" && isWebsocketRequest(r) {
+			// browsers can't set headers on websockets, the token comes as a subprotocol
+			if token := websocketToken(r); token != "" {
+				authHeader = "Bearer " + token
+			}
+		}
+
 		if authHeader == "" {
 			app.unauthorizedErrorResponse(w, r, fmt.Errorf("authorization header is missing"))
 			return
@@ -48,7 +60,39 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// deleted accounts keep their row when anonymized, their tokens must stop working
+		if !user.IsActive || user.DeletedAt != nil {
+			app.unauthorizedErrorResponse(w, r, errors.New("account is not active"))
+			return
+		}
+
+		if user.PasswordResetRequired {
+			app.unauthorizedErrorResponse(w, r, errors.New("password reset required"))
+			return
+		}
+
 		ctx = context.WithValue(ctx, userCtx, user)
+
+		// impersonation tokens carry the admin behind them in the "act" claim
+		if imp, _ := claims["imp"].(bool); imp {
+			act, _ := claims["act"].(map[string]any)
+
+			impersonatorID, err := strconv.ParseInt(fmt.Sprintf("%.f", act["sub"]), 10, 64)
+			if err != nil {
+				app.unauthorizedErrorResponse(w, r, fmt.Errorf("invalid impersonation token"))
+				return
+			}
+
+			ctx = context.WithValue(ctx, impersonatorCtx, impersonatorID)
+
+			if r.Method != http.MethodGet {
+				app.audit(ctx, impersonatorID, "impersonation.request", &user.ID, map[string]any{
+					"method": r.Method,
+					"path":   r.URL.Path,
+				})
+			}
+		}
+
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -120,9 +164,36 @@ func (app *application) CheckPostOwnership(requiredRole string, next http.Handle
 
 }
 
+// RequireRole only lets through users with at least the level of roleName.
+// Impersonation tokens are never accepted, even when the target qualifies.
+func (app *application) RequireRole(roleName string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			if _, ok := getImpersonatorFromCtx(r); ok {
+				app.forbiddenResponse(w, r)
+				return
+			}
+
+			allowed, err := app.checkRolePrecedence(r.Context(), getUserFromCtx(r), roleName)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+
+			if !allowed {
+				app.forbiddenResponse(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func (app *application) checkRolePrecedence(ctx context.Context, user *store.User, roleName string) (bool, error) {
 
-	role, err := app.store.Role.GetByName(ctx, roleName)
+	role, err := app.getRole(ctx, roleName)
 	if err != nil {
 		return false, err
 	}
@@ -160,6 +231,54 @@ func (app *application) getUser(ctx context.Context, userID int64) (*store.User,
 
 }
 
+func (app *application) getRole(ctx context.Context, name string) (*store.Role, error) {
+
+	if !app.config.cache.enabled {
+		return app.store.Role.GetByName(ctx, name)
+	}
+
+	role, err := app.cache.Roles.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if role == nil {
+		role, err = app.store.Role.GetByName(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := app.cache.Roles.Set(ctx, role); err != nil {
+			return nil, err
+		}
+	}
+
+	return role, nil
+
+}
+
+// invalidateRoles drops cached roles after they're renamed, changed or deleted.
+func (app *application) invalidateRoles(ctx context.Context, names ...string) {
+	if !app.config.cache.enabled {
+		return
+	}
+
+	for _, name := range names {
+		app.cache.Roles.Delete(ctx, name)
+	}
+}
+
+// invalidateUsers drops cached users whose data changed, e.g. follow counts.
+func (app *application) invalidateUsers(ctx context.Context, userIDs ...int64) {
+	if !app.config.cache.enabled {
+		return
+	}
+
+	for _, id := range userIDs {
+		app.cache.Users.Delete(ctx, id)
+	}
+}
+
 func (app *application) RateLimiterMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if app.config.rateLimiter.Enabled {
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wesleybruno/golang-monolito/internal/auth"
+	"github.com/wesleybruno/golang-monolito/internal/mailer"
+	"github.com/wesleybruno/golang-monolito/internal/store"
+)
+
+// unsubscribeDigest is the unsubscribe scope turning off every kind of
+// notification delivered in the digest, the other scopes being a single kind.
+const unsubscribeDigest = "digest"
+
+// emailNotification sends notification to userID right away when they want
+// that kind of notification by email.
+func (app *application) emailNotification(ctx context.Context, userID int64, notification *store.Notification) {
+	delivery, err := app.store.Notifications.GetDelivery(ctx, userID, notification.ID)
+	if err != nil {
+		app.logger.Errorw("error fetching notification delivery", "id", notification.ID, "error", err)
+		return
+	}
+
+	if delivery != store.DeliveryInstant {
+		return
+	}
+
+	user, err := app.store.Users.GetById(ctx, userID)
+	if err != nil {
+		app.logger.Errorw("error fetching notified user", "user", userID, "error", err)
+		return
+	}
+
+	unsubscribeURL := app.unsubscribeURL(userID, notification.Kind)
+
+	vars := struct {
+		Username         string
+		Summary          string
+		NotificationsURL string
+		UnsubscribeURL   string
+	}{
+		Username:         user.Username,
+		Summary:          notification.Summary,
+		NotificationsURL: app.config.frontendURL + "/notifications",
+		UnsubscribeURL:   unsubscribeURL,
+	}
+
+	isProdEnv := app.config.env == "production"
+	if _, err := app.mailer.SendWithHeaders(mailer.NotificationTemplate, user.Username, user.Email, vars, unsubscribeHeaders(unsubscribeURL), !isProdEnv); err != nil {
+		app.logger.Errorw("error sending notification email", "id", notification.ID, "error", err)
+		return
+	}
+
+	if err := app.store.Notifications.MarkEmailed(ctx, userID, []int64{notification.ID}, false); err != nil {
+		app.logger.Errorw("error marking notification emailed", "id", notification.ID, "error", err)
+	}
+}
+
+// sendDigests emails every user whose digest is due the notifications they
+// haven't read yet, in a single email.
+func (app *application) sendDigests(ctx context.Context) error {
+	for {
+		ids, err := app.store.Notifications.GetDueDigests(ctx, time.Now().Add(-app.config.notifications.digestInterval), 100)
+		if err != nil {
+			return err
+		}
+
+		if len(ids) == 0 {
+			return nil
+		}
+
+		for _, id := range ids {
+			if err := app.sendDigest(ctx, id); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (app *application) sendDigest(ctx context.Context, userID int64) error {
+	notifications, err := app.store.Notifications.GetDigest(ctx, userID, app.config.notifications.digestSize)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]int64, len(notifications))
+	for i, n := range notifications {
+		ids[i] = n.ID
+	}
+
+	// the notifications left may all come from blocked users
+	if len(notifications) == 0 {
+		return app.store.Notifications.MarkEmailed(ctx, userID, ids, true)
+	}
+
+	user, err := app.store.Users.GetById(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	unsubscribeURL := app.unsubscribeURL(userID, unsubscribeDigest)
+
+	vars := struct {
+		Username         string
+		Notifications    []*store.Notification
+		NotificationsURL string
+		UnsubscribeURL   string
+	}{
+		Username:         user.Username,
+		Notifications:    notifications,
+		NotificationsURL: app.config.frontendURL + "/notifications",
+		UnsubscribeURL:   unsubscribeURL,
+	}
+
+	isProdEnv := app.config.env == "production"
+	if _, err := app.mailer.SendWithHeaders(mailer.DigestTemplate, user.Username, user.Email, vars, unsubscribeHeaders(unsubscribeURL), !isProdEnv); err != nil {
+		// a failing address shouldn't hold the other digests back
+		app.logger.Errorw("error sending notification digest", "user", userID, "error", err)
+	}
+
+	return app.store.Notifications.MarkEmailed(ctx, userID, ids, true)
+}
+
+// unsubscribeURL returns the signed link turning off the emails of scope for
+// userID without logging in.
+func (app *application) unsubscribeURL(userID int64, scope string) string {
+	id := strconv.FormatInt(userID, 10)
+	signature := auth.Sign(app.config.auth.token.secret, unsubscribeSignatureMessage(id, scope))
+
+	return app.externalURL(fmt.Sprintf("/v1/notifications/unsubscribe?user=%s&scope=%s&signature=%s", id, scope, signature))
+}
+
+func unsubscribeSignatureMessage(userID, scope string) string {
+	return "unsubscribe:" + userID + ":" + scope
+}
+
+// unsubscribeHeaders let mail clients offer one-click unsubscribe (RFC 8058).
+func unsubscribeHeaders(url string) map[string]string {
+	return map[string]string{
+		"List-Unsubscribe":      "<" + url + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+}
+
+// unsubscribePage asks before unsubscribing: mail scanners follow the links
+// in emails, so opening one must not change anything.
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!doctype html>
+<html>
+  <body>
+    <form method="post" action="{{.}}">
+      <p>Stop getting these emails?</p>
+      <button type="submit">Unsubscribe</button>
+    </form>
+  </body>
+</html>`))
+
+// ConfirmUnsubscribe godoc
+//
+//	@Summary		Confirms unsubscribing from notification emails
+//	@Description	Renders the page behind the signed link sent by email, asking to confirm before anything changes
+//	@Tags			notifications
+//	@Produce		html
+//	@Param			user		query		int		true	"User ID"
+//	@Param			scope		query		string	true	"Notification kind, or digest"
+//	@Param			signature	query		string	true	"Link signature"
+//	@Success		200			{string}	string
+//	@Failure		403			{object}	error
+//	@Failure		500			{object}	error
+//	@Router			/notifications/unsubscribe [get]
+func (app *application) confirmUnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+
+	if _, _, ok := app.readUnsubscribeLink(w, r); !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := unsubscribePage.Execute(w, r.URL.RequestURI()); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// Unsubscribe godoc
+//
+//	@Summary		Unsubscribes from notification emails
+//	@Description	Turns off the emails of a kind of notification, or the digest, through the signed link sent by email. Also serves one-click unsubscribe (RFC 8058)
+//	@Tags			notifications
+//	@Produce		json
+//	@Param			user		query		int		true	"User ID"
+//	@Param			scope		query		string	true	"Notification kind, or digest"
+//	@Param			signature	query		string	true	"Link signature"
+//	@Success		200			{object}	store.NotificationPreferences
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Router			/notifications/unsubscribe [post]
+func (app *application) unsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+
+	id, scope, ok := app.readUnsubscribeLink(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	prefs, err := app.store.Notifications.GetPreferences(ctx, id)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	changes := store.NotificationPreferences{}
+	for kind, delivery := range prefs {
+		if kind == scope || (scope == unsubscribeDigest && delivery == store.DeliveryDigest) {
+			changes[kind] = store.DeliveryOff
+		}
+	}
+
+	if err := app.store.Notifications.SetPreferences(ctx, id, changes); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	for kind, delivery := range changes {
+		prefs[kind] = delivery
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, prefs); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// readUnsubscribeLink checks the signature of an unsubscribe link, writing
+// the error response when it doesn't hold.
+func (app *application) readUnsubscribeLink(w http.ResponseWriter, r *http.Request) (int64, string, bool) {
+	userID := r.URL.Query().Get("user")
+	scope := r.URL.Query().Get("scope")
+	signature := r.URL.Query().Get("signature")
+
+	if !auth.VerifySignature(app.config.auth.token.secret, unsubscribeSignatureMessage(userID, scope), signature) {
+		app.forbiddenResponse(w, r)
+		return 0, "", false
+	}
+
+	id, err := strconv.ParseInt(userID, 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return 0, "", false
+	}
+
+	return id, scope, true
+}
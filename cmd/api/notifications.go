@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/wesleybruno/golang-monolito/internal/store"
+)
+
+// maxMentions caps how many users a single post or comment can notify.
+const maxMentions = 10
+
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@(\w{1,100})`)
+
+// parseMentions returns the distinct usernames mentioned in content, in order.
+func parseMentions(content string) []string {
+	var usernames []string
+	seen := map[string]bool{}
+
+	for _, m := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		username := strings.ToLower(m[1])
+		if seen[username] {
+			continue
+		}
+
+		seen[username] = true
+		usernames = append(usernames, username)
+		if len(usernames) == maxMentions {
+			break
+		}
+	}
+
+	return usernames
+}
+
+// notifyMentions notifies the users mentioned in a post, or in one of its
+// comments, who can see the post.
+func (app *application) notifyMentions(actorId int64, postId int64, commentId *int64, content string) {
+	usernames := parseMentions(content)
+	if len(usernames) == 0 {
+		return
+	}
+
+	app.background(func() {
+		ids, err := app.store.Notifications.ResolveMentions(context.Background(), actorId, postId, usernames)
+		if err != nil {
+			app.logger.Errorw("error resolving mentions", "post", postId, "error", err)
+			return
+		}
+
+		for _, id := range ids {
+			app.notify(store.NewNotification{
+				UserID:    id,
+				ActorID:   actorId,
+				Kind:      store.NotificationMention,
+				PostID:    &postId,
+				CommentID: commentId,
+			})
+		}
+	})
+}
+
+type notificationsPage struct {
+	Notifications []*store.Notification `json:"notifications"`
+	UnreadCount   int64                 `json:"unread_count"`
+}
+
+type unreadCount struct {
+	UnreadCount int64 `json:"unread_count"`
+}
+
+// GetNotifications godoc
+//
+//	@Summary		Lists my notifications
+//	@Description	Lists the caller's notifications, most recently updated first. Notifications of the same kind about the same thing are grouped while unread
+//	@Tags			notifications
+//	@Accept			json
+//	@Produce		json
+//	@Param			unread	query		bool	false	"Only unread notifications"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			since	query		string	false	"Oldest updated_at, RFC 3339 or relative to now like -24h"
+//	@Param			until	query		string	false	"Newest updated_at (exclusive), RFC 3339 or relative to now like -1h"
+//	@Param			cursor	query		string	false	"Cursor returned by the previous page"
+//	@Success		200		{object}	notificationsPage
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/notifications [get]
+func (app *application) getNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+
+	nq := store.NotificationQuery{
+		PaginationCursorQuery: store.PaginationCursorQuery{
+			Limit: 20,
+		},
+	}
+
+	nq, err := nq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(nq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+
+	notifications, next, err := app.store.Notifications.List(r.Context(), user.ID, nq)
+	if err != nil {
+		switch err {
+		case store.ErrInvalidCursor:
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	count, err := app.store.Notifications.UnreadCount(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var cursors pageCursors
+	if next != nil {
+		cursors.Next = next.Encode()
+	}
+
+	page := notificationsPage{Notifications: notifications, UnreadCount: count}
+	if err := app.paginatedJsonResponse(w, http.StatusOK, page, cursors); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// GetUnreadNotificationCount godoc
+//
+//	@Summary		Counts my unread notifications
+//	@Description	Counts the caller's unread notifications, a group counting once
+//	@Tags			notifications
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	unreadCount
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/unread-count [get]
+func (app *application) getUnreadNotificationCountHandler(w http.ResponseWriter, r *http.Request) {
+
+	user := getUserFromCtx(r)
+
+	count, err := app.store.Notifications.UnreadCount(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, unreadCount{UnreadCount: count}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// MarkNotificationRead godoc
+//
+//	@Summary		Marks a notification as read
+//	@Description	Marks one of the caller's notifications as read. Later events start a new group
+//	@Tags			notifications
+//	@Accept			json
+//	@Produce		json
+//	@Param			notificationId	path		int		true	"Notification ID"
+//	@Success		204				{string}	string	"Notification read"
+//	@Failure		400				{object}	error
+//	@Failure		404				{object}	error
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/{notificationId}/read [put]
+func (app *application) markNotificationReadHandler(w http.ResponseWriter, r *http.Request) {
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "notificationId"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+
+	if err := app.store.Notifications.MarkRead(r.Context(), user.ID, id); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponseNoData(w, http.StatusNoContent); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// MarkAllNotificationsRead godoc
+//
+//	@Summary		Marks all my notifications as read
+//	@Description	Marks every unread notification of the caller as read
+//	@Tags			notifications
+//	@Accept			json
+//	@Produce		json
+//	@Success		204	{string}	string	"Notifications read"
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/read [put]
+func (app *application) markAllNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+
+	user := getUserFromCtx(r)
+
+	if _, err := app.store.Notifications.MarkAllRead(r.Context(), user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponseNoData(w, http.StatusNoContent); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+type UpdateNotificationPreferencesPayload struct {
+	// Preferences maps kinds of notification to instant, digest or off
+	Preferences store.NotificationPreferences `json:"preferences" validate:"required,min=1,dive,oneof=instant digest off"`
+}
+
+// GetNotificationPreferences godoc
+//
+//	@Summary		Fetches my notification email preferences
+//	@Description	Lists how each kind of notification is emailed to the caller: instant, in the daily digest or off
+//	@Tags			notifications
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	store.NotificationPreferences
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/preferences [get]
+func (app *application) getNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+
+	user := getUserFromCtx(r)
+
+	prefs, err := app.store.Notifications.GetPreferences(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, prefs); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// UpdateNotificationPreferences godoc
+//
+//	@Summary		Updates my notification email preferences
+//	@Description	Changes how the given kinds of notification are emailed to the caller, leaving the others as they are
+//	@Tags			notifications
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		UpdateNotificationPreferencesPayload	true	"Preferences payload"
+//	@Success		200		{object}	store.NotificationPreferences
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/preferences [put]
+func (app *application) updateNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+
+	var payload UpdateNotificationPreferencesPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+
+	if err := app.store.Notifications.SetPreferences(r.Context(), user.ID, payload.Preferences); err != nil {
+		switch err {
+		case store.ErrUnknownNotificationKind:
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	prefs, err := app.store.Notifications.GetPreferences(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, prefs); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
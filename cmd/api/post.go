@@ -8,6 +8,7 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/wesleybruno/golang-monolito/internal/store"
+	"github.com/wesleybruno/golang-monolito/internal/webhooks"
 )
 
 type postKey string
@@ -15,9 +16,10 @@ type postKey string
 const postCtx postKey = "post"
 
 type CreatePostPayload struct {
-	Title   string   `json:"title" validate:"required,max=100"`
-	Content string   `json:"content" validate:"required,max=1000"`
-	Tags    []string `json:"tags"`
+	Title    string   `json:"title" validate:"required,max=100"`
+	Content  string   `json:"content" validate:"required,max=1000"`
+	Tags     []string `json:"tags"`
+	Language string   `json:"language" validate:"omitempty,oneof=simple english portuguese spanish french german italian"`
 }
 
 // CreatePost godoc
@@ -52,10 +54,11 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 	userId := user.ID
 
 	post := &store.Post{
-		Title:   payload.Title,
-		UserId:  int64(userId),
-		Content: payload.Content,
-		Tags:    payload.Tags,
+		Title:    payload.Title,
+		UserId:   int64(userId),
+		Content:  payload.Content,
+		Tags:     payload.Tags,
+		Language: payload.Language,
 	}
 
 	ctx := r.Context()
@@ -64,6 +67,44 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	app.background(func() {
+		ctx := context.Background()
+
+		// celebrities have too many followers to list on every post, their
+		// readers merge the posts in when the feed is loaded, and only the
+		// followers with a stream open get it live
+		if user.FollowersCount >= app.config.feed.celebrityThreshold {
+			app.fanOutPost(ctx, post, user, nil)
+
+			online, err := app.events.Online(ctx)
+			if err != nil {
+				app.logger.Errorw("error listing online users", "error", err)
+				return
+			}
+
+			audience, err := app.store.Posts.FilterAudienceIDs(ctx, post.ID, online)
+			if err != nil {
+				app.logger.Errorw("error listing the audience of a post", "post", post.ID, "error", err)
+				return
+			}
+
+			app.publishPost(ctx, post, user, audience)
+			return
+		}
+
+		audience, err := app.store.Posts.GetAudienceIDs(ctx, post.ID)
+		if err != nil {
+			app.logger.Errorw("error listing the audience of a post", "post", post.ID, "error", err)
+			return
+		}
+
+		app.fanOutPost(ctx, post, user, audience)
+		app.publishPost(ctx, post, user, audience)
+	})
+
+	app.notifyMentions(user.ID, post.ID, nil, post.Content)
+	app.emitWebhook(user.ID, webhooks.EventPostCreated, post)
+
 	if err := app.jsonResponse(w, http.StatusCreated, post); err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -87,8 +128,9 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 
 	post := getPostFromCtx(r)
+	user := getUserFromCtx(r)
 
-	commnets, err := app.store.Comments.GetByPostId(r.Context(), post.ID)
+	commnets, err := app.store.Comments.GetByPostId(r.Context(), post.ID, user.ID)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -212,8 +254,9 @@ func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 		}
 
 		ctx := r.Context()
+		user := getUserFromCtx(r)
 
-		post, err := app.store.Posts.GetByID(ctx, id)
+		post, err := app.store.Posts.GetByID(ctx, id, user.ID)
 		if err != nil {
 			switch {
 			case errors.Is(err, store.ErrNotFound):
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/wesleybruno/golang-monolito/internal/mailer"
+	"github.com/wesleybruno/golang-monolito/internal/store"
+)
+
+type UpdateProfilePayload struct {
+	Username    *string `json:"username" validate:"omitempty,min=1,max=100"`
+	DisplayName *string `json:"display_name" validate:"omitempty,max=100"`
+	Bio         *string `json:"bio" validate:"omitempty,max=500"`
+	Email       *string `json:"email" validate:"omitempty,email,max=255"`
+}
+
+// UpdateProfile godoc
+//
+//	@Summary		Updates my profile
+//	@Description	Updates the authenticated user's profile. A new email is only applied once confirmed through the link sent to it
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		UpdateProfilePayload	true	"Profile payload"
+//	@Success		200		{object}	store.User
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/user/me [patch]
+func (app *application) updateProfileHandler(w http.ResponseWriter, r *http.Request) {
+
+	var payload UpdateProfilePayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	ctx := r.Context()
+
+	if payload.Username != nil {
+		user.Username = *payload.Username
+	}
+	if payload.DisplayName != nil {
+		user.DisplayName = *payload.DisplayName
+	}
+	if payload.Bio != nil {
+		user.Bio = *payload.Bio
+	}
+
+	if err := app.store.Users.UpdateProfile(ctx, user); err != nil {
+		switch err {
+		case store.ErrDuplicateUsername:
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.invalidateUsers(ctx, user.ID)
+
+	if payload.Email != nil && *payload.Email != user.Email {
+		if err := app.requestEmailChange(ctx, user, *payload.Email); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// requestEmailChange sends a confirmation link to the new address and lets
+// the current one know about the change.
+func (app *application) requestEmailChange(ctx context.Context, user *store.User, newEmail string) error {
+
+	plainToken := uuid.New().String()
+
+	// hash the token for storage but keep the plain token for email
+	hash := sha256.Sum256([]byte(plainToken))
+	hashToken := hex.EncodeToString(hash[:])
+
+	if err := app.store.Users.CreateEmailChange(ctx, user.ID, newEmail, hashToken, app.config.mail.exp); err != nil {
+		return err
+	}
+
+	isProdEnv := app.config.env == "production"
+
+	confirmVars := struct {
+		Username        string
+		ConfirmationURL string
+	}{
+		Username:        user.Username,
+		ConfirmationURL: fmt.Sprintf("%s/confirm-email/%s", app.config.frontendURL, plainToken),
+	}
+
+	if _, err := app.mailer.Send(mailer.EmailChangeTemplate, user.Username, newEmail, confirmVars, !isProdEnv); err != nil {
+		return err
+	}
+
+	noticeVars := struct {
+		Username string
+		NewEmail string
+	}{
+		Username: user.Username,
+		NewEmail: newEmail,
+	}
+
+	if _, err := app.mailer.Send(mailer.EmailChangeNoticeTemplate, user.Username, user.Email, noticeVars, !isProdEnv); err != nil {
+		app.logger.Errorw("error sending email change notice", "error", err)
+	}
+
+	return nil
+}
+
+// ConfirmEmailChange godoc
+//
+//	@Summary		Confirms an email change
+//	@Description	Applies the email change the token was sent for
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			token	path		string	true	"Email change token"
+//	@Success		204		{string}	string	"Email changed"
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/user/email/confirm/{token} [put]
+func (app *application) confirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+
+	token := chi.URLParam(r, "token")
+
+	user, err := app.store.Users.ConfirmEmailChange(r.Context(), token)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.badRequestResponse(w, r, err)
+		case store.ErrDuplicateEmail:
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.invalidateUsers(r.Context(), user.ID)
+
+	if err := app.jsonResponseNoData(w, http.StatusNoContent); err != nil {
+		app.internalServerError(w, r, err)
+	}
+
+}
+
+type ChangePasswordPayload struct {
+	CurrentPassword string `json:"current_password" validate:"required,max=72"`
+	NewPassword     string `json:"new_password" validate:"required,min=3,max=72"`
+}
+
+// ChangePassword godoc
+//
+//	@Summary		Changes my password
+//	@Description	Changes the authenticated user's password, the current password is required
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ChangePasswordPayload	true	"Password payload"
+//	@Success		204		{string}	string					"Password changed"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/user/me/password [put]
+func (app *application) changePasswordHandler(w http.ResponseWriter, r *http.Request) {
+
+	var payload ChangePasswordPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	ctx := r.Context()
+
+	// the cached user carries no password hash, always check against the database
+	current, err := app.store.Users.GetById(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if !current.Password.Matches(payload.CurrentPassword) {
+		app.unauthorizedErrorResponse(w, r, errors.New("invalid password"))
+		return
+	}
+
+	if err := current.Password.Set(payload.NewPassword); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.Users.UpdatePassword(ctx, current); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.invalidateUsers(ctx, user.ID)
+
+	if err := app.jsonResponseNoData(w, http.StatusNoContent); err != nil {
+		app.internalServerError(w, r, err)
+	}
+
+}
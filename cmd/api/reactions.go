@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/wesleybruno/golang-monolito/internal/store"
+	"github.com/wesleybruno/golang-monolito/internal/webhooks"
+)
+
+type ReactPayload struct {
+	Kind string `json:"kind" validate:"required,oneof=like love laugh wow sad angry"`
+}
+
+// ReactToPost godoc
+//
+//	@Summary		Reacts to a post
+//	@Description	Sets the caller's reaction to a post, replacing any previous one
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			postId	path		int				true	"Post ID"
+//	@Param			payload	body		ReactPayload	true	"Reaction payload"
+//	@Success		200		{object}	store.Reaction
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/post/{postId}/reactions [put]
+func (app *application) reactToPostHandler(w http.ResponseWriter, r *http.Request) {
+
+	var payload ReactPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	post := getPostFromCtx(r)
+	user := getUserFromCtx(r)
+
+	reaction := &store.Reaction{
+		PostId: post.ID,
+		UserId: user.ID,
+		Kind:   payload.Kind,
+	}
+
+	if err := app.store.Reactions.React(r.Context(), reaction); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.notify(store.NewNotification{UserID: post.UserId, ActorID: user.ID, Kind: store.NotificationReaction, PostID: &post.ID})
+	app.emitWebhook(post.UserId, webhooks.EventReactionCreated, reaction)
+
+	if err := app.jsonResponse(w, http.StatusOK, reaction); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// RemoveReaction godoc
+//
+//	@Summary		Removes my reaction to a post
+//	@Description	Removes the caller's reaction to a post
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			postId	path		int		true	"Post ID"
+//	@Success		204		{string}	string	"Reaction removed"
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/post/{postId}/reactions [delete]
+func (app *application) removeReactionHandler(w http.ResponseWriter, r *http.Request) {
+
+	post := getPostFromCtx(r)
+	user := getUserFromCtx(r)
+
+	if err := app.store.Reactions.Unreact(r.Context(), post.ID, user.ID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponseNoData(w, http.StatusNoContent); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/wesleybruno/golang-monolito/internal/store"
+)
+
+type roleKey string
+
+const roleCtx roleKey = "role"
+
+var errBuiltinRole = errors.New("built-in roles can't be renamed, moved to another level or deleted")
+
+type CreateRolePayload struct {
+	Name        string `json:"name" validate:"required,max=255"`
+	Description string `json:"description" validate:"max=1000"`
+	Level       int    `json:"level" validate:"gte=0"`
+}
+
+type UpdateRolePayload struct {
+	Name        *string `json:"name" validate:"omitempty,min=1,max=255"`
+	Description *string `json:"description" validate:"omitempty,max=1000"`
+	Level       *int    `json:"level" validate:"omitempty,gte=0"`
+}
+
+// GetRoles godoc
+//
+//	@Summary		Lists roles
+//	@Description	Lists every role by level. Restricted to admins
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	[]store.Role
+//	@Failure		403	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/roles [get]
+func (app *application) getRolesHandler(w http.ResponseWriter, r *http.Request) {
+
+	roles, err := app.store.Role.List(r.Context())
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, roles); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// GetRole godoc
+//
+//	@Summary		Fetches a role
+//	@Description	Fetches a role by ID. Restricted to admins
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			roleId	path		int	true	"Role ID"
+//	@Success		200		{object}	store.Role
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/roles/{roleId} [get]
+func (app *application) getRoleHandler(w http.ResponseWriter, r *http.Request) {
+
+	if err := app.jsonResponse(w, http.StatusOK, getRoleFromCtx(r)); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// CreateRole godoc
+//
+//	@Summary		Creates a role
+//	@Description	Creates a role. Its level must be below the admin's own. Restricted to admins
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateRolePayload	true	"Role payload"
+//	@Success		201		{object}	store.Role
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/roles [post]
+func (app *application) createRoleHandler(w http.ResponseWriter, r *http.Request) {
+
+	var payload CreateRolePayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// a role at the caller's level would grant what only they can grant
+	admin := getUserFromCtx(r)
+	if payload.Level >= admin.Role.Level {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	role := &store.Role{
+		Name:        payload.Name,
+		Description: payload.Description,
+		Level:       payload.Level,
+	}
+
+	ctx := r.Context()
+
+	if err := app.store.Role.Create(ctx, role); err != nil {
+		switch err {
+		case store.ErrDuplicateKey:
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(ctx, admin.ID, "role.created", nil, map[string]any{"role_id": role.ID, "name": role.Name, "level": role.Level})
+
+	if err := app.jsonResponse(w, http.StatusCreated, role); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// UpdateRole godoc
+//
+//	@Summary		Updates a role
+//	@Description	Updates a role. Built-in roles keep their name and level, other roles stay below the caller's level. Restricted to admins
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			roleId	path		int					true	"Role ID"
+//	@Param			payload	body		UpdateRolePayload	true	"Role payload"
+//	@Success		200		{object}	store.Role
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/roles/{roleId} [patch]
+func (app *application) updateRoleHandler(w http.ResponseWriter, r *http.Request) {
+
+	var payload UpdateRolePayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	admin := getUserFromCtx(r)
+	role := getRoleFromCtx(r)
+	oldName := role.Name
+
+	if payload.Name != nil && *payload.Name != role.Name {
+		if store.BuiltinRoles[role.Name] {
+			app.badRequestResponse(w, r, errBuiltinRole)
+			return
+		}
+		role.Name = *payload.Name
+	}
+	if payload.Description != nil {
+		role.Description = *payload.Description
+	}
+	if payload.Level != nil && *payload.Level != role.Level {
+		// the middlewares compare levels, moving a built-in role would
+		// hand out or take away admin rights wholesale
+		if store.BuiltinRoles[role.Name] {
+			app.badRequestResponse(w, r, errBuiltinRole)
+			return
+		}
+		if role.Level >= admin.Role.Level || *payload.Level >= admin.Role.Level {
+			app.forbiddenResponse(w, r)
+			return
+		}
+		role.Level = *payload.Level
+	}
+
+	ctx := r.Context()
+
+	if err := app.store.Role.Update(ctx, role); err != nil {
+		switch err {
+		case store.ErrDuplicateKey:
+			app.conflictResponse(w, r, err)
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.invalidateRoles(ctx, oldName, role.Name)
+
+	// cached users carry their role, holders would keep the old one
+	if app.config.cache.enabled {
+		holders, err := app.store.Role.GetHolderIDs(ctx, role.ID)
+		if err != nil {
+			app.logger.Errorw("error listing the holders of a role", "role", role.ID, "error", err)
+		}
+		app.invalidateUsers(ctx, holders...)
+	}
+
+	app.audit(ctx, admin.ID, "role.updated", nil, map[string]any{"role_id": role.ID, "name": role.Name, "level": role.Level})
+
+	if err := app.jsonResponse(w, http.StatusOK, role); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// DeleteRole godoc
+//
+//	@Summary		Deletes a role
+//	@Description	Deletes a role no user has. Built-in roles can't be deleted. Restricted to admins
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			roleId	path		int		true	"Role ID"
+//	@Success		204		{string}	string	"Role deleted"
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/roles/{roleId} [delete]
+func (app *application) deleteRoleHandler(w http.ResponseWriter, r *http.Request) {
+
+	role := getRoleFromCtx(r)
+
+	if store.BuiltinRoles[role.Name] {
+		app.badRequestResponse(w, r, errBuiltinRole)
+		return
+	}
+
+	ctx := r.Context()
+
+	if err := app.store.Role.Delete(ctx, role.ID); err != nil {
+		switch err {
+		case store.ErrRoleInUse:
+			app.conflictResponse(w, r, err)
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.invalidateRoles(ctx, role.Name)
+	app.audit(ctx, getUserFromCtx(r).ID, "role.deleted", nil, map[string]any{"role_id": role.ID, "name": role.Name})
+
+	if err := app.jsonResponseNoData(w, http.StatusNoContent); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+func (app *application) rolesContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "roleId"), 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+
+		role, err := app.store.Role.GetByID(ctx, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, roleCtx, role)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getRoleFromCtx(r *http.Request) *store.Role {
+	role, _ := r.Context().Value(roleCtx).(*store.Role)
+	return role
+}
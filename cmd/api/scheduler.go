@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/wesleybruno/golang-monolito/internal/scheduler"
+	"github.com/wesleybruno/golang-monolito/internal/store"
+)
+
+// scheduleJobs registers the periodic maintenance jobs. Every instance
+// schedules them, each run happens on one of them.
+func (app *application) scheduleJobs() error {
+	jobs := []struct {
+		name     string
+		schedule string
+		timeout  time.Duration
+		fn       scheduler.Func
+	}{
+		{"purge-deleted-accounts", "0 * * * *", time.Minute * 30, app.purgeDeletedAccounts},
+		{"send-notification-digests", "15 * * * *", time.Minute * 30, app.sendDigests},
+		{"expire-data-exports", "30 * * * *", time.Minute * 10, app.expireDataExports},
+		{"purge-expired-tokens", "30 3 * * *", time.Minute * 10, app.purgeExpiredTokens},
+		{"recompute-follow-counts", "0 4 * * *", time.Minute * 30, app.recomputeFollowCounts},
+	}
+
+	for _, job := range jobs {
+		if err := app.scheduler.Register(job.name, job.schedule, job.timeout, job.fn); err != nil {
+			return err
+		}
+	}
+
+	if app.config.cache.enabled {
+		return app.scheduler.Register("refresh-explore", app.config.explore.refreshSchedule, time.Minute*5, app.refreshExplore)
+	}
+
+	return nil
+}
+
+// runScheduler runs the scheduled jobs until the server shuts down.
+func (app *application) runScheduler() {
+	app.background(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-app.done
+			cancel()
+		}()
+
+		app.scheduler.Run(ctx)
+	})
+}
+
+type scheduledJob struct {
+	scheduler.Job
+	LastRun *store.ScheduledRun `json:"last_run"`
+}
+
+// GetScheduledJobs godoc
+//
+//	@Summary		Lists the scheduled jobs
+//	@Description	Lists the periodic maintenance jobs with their cron schedule, next run and latest run. Restricted to admins
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	[]scheduledJob
+//	@Failure		403	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/scheduler/jobs [get]
+func (app *application) getScheduledJobsHandler(w http.ResponseWriter, r *http.Request) {
+
+	lastRuns, err := app.store.Scheduler.LastRuns(r.Context())
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	jobs := []scheduledJob{}
+	for _, job := range app.scheduler.Jobs() {
+		jobs = append(jobs, scheduledJob{Job: job, LastRun: lastRuns[job.Name]})
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, jobs); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// TriggerScheduledJob godoc
+//
+//	@Summary		Runs a scheduled job now
+//	@Description	Starts a run of a scheduled job out of its schedule. The run continues in the background, its outcome shows up in the run history. Restricted to admins
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			name	path		string	true	"Job name"
+//	@Success		202		{object}	store.ScheduledRun
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error	"Job not found"
+//	@Failure		409		{object}	error	"Job already running"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/scheduler/jobs/{name}/run [post]
+func (app *application) triggerScheduledJobHandler(w http.ResponseWriter, r *http.Request) {
+
+	name := chi.URLParam(r, "name")
+	admin := getUserFromCtx(r)
+	ctx := r.Context()
+
+	run, err := app.scheduler.Trigger(ctx, name, admin.ID)
+	if err != nil {
+		switch err {
+		case scheduler.ErrUnknownJob:
+			app.notFoundResponse(w, r, err)
+		case scheduler.ErrJobRunning:
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(ctx, admin.ID, "scheduler.job_triggered", nil, map[string]any{"job": name, "run_id": run.ID})
+
+	if err := app.jsonResponse(w, http.StatusAccepted, run); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// GetScheduledRuns godoc
+//
+//	@Summary		Lists the run history of scheduled jobs
+//	@Description	Lists the runs of scheduled jobs with their duration and error, most recent first. Restricted to admins
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			name	query		string	false	"Job name"
+//	@Param			status	query		string	false	"Status: running, succeeded or failed"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			since	query		string	false	"Oldest started_at, RFC 3339 or relative to now like -24h"
+//	@Param			until	query		string	false	"Newest started_at (exclusive), RFC 3339 or relative to now like -1h"
+//	@Param			cursor	query		string	false	"Cursor returned by the previous page"
+//	@Success		200		{object}	[]store.ScheduledRun
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/scheduler/runs [get]
+func (app *application) getScheduledRunsHandler(w http.ResponseWriter, r *http.Request) {
+
+	rq := store.ScheduledRunQuery{
+		PaginationCursorQuery: store.PaginationCursorQuery{
+			Limit: 20,
+		},
+	}
+
+	rq, err := rq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(rq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	runs, next, err := app.store.Scheduler.ListRuns(r.Context(), rq)
+	if err != nil {
+		switch err {
+		case store.ErrInvalidCursor:
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	var cursors pageCursors
+	if next != nil {
+		cursors.Next = next.Encode()
+	}
+
+	if err := app.paginatedJsonResponse(w, http.StatusOK, runs, cursors); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
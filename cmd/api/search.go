@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/wesleybruno/golang-monolito/internal/store"
+)
+
+// SearchPosts godoc
+//
+//	@Summary		Searches posts
+//	@Description	Full-text search over the posts the caller can see. Supports "quoted phrases", or and -negation, ranks by relevance and highlights matches with <mark> tags
+//	@Tags			search
+//	@Accept			json
+//	@Produce		json
+//	@Param			q			query		string	true	"Search text"
+//	@Param			lang		query		string	false	"Text search language, defaults to english"
+//	@Param			author_id	query		int		false	"Only posts by this user"
+//	@Param			tags		query		string	false	"Comma separated tags every post must have"
+//	@Param			since		query		string	false	"Oldest created_at, RFC 3339 or relative to now like -24h"
+//	@Param			until		query		string	false	"Newest created_at (exclusive), RFC 3339 or relative to now like -1h"
+//	@Param			limit		query		int		false	"Limit"
+//	@Param			offset		query		int		false	"Offset"
+//	@Success		200			{object}	[]store.PostSearchResult
+//	@Failure		400			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/search/posts [get]
+func (app *application) searchPostsHandler(w http.ResponseWriter, r *http.Request) {
+
+	sq := store.PostSearchQuery{
+		Language: "english",
+		Limit:    20,
+		Offset:   0,
+	}
+
+	sq, err := sq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(sq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	viewer := getUserFromCtx(r)
+
+	results, err := app.store.Posts.SearchPosts(r.Context(), viewer.ID, sq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, results); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
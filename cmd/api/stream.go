@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/wesleybruno/golang-monolito/internal/events"
+)
+
+// FeedStream godoc
+//
+//	@Summary		Streams feed updates
+//	@Description	Server-Sent Events stream of the new posts in the caller's feed ("post" events) and of their notifications ("notification" events). Reconnecting with the Last-Event-ID header, or the last_event_id parameter, replays the events missed meanwhile
+//	@Tags			feed
+//	@Produce		text/event-stream
+//	@Param			Last-Event-ID	header		string	false	"Id of the last event received"
+//	@Param			last_event_id	query		string	false	"Id of the last event received, for clients unable to set headers"
+//	@Success		200				{string}	string	"Event stream"
+//	@Failure		400				{object}	error
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/user/feed/stream [get]
+func (app *application) feedStreamHandler(w http.ResponseWriter, r *http.Request) {
+
+	rc := http.NewResponseController(w)
+
+	// the stream outlives the read and write timeouts of the server
+	if err := rc.SetReadDeadline(time.Time{}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	ctx := r.Context()
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+
+	// subscribe before catching up so nothing published in between is lost
+	sub, err := app.events.Subscribe(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	defer sub.Close()
+
+	var missed []events.Event
+	if lastID != "" {
+		missed, err = app.events.Since(ctx, user.ID, lastID)
+		if err != nil {
+			switch err {
+			case events.ErrInvalidID:
+				app.badRequestResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", app.config.stream.retry.Milliseconds())
+
+	for _, ev := range missed {
+		writeEvent(w, ev)
+		lastID = ev.ID
+	}
+
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(app.config.stream.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-app.closing:
+			return
+		case ev, ok := <-sub.C:
+			if !ok {
+				// too far behind, the client reconnects and catches up
+				return
+			}
+			if lastID != "" && events.CompareIDs(ev.ID, lastID) <= 0 {
+				continue
+			}
+			writeEvent(w, ev)
+			lastID = ev.ID
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+
+}
+
+func writeEvent(w http.ResponseWriter, ev events.Event) {
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, ev.Data)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/wesleybruno/golang-monolito/internal/store"
+)
+
+// FollowTag godoc
+//
+//	@Summary		Follows a tag
+//	@Description	Follows a tag, adding the posts having it to the caller's feed
+//	@Tags			tags
+//	@Accept			json
+//	@Produce		json
+//	@Param			tag	path		string	true	"Tag"
+//	@Success		204	{string}	string	"Tag followed"
+//	@Failure		400	{object}	error	"Invalid tag or too many followed tags"
+//	@Failure		409	{object}	error	"Tag already followed"
+//	@Security		ApiKeyAuth
+//	@Router			/tags/{tag}/follow [put]
+func (app *application) followTagHandler(w http.ResponseWriter, r *http.Request) {
+
+	tag := strings.TrimSpace(chi.URLParam(r, "tag"))
+	if err := Validate.Var(tag, "required,max=100"); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+
+	if err := app.store.TagFollows.Follow(r.Context(), user.ID, tag); err != nil {
+		switch err {
+		case store.ErrDuplicateKey:
+			app.conflictResponse(w, r, err)
+		case store.ErrTooManyTags:
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.invalidateTimelines(r.Context(), user.ID)
+
+	if err := app.jsonResponseNoData(w, http.StatusNoContent); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// UnfollowTag godoc
+//
+//	@Summary		Unfollows a tag
+//	@Description	Unfollows a tag
+//	@Tags			tags
+//	@Accept			json
+//	@Produce		json
+//	@Param			tag	path		string	true	"Tag"
+//	@Success		204	{string}	string	"Tag unfollowed"
+//	@Failure		404	{object}	error	"Tag not followed"
+//	@Security		ApiKeyAuth
+//	@Router			/tags/{tag}/unfollow [put]
+func (app *application) unfollowTagHandler(w http.ResponseWriter, r *http.Request) {
+
+	tag := strings.TrimSpace(chi.URLParam(r, "tag"))
+	user := getUserFromCtx(r)
+
+	if err := app.store.TagFollows.Unfollow(r.Context(), user.ID, tag); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.invalidateTimelines(r.Context(), user.ID)
+
+	if err := app.jsonResponseNoData(w, http.StatusNoContent); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// GetFollowedTags godoc
+//
+//	@Summary		Lists my followed tags
+//	@Description	Lists the tags the caller follows, most recent first
+//	@Tags			tags
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	[]store.TagFollow
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/user/me/tags [get]
+func (app *application) getFollowedTagsHandler(w http.ResponseWriter, r *http.Request) {
+
+	user := getUserFromCtx(r)
+
+	tags, err := app.store.TagFollows.List(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tags); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"github.com/wesleybruno/golang-monolito/internal/store"
+)
+
+const (
+	// timelineChunkSize bounds the number of timelines updated per Redis round trip
+	timelineChunkSize = 500
+	// timelineWarmSize is the number of posts loaded into a cold timeline
+	timelineWarmSize = 800
+)
+
+// fanOutPost pushes a new post to the cached timelines of its author and
+// audience. Celebrities come without one, readers merge their posts in.
+func (app *application) fanOutPost(ctx context.Context, post *store.Post, author *store.User, audience []int64) {
+	if !app.config.cache.enabled {
+		return
+	}
+
+	targets := append([]int64{author.ID}, audience...)
+
+	for start := 0; start < len(targets); start += timelineChunkSize {
+		chunk := targets[start:min(start+timelineChunkSize, len(targets))]
+		if err := app.cache.Timelines.Push(ctx, chunk, post.ID); err != nil {
+			app.logger.Errorw("error pushing post to timelines", "post", post.ID, "error", err)
+			return
+		}
+	}
+}
+
+// invalidateTimelines drops cached timelines after follows, blocks or mutes
+// change whose posts belong in them. They're rebuilt on the next read.
+func (app *application) invalidateTimelines(ctx context.Context, userIDs ...int64) {
+	if !app.config.cache.enabled {
+		return
+	}
+
+	app.cache.Timelines.Delete(ctx, userIDs...)
+}
+
+// canReadTimeline reports whether the cached timeline can serve fq: only
+// the plain newest-first feed is cached, filters and offsets go to SQL.
+func (app *application) canReadTimeline(fq store.PaginationFeedQuery) bool {
+	if !app.config.cache.enabled {
+		return false
+	}
+
+	if fq.Mode != "chronological" || fq.Search != "" || len(fq.Tags) > 0 || fq.Since != nil || fq.Until != nil || fq.Sort != "desc" || fq.Offset > 0 {
+		return false
+	}
+
+	if fq.Cursor != "" {
+		cursor, err := store.DecodeCursor(fq.Cursor)
+		if err != nil || cursor.Prev {
+			return false
+		}
+	}
+
+	return true
+}
+
+// getTimelineFeed reads a feed page from the cached timeline of userID. ok is
+// false when the timeline is cold, it's then rebuilt in the background and
+// the caller falls back to the database. So does it once the page reaches
+// past the posts a trimmed timeline kept.
+func (app *application) getTimelineFeed(ctx context.Context, userID int64, fq store.PaginationFeedQuery) ([]*store.PostWithMetadata, store.PageCursors, bool, error) {
+	var cursors store.PageCursors
+
+	warm, err := app.cache.Timelines.Exists(ctx, userID)
+	if err != nil {
+		return nil, cursors, false, err
+	}
+
+	if !warm {
+		app.background(func() {
+			app.warmTimeline(context.Background(), userID)
+		})
+		return nil, cursors, false, nil
+	}
+
+	var beforeID int64
+	if fq.Cursor != "" {
+		cursor, err := store.DecodeCursor(fq.Cursor)
+		if err != nil {
+			return nil, cursors, false, err
+		}
+		beforeID = cursor.ID
+	}
+
+	ids, complete, err := app.cache.Timelines.Range(ctx, userID, beforeID, fq.Limit+1)
+	if err != nil {
+		return nil, cursors, false, err
+	}
+
+	// past the end of a trimmed timeline, the database has the older posts
+	if len(ids) <= fq.Limit && !complete {
+		return nil, cursors, false, nil
+	}
+
+	// fan-out on read for the celebrities userID follows
+	celebrityIDs, err := app.store.Posts.GetTimelineIDs(ctx, userID, app.config.feed.celebrityThreshold, true, beforeID, fq.Limit+1)
+	if err != nil {
+		return nil, cursors, false, err
+	}
+
+	ids = append(ids, celebrityIDs...)
+	slices.SortFunc(ids, func(a, b int64) int { return cmp.Compare(b, a) })
+	ids = slices.Compact(ids)
+
+	hasMore := len(ids) > fq.Limit
+	if hasMore {
+		ids = ids[:fq.Limit]
+	}
+
+	feed, createdAt, err := app.store.Posts.GetFeedByIDs(ctx, userID, ids)
+	if err != nil {
+		return nil, cursors, false, err
+	}
+
+	// everything on the page was filtered out, let the database find the next posts
+	if len(feed) == 0 && len(ids) > 0 {
+		return nil, cursors, false, nil
+	}
+
+	if len(feed) > 0 {
+		first, last := feed[0], feed[len(feed)-1]
+
+		cursors.Prev = &store.Cursor{CreatedAt: createdAt[0], ID: first.Post.ID, Prev: true}
+		if hasMore {
+			cursors.Next = &store.Cursor{CreatedAt: createdAt[len(createdAt)-1], ID: last.Post.ID}
+		}
+	}
+
+	return feed, cursors, true, nil
+}
+
+// warmTimeline rebuilds the cached timeline of userID from the database.
+func (app *application) warmTimeline(ctx context.Context, userID int64) {
+	ids, err := app.store.Posts.GetTimelineIDs(ctx, userID, app.config.feed.celebrityThreshold, false, 0, timelineWarmSize)
+	if err != nil {
+		app.logger.Errorw("error loading timeline", "user", userID, "error", err)
+		return
+	}
+
+	if err := app.cache.Timelines.Fill(ctx, userID, ids); err != nil {
+		app.logger.Errorw("error filling timeline", "user", userID, "error", err)
+	}
+}
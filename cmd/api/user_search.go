@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/wesleybruno/golang-monolito/internal/store"
+)
+
+// SearchUsers godoc
+//
+//	@Summary		Searches users
+//	@Description	Finds users by username or display name. Prefix matches rank first, then similar names
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			q		query		string	true	"Search text"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Success		200		{object}	[]store.UserSearchResult
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/search [get]
+func (app *application) searchUserByNameHandler(w http.ResponseWriter, r *http.Request) {
+
+	uq := store.UserSearchQuery{
+		Limit:  20,
+		Offset: 0,
+	}
+
+	uq, err := uq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(uq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	viewer := getUserFromCtx(r)
+
+	results, err := app.store.Users.SearchByName(r.Context(), viewer.ID, uq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, results); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// GetUserSuggestions godoc
+//
+//	@Summary		Suggests users to follow
+//	@Description	Suggests users followed by the people the caller follows, ranked by how many of them do
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit	query		int	false	"Limit"
+//	@Success		200		{object}	[]store.UserSearchResult
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/suggestions [get]
+func (app *application) getUserSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+
+	limit := 10
+	if v := r.URL.Query().Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		limit = l
+	}
+
+	if err := Validate.Var(limit, "gte=1,lte=50"); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	viewer := getUserFromCtx(r)
+
+	results, err := app.store.Users.Suggestions(r.Context(), viewer.ID, limit)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, results); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
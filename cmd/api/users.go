@@ -1,11 +1,13 @@
 package main
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/wesleybruno/golang-monolito/internal/store"
+	"github.com/wesleybruno/golang-monolito/internal/webhooks"
 )
 
 type userKey string
@@ -56,13 +58,15 @@ func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 // FollowUser godoc
 //
 //	@Summary		Follows a user
-//	@Description	Follows a user by ID
+//	@Description	Follows a user by ID. Following a private account sends a follow request instead
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
-//	@Param			userID	path		int		true	"User ID"
-//	@Success		204		{string}	string	"User followed"
+//	@Param			userID	path		int					true	"User ID"
+//	@Success		204		{string}	string				"User followed"
+//	@Success		202		{object}	store.FollowRequest	"Follow request sent"
 //	@Failure		400		{object}	error	"User payload missing"
+//	@Failure		403		{object}	error	"User is blocked"
 //	@Failure		404		{object}	error	"User not found"
 //	@Security		ApiKeyAuth
 //	@Router			/user/{userID}/follow [put]
@@ -71,7 +75,7 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 	user := getUserFromCtx(r)
 	myId := user.ID
 
-	followedId, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	followedId, err := strconv.ParseInt(chi.URLParam(r, "userId"), 10, 64)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
@@ -81,15 +85,26 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 	if err != nil {
 
 		switch err {
+		case store.ErrPrivateAccount:
+			app.requestFollow(w, r, myId, followedId)
 		case store.ErrDuplicateKey:
 			app.conflictResponse(w, r, err)
+		case store.ErrBlocked:
+			app.forbiddenResponse(w, r)
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
 		default:
 			app.internalServerError(w, r, err)
-			return
 		}
+		return
 
 	}
 
+	app.invalidateUsers(r.Context(), myId, followedId)
+	app.invalidateTimelines(r.Context(), myId)
+	app.notify(store.NewNotification{UserID: followedId, ActorID: myId, Kind: store.NotificationFollow})
+	app.emitWebhook(followedId, webhooks.EventUserFollowed, followEvent{UserID: followedId, FollowerID: myId})
+
 	if err := app.jsonResponseNoData(w, http.StatusCreated); err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -115,7 +130,7 @@ func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Reque
 	user := getUserFromCtx(r)
 	myId := user.ID
 
-	followedId, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	followedId, err := strconv.ParseInt(chi.URLParam(r, "userId"), 10, 64)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
@@ -127,6 +142,8 @@ func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	app.invalidateUsers(r.Context(), myId, followedId)
+
 	if err := app.jsonResponseNoData(w, http.StatusCreated); err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -134,6 +151,190 @@ func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Reque
 
 }
 
+// BlockUser godoc
+//
+//	@Summary		Blocks a user
+//	@Description	Blocks a user by ID, removing any follow relationship between both users
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID"
+//	@Success		204		{string}	string	"User blocked"
+//	@Failure		400		{object}	error	"User payload missing"
+//	@Failure		404		{object}	error	"User not found"
+//	@Failure		409		{object}	error	"User already blocked"
+//	@Security		ApiKeyAuth
+//	@Router			/user/{userID}/block [put]
+func (app *application) blockUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	user := getUserFromCtx(r)
+
+	blockedId, err := strconv.ParseInt(chi.URLParam(r, "userId"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if blockedId == user.ID {
+		app.badRequestResponse(w, r, errors.New("you can't block yourself"))
+		return
+	}
+
+	err = app.store.Blocks.Block(r.Context(), user.ID, blockedId)
+	if err != nil {
+		switch err {
+		case store.ErrDuplicateKey:
+			app.conflictResponse(w, r, err)
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.invalidateUsers(r.Context(), user.ID, blockedId)
+
+	if err := app.jsonResponseNoData(w, http.StatusNoContent); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// UnblockUser godoc
+//
+//	@Summary		Unblocks a user
+//	@Description	Unblocks a user by ID
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID"
+//	@Success		204		{string}	string	"User unblocked"
+//	@Failure		400		{object}	error	"User payload missing"
+//	@Failure		404		{object}	error	"User not blocked"
+//	@Security		ApiKeyAuth
+//	@Router			/user/{userID}/unblock [put]
+func (app *application) unblockUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	user := getUserFromCtx(r)
+
+	blockedId, err := strconv.ParseInt(chi.URLParam(r, "userId"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	err = app.store.Blocks.Unblock(r.Context(), user.ID, blockedId)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponseNoData(w, http.StatusNoContent); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// MuteUser godoc
+//
+//	@Summary		Mutes a user
+//	@Description	Mutes a user by ID, hiding their posts from the feed without unfollowing
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID"
+//	@Success		204		{string}	string	"User muted"
+//	@Failure		400		{object}	error	"User payload missing"
+//	@Failure		404		{object}	error	"User not found"
+//	@Failure		409		{object}	error	"User already muted"
+//	@Security		ApiKeyAuth
+//	@Router			/user/{userID}/mute [put]
+func (app *application) muteUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	user := getUserFromCtx(r)
+
+	mutedId, err := strconv.ParseInt(chi.URLParam(r, "userId"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if mutedId == user.ID {
+		app.badRequestResponse(w, r, errors.New("you can't mute yourself"))
+		return
+	}
+
+	err = app.store.Blocks.Mute(r.Context(), user.ID, mutedId)
+	if err != nil {
+		switch err {
+		case store.ErrDuplicateKey:
+			app.conflictResponse(w, r, err)
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponseNoData(w, http.StatusNoContent); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// UnmuteUser godoc
+//
+//	@Summary		Unmutes a user
+//	@Description	Unmutes a user by ID
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID"
+//	@Success		204		{string}	string	"User unmuted"
+//	@Failure		400		{object}	error	"User payload missing"
+//	@Failure		404		{object}	error	"User not muted"
+//	@Security		ApiKeyAuth
+//	@Router			/user/{userID}/unmute [put]
+func (app *application) unmuteUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	user := getUserFromCtx(r)
+
+	mutedId, err := strconv.ParseInt(chi.URLParam(r, "userId"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	err = app.store.Blocks.Unmute(r.Context(), user.ID, mutedId)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.invalidateTimelines(r.Context(), user.ID)
+
+	if err := app.jsonResponseNoData(w, http.StatusNoContent); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
 func getUserFromCtx(r *http.Request) *store.User {
 	user, _ := r.Context().Value(userCtx).(*store.User)
 	return user
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/wesleybruno/golang-monolito/internal/store"
+	"github.com/wesleybruno/golang-monolito/internal/webhooks"
+)
+
+// followEvent is the data of user.followed deliveries.
+type followEvent struct {
+	UserID     int64 `json:"user_id"`
+	FollowerID int64 `json:"follower_id"`
+}
+
+// emitWebhook delivers event to the webhooks of userID subscribed to it. It
+// returns right away: deliveries are logged and attempted in the background,
+// the failed ones being retried by deliverWebhooks.
+func (app *application) emitWebhook(userID int64, event string, data any) {
+	app.background(func() {
+		ctx := context.Background()
+
+		body, err := json.Marshal(webhooks.Payload{Event: event, CreatedAt: time.Now().UTC(), Data: data})
+		if err != nil {
+			app.logger.Errorw("error encoding webhook payload", "event", event, "error", err)
+			return
+		}
+
+		deliveries, err := app.store.Webhooks.Enqueue(ctx, userID, event, body, time.Now().Add(app.config.webhooks.lease))
+		if err != nil {
+			app.logger.Errorw("error enqueuing webhook deliveries", "user", userID, "event", event, "error", err)
+			return
+		}
+
+		for _, d := range deliveries {
+			app.attemptDelivery(ctx, d)
+		}
+	})
+}
+
+// deliverWebhooks attempts the deliveries due for a retry, a few at a time.
+func (app *application) deliverWebhooks(ctx context.Context) error {
+	workers := app.config.webhooks.workers
+
+	for {
+		now := time.Now()
+		deliveries, err := app.store.Webhooks.ClaimDue(ctx, now, now.Add(app.config.webhooks.lease), workers*4)
+		if err != nil {
+			return err
+		}
+
+		if len(deliveries) == 0 {
+			return nil
+		}
+
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, workers)
+
+		for _, d := range deliveries {
+			wg.Add(1)
+			sem <- struct{}{}
+
+			go func(d *store.WebhookDelivery) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				app.attemptDelivery(ctx, d)
+			}(d)
+		}
+
+		wg.Wait()
+	}
+}
+
+// attemptDelivery sends a claimed delivery and logs the outcome, scheduling
+// a retry with exponential backoff until the attempts run out.
+func (app *application) attemptDelivery(ctx context.Context, d *store.WebhookDelivery) {
+	cfg := app.config.webhooks
+
+	status, err := app.webhooks.Send(ctx, d.URL, d.Secret, d.Event, d.ID, d.Payload)
+	if err == nil {
+		if err := app.store.Webhooks.RecordSuccess(ctx, d, status); err != nil {
+			app.logger.Errorw("error recording webhook delivery", "delivery", d.ID, "error", err)
+		}
+		return
+	}
+
+	var retryAt *time.Time
+	if attempts := d.Attempts + 1; attempts < cfg.maxAttempts {
+		at := time.Now().Add(webhooks.Backoff(attempts, cfg.backoff, cfg.maxBackoff))
+		retryAt = &at
+	}
+
+	disabled, recordErr := app.store.Webhooks.RecordFailure(ctx, d, status, err.Error(), retryAt, cfg.disableAfter)
+	if recordErr != nil {
+		app.logger.Errorw("error recording webhook delivery", "delivery", d.ID, "error", recordErr)
+		return
+	}
+
+	app.logger.Warnw("webhook delivery failed", "delivery", d.ID, "webhook", d.WebhookID, "attempt", d.Attempts+1, "error", err)
+
+	if disabled {
+		app.logger.Warnw("webhook disabled after repeated failures", "webhook", d.WebhookID)
+	}
+}
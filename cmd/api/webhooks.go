@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/wesleybruno/golang-monolito/internal/store"
+	"github.com/wesleybruno/golang-monolito/internal/webhooks"
+)
+
+type webhookKey string
+
+const webhookCtx webhookKey = "webhook"
+
+type CreateWebhookPayload struct {
+	URL    string   `json:"url" validate:"required,http_url,max=2000"`
+	Events []string `json:"events" validate:"required,min=1,unique,dive,oneof=post.created comment.created reaction.created user.followed"`
+	// Secret signs the deliveries, one is generated when empty
+	Secret string `json:"secret" validate:"omitempty,min=16,max=100"`
+}
+
+type UpdateWebhookPayload struct {
+	URL      *string  `json:"url" validate:"omitempty,http_url,max=2000"`
+	Events   []string `json:"events" validate:"omitempty,min=1,unique,dive,oneof=post.created comment.created reaction.created user.followed"`
+	IsActive *bool    `json:"is_active"`
+}
+
+// CreateWebhook godoc
+//
+//	@Summary		Creates a webhook
+//	@Description	Subscribes a public URL to events about the caller. Deliveries are POSTed with an X-Webhook-Signature header "t=<unix>,v1=<hex HMAC-SHA256 of t.body>". The secret is only returned here
+//	@Tags			webhooks
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateWebhookPayload	true	"Webhook payload"
+//	@Success		201		{object}	store.Webhook
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/webhooks [post]
+func (app *application) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+
+	var payload CreateWebhookPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := webhooks.CheckURL(r.Context(), payload.URL); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+
+	secret := payload.Secret
+	if secret == "" {
+		s, err := webhooks.NewSecret()
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		secret = s
+	}
+
+	webhook := &store.Webhook{
+		UserID: user.ID,
+		URL:    payload.URL,
+		Secret: secret,
+		Events: payload.Events,
+	}
+
+	if err := app.store.Webhooks.Create(r.Context(), webhook); err != nil {
+		switch err {
+		case store.ErrTooManyWebhooks:
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, webhook); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// GetWebhooks godoc
+//
+//	@Summary		Lists my webhooks
+//	@Description	Lists the caller's webhooks
+//	@Tags			webhooks
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	[]store.Webhook
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/webhooks [get]
+func (app *application) getWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+
+	user := getUserFromCtx(r)
+
+	hooks, err := app.store.Webhooks.List(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, hooks); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// GetWebhook godoc
+//
+//	@Summary		Fetches a webhook
+//	@Description	Fetches one of the caller's webhooks
+//	@Tags			webhooks
+//	@Accept			json
+//	@Produce		json
+//	@Param			webhookId	path		int	true	"Webhook ID"
+//	@Success		200			{object}	store.Webhook
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/webhooks/{webhookId} [get]
+func (app *application) getWebhookHandler(w http.ResponseWriter, r *http.Request) {
+
+	if err := app.jsonResponse(w, http.StatusOK, getWebhookFromCtx(r)); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// UpdateWebhook godoc
+//
+//	@Summary		Updates a webhook
+//	@Description	Changes the URL, events or state of a webhook. Turning a disabled webhook back on clears its failures and resumes its pending deliveries
+//	@Tags			webhooks
+//	@Accept			json
+//	@Produce		json
+//	@Param			webhookId	path		int						true	"Webhook ID"
+//	@Param			payload		body		UpdateWebhookPayload	true	"Webhook payload"
+//	@Success		200			{object}	store.Webhook
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/webhooks/{webhookId} [patch]
+func (app *application) updateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+
+	var payload UpdateWebhookPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	webhook := getWebhookFromCtx(r)
+
+	if payload.URL != nil {
+		if err := webhooks.CheckURL(r.Context(), *payload.URL); err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		webhook.URL = *payload.URL
+	}
+	if payload.Events != nil {
+		webhook.Events = payload.Events
+	}
+	if payload.IsActive != nil {
+		webhook.IsActive = *payload.IsActive
+	}
+
+	if err := app.store.Webhooks.Update(r.Context(), webhook); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, webhook); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// DeleteWebhook godoc
+//
+//	@Summary		Deletes a webhook
+//	@Description	Deletes a webhook with its delivery log
+//	@Tags			webhooks
+//	@Accept			json
+//	@Produce		json
+//	@Param			webhookId	path		int		true	"Webhook ID"
+//	@Success		204			{string}	string	"Webhook deleted"
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/webhooks/{webhookId} [delete]
+func (app *application) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+
+	webhook := getWebhookFromCtx(r)
+
+	if err := app.store.Webhooks.Delete(r.Context(), webhook.ID, webhook.UserID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponseNoData(w, http.StatusNoContent); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// GetWebhookDeliveries godoc
+//
+//	@Summary		Lists the deliveries of a webhook
+//	@Description	Pages through the delivery log of a webhook, the newest first, with the outcome of their last attempt
+//	@Tags			webhooks
+//	@Accept			json
+//	@Produce		json
+//	@Param			webhookId	path		int		true	"Webhook ID"
+//	@Param			limit		query		int		false	"Limit"
+//	@Param			since		query		string	false	"Oldest created_at, RFC 3339 or relative to now like -24h"
+//	@Param			until		query		string	false	"Newest created_at (exclusive), RFC 3339 or relative to now like -1h"
+//	@Param			cursor		query		string	false	"Cursor returned by the previous page"
+//	@Success		200			{object}	[]store.WebhookDelivery
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/webhooks/{webhookId}/deliveries [get]
+func (app *application) getWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+
+	cq := store.PaginationCursorQuery{
+		Limit: 20,
+	}
+
+	cq, err := cq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(cq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	webhook := getWebhookFromCtx(r)
+
+	deliveries, next, err := app.store.Webhooks.GetDeliveries(r.Context(), webhook.ID, cq)
+	if err != nil {
+		switch err {
+		case store.ErrInvalidCursor:
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	var cursors pageCursors
+	if next != nil {
+		cursors.Next = next.Encode()
+	}
+
+	if err := app.paginatedJsonResponse(w, http.StatusOK, deliveries, cursors); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+func (app *application) webhooksContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "webhookId"), 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+		user := getUserFromCtx(r)
+
+		webhook, err := app.store.Webhooks.GetByID(ctx, id, user.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, webhookCtx, webhook)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getWebhookFromCtx(r *http.Request) *store.Webhook {
+	webhook, _ := r.Context().Value(webhookCtx).(*store.Webhook)
+	return webhook
+}
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS idx_followers_follower_id_created_at;
+
+DROP INDEX IF EXISTS idx_followers_user_id_created_at;
+
+DROP TRIGGER IF EXISTS trg_followers_counts ON followers;
+
+DROP FUNCTION IF EXISTS followers_update_counts;
+
+ALTER TABLE
+  users DROP COLUMN following_count,
+  DROP COLUMN followers_count;
\ No newline at end of file
@@ -0,0 +1,35 @@
+ALTER TABLE
+  users
+ADD
+  COLUMN followers_count bigint NOT NULL DEFAULT 0,
+ADD
+  COLUMN following_count bigint NOT NULL DEFAULT 0;
+
+-- followers(user_id, follower_id) means user_id follows follower_id
+UPDATE
+  users u
+SET
+  followers_count = (SELECT COUNT(*) FROM followers f WHERE f.follower_id = u.id),
+  following_count = (SELECT COUNT(*) FROM followers f WHERE f.user_id = u.id);
+
+CREATE OR REPLACE FUNCTION followers_update_counts() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    UPDATE users SET following_count = following_count + 1 WHERE id = NEW.user_id;
+    UPDATE users SET followers_count = followers_count + 1 WHERE id = NEW.follower_id;
+    RETURN NEW;
+  END IF;
+
+  UPDATE users SET following_count = following_count - 1 WHERE id = OLD.user_id;
+  UPDATE users SET followers_count = followers_count - 1 WHERE id = OLD.follower_id;
+  RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_followers_counts
+AFTER INSERT OR DELETE ON followers
+FOR EACH ROW EXECUTE FUNCTION followers_update_counts();
+
+CREATE INDEX IF NOT EXISTS idx_followers_user_id_created_at ON followers (user_id, created_at DESC, follower_id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_followers_follower_id_created_at ON followers (follower_id, created_at DESC, user_id DESC);
\ No newline at end of file
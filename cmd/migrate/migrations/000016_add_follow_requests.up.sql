@@ -0,0 +1,19 @@
+ALTER TABLE
+  users
+ADD
+  COLUMN is_private boolean NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS follow_requests(
+    requester_id bigint NOT NULL,
+    target_id bigint NOT NULL,
+    status varchar(20) NOT NULL DEFAULT 'pending',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY(requester_id, target_id),
+    FOREIGN KEY (requester_id)  REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (target_id)     REFERENCES users (id) ON DELETE CASCADE,
+    CHECK (status IN ('pending', 'accepted', 'rejected'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_follow_requests_target_id ON follow_requests (target_id, status, created_at DESC);
\ No newline at end of file
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS user_email_changes;
+
+ALTER TABLE
+  users DROP COLUMN bio,
+  DROP COLUMN display_name;
\ No newline at end of file
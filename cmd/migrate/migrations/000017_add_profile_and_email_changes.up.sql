@@ -0,0 +1,17 @@
+ALTER TABLE
+  users
+ADD
+  COLUMN display_name varchar(100) NOT NULL DEFAULT '',
+ADD
+  COLUMN bio text NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS user_email_changes(
+    token bytea PRIMARY KEY,
+    user_id bigint NOT NULL,
+    new_email citext NOT NULL,
+    expiry timestamp(0) with time zone NOT NULL,
+
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_email_changes_user_id ON user_email_changes (user_id);
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE
+  users DROP COLUMN banner,
+  DROP COLUMN avatar;
\ No newline at end of file
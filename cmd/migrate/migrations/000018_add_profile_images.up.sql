@@ -0,0 +1,6 @@
+ALTER TABLE
+  users
+ADD
+  COLUMN avatar jsonb,
+ADD
+  COLUMN banner jsonb;
\ No newline at end of file
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS data_exports(
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    status varchar(20) NOT NULL DEFAULT 'pending',
+    file_key text,
+    error text,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    completed_at timestamp(0) with time zone,
+    expires_at timestamp(0) with time zone,
+
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CHECK (status IN ('pending', 'running', 'completed', 'failed'))
+);
+
+-- only one export per user may be in progress
+CREATE UNIQUE INDEX IF NOT EXISTS idx_data_exports_in_progress ON data_exports (user_id) WHERE status IN ('pending', 'running');
\ No newline at end of file
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_users_deletion_scheduled_at;
+
+ALTER TABLE
+  users DROP COLUMN deleted_at,
+  DROP COLUMN deletion_scheduled_at;
\ No newline at end of file
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS user_password_resets;
+
+ALTER TABLE
+  users DROP COLUMN password_reset_required;
+
+DROP TABLE IF EXISTS admin_audit_log;
\ No newline at end of file
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS admin_audit_log(
+    id bigserial PRIMARY KEY,
+    actor_id bigint,
+    action varchar(100) NOT NULL,
+    target_user_id bigint,
+    metadata jsonb NOT NULL DEFAULT '{}',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (actor_id)          REFERENCES users (id) ON DELETE SET NULL,
+    FOREIGN KEY (target_user_id)    REFERENCES users (id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_admin_audit_log_target_user_id ON admin_audit_log (target_user_id);
+
+ALTER TABLE
+  users
+ADD
+  COLUMN password_reset_required boolean NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS user_password_resets(
+    token bytea PRIMARY KEY,
+    user_id bigint NOT NULL,
+    expiry timestamp(0) with time zone NOT NULL,
+
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
\ No newline at end of file
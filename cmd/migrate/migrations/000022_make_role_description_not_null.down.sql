@@ -0,0 +1,6 @@
+ALTER TABLE
+  roles
+ALTER COLUMN
+  description DROP NOT NULL,
+ALTER COLUMN
+  description DROP DEFAULT;
\ No newline at end of file
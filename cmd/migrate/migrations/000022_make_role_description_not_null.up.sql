@@ -0,0 +1,13 @@
+UPDATE
+  roles
+SET
+  description = ''
+WHERE
+  description IS NULL;
+
+ALTER TABLE
+  roles
+ALTER COLUMN
+  description SET DEFAULT '',
+ALTER COLUMN
+  description SET NOT NULL;
\ No newline at end of file
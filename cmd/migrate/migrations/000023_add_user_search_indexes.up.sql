@@ -0,0 +1,4 @@
+-- trigram indexes serve both the prefix (ILIKE 'q%') and the fuzzy (%) matches of the user search
+CREATE INDEX IF NOT EXISTS idx_users_username_trgm ON users USING gin (username gin_trgm_ops);
+
+CREATE INDEX IF NOT EXISTS idx_users_display_name_trgm ON users USING gin (display_name gin_trgm_ops);
\ No newline at end of file
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_posts_search_vector;
+
+DROP TRIGGER IF EXISTS trg_posts_search_vector ON posts;
+
+DROP FUNCTION IF EXISTS posts_search_vector_update;
+
+ALTER TABLE
+  posts DROP COLUMN search_vector,
+  DROP COLUMN language;
\ No newline at end of file
@@ -0,0 +1,31 @@
+ALTER TABLE
+  posts
+ADD
+  COLUMN language regconfig NOT NULL DEFAULT 'english',
+ADD
+  COLUMN search_vector tsvector;
+
+-- titles weigh more than content, tags are matched as-is
+CREATE OR REPLACE FUNCTION posts_search_vector_update() RETURNS trigger AS $$
+BEGIN
+  NEW.search_vector :=
+    setweight(to_tsvector(NEW.language, COALESCE(NEW.title, '')), 'A') ||
+    setweight(to_tsvector(NEW.language, COALESCE(NEW.content, '')), 'B') ||
+    setweight(to_tsvector('simple', array_to_string(COALESCE(NEW.tags, '{}'), ' ')), 'C');
+  RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_posts_search_vector
+BEFORE INSERT OR UPDATE OF title, content, tags, language ON posts
+FOR EACH ROW EXECUTE FUNCTION posts_search_vector_update();
+
+UPDATE
+  posts
+SET
+  search_vector =
+    setweight(to_tsvector(language, COALESCE(title, '')), 'A') ||
+    setweight(to_tsvector(language, COALESCE(content, '')), 'B') ||
+    setweight(to_tsvector('simple', array_to_string(COALESCE(tags, '{}'), ' ')), 'C');
+
+CREATE INDEX IF NOT EXISTS idx_posts_search_vector ON posts USING gin (search_vector);
\ No newline at end of file
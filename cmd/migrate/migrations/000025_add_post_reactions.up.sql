@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS post_reactions(
+    post_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    kind varchar(20) NOT NULL DEFAULT 'like',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (post_id, user_id),
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- the ranked feed reads the recent interactions of the caller
+CREATE INDEX IF NOT EXISTS idx_post_reactions_user_id_created_at ON post_reactions (user_id, created_at);
+
+CREATE INDEX IF NOT EXISTS idx_comments_user_id_created_at ON comments (user_id, created_at);
\ No newline at end of file
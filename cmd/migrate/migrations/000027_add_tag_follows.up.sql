@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS tag_follows(
+    user_id bigint NOT NULL,
+    tag varchar(100) NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (user_id, tag),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- new posts are fanned out to the followers of their tags
+CREATE INDEX IF NOT EXISTS idx_tag_follows_tag ON tag_follows (tag);
\ No newline at end of file
@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS notifications(
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    kind varchar(30) NOT NULL,
+    post_id bigint,
+    comment_id bigint,
+    -- notifications sharing a key are grouped while unread
+    group_key varchar(100) NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    read_at timestamp(0) with time zone,
+
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    FOREIGN KEY (comment_id) REFERENCES comments (id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notifications_unread_group ON notifications (user_id, group_key) WHERE read_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id_updated_at ON notifications (user_id, updated_at DESC, id DESC);
+
+CREATE TABLE IF NOT EXISTS notification_actors(
+    notification_id bigint NOT NULL,
+    actor_id bigint NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (notification_id, actor_id),
+    FOREIGN KEY (notification_id) REFERENCES notifications (id) ON DELETE CASCADE,
+    FOREIGN KEY (actor_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_actors_actor_id ON notification_actors (actor_id);
\ No newline at end of file
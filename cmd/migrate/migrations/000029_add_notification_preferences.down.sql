@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_notifications_unread_not_emailed;
+
+ALTER TABLE
+  users DROP COLUMN digest_sent_at;
+
+ALTER TABLE
+  notifications DROP COLUMN emailed_at;
+
+DROP TABLE IF EXISTS notification_preferences;
\ No newline at end of file
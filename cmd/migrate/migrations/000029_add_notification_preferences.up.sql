@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS notification_preferences(
+    user_id bigint NOT NULL,
+    kind varchar(30) NOT NULL,
+    delivery varchar(10) NOT NULL CHECK (delivery IN ('instant', 'digest', 'off')),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (user_id, kind),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+ALTER TABLE
+  notifications
+ADD
+  COLUMN emailed_at timestamp(0) with time zone;
+
+ALTER TABLE
+  users
+ADD
+  COLUMN digest_sent_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS idx_notifications_unread_not_emailed ON notifications (user_id) WHERE read_at IS NULL AND emailed_at IS NULL;
\ No newline at end of file
@@ -0,0 +1,42 @@
+CREATE TABLE IF NOT EXISTS conversations(
+    id bigserial PRIMARY KEY,
+    created_by bigint,
+    title varchar(100),
+    is_group boolean NOT NULL DEFAULT false,
+    -- "<lower id>:<higher id>" of a 1:1 conversation, so there's one per pair
+    direct_key varchar(50) UNIQUE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    -- moves with every message, ordering the conversation list
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (created_by) REFERENCES users (id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS conversation_participants(
+    conversation_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    last_read_message_id bigint,
+    last_read_at timestamp(0) with time zone,
+    joined_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (conversation_id, user_id),
+    FOREIGN KEY (conversation_id) REFERENCES conversations (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversation_participants_user_id ON conversation_participants (user_id);
+
+CREATE TABLE IF NOT EXISTS messages(
+    id bigserial PRIMARY KEY,
+    conversation_id bigint NOT NULL,
+    sender_id bigint NOT NULL,
+    content TEXT NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (conversation_id) REFERENCES conversations (id) ON DELETE CASCADE,
+    FOREIGN KEY (sender_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_conversation_id_id ON messages (conversation_id, id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_messages_sender_id ON messages (sender_id);
\ No newline at end of file
@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS webhooks(
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    url TEXT NOT NULL,
+    secret varchar(100) NOT NULL,
+    events varchar(50) [] NOT NULL,
+    is_active boolean NOT NULL DEFAULT true,
+    -- consecutive failed attempts, the webhook is disabled past a limit
+    failure_count int NOT NULL DEFAULT 0,
+    disabled_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhooks_user_id ON webhooks (user_id);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries(
+    id bigserial PRIMARY KEY,
+    webhook_id bigint NOT NULL,
+    event varchar(50) NOT NULL,
+    payload jsonb NOT NULL,
+    status varchar(20) NOT NULL DEFAULT 'pending',
+    attempts int NOT NULL DEFAULT 0,
+    next_attempt_at timestamp(0) with time zone,
+    response_status int,
+    error TEXT,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    delivered_at timestamp(0) with time zone,
+
+    FOREIGN KEY (webhook_id) REFERENCES webhooks (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id_created_at ON webhook_deliveries (webhook_id, created_at DESC, id DESC);
\ No newline at end of file
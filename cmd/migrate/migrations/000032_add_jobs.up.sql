@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS jobs(
+    id bigserial PRIMARY KEY,
+    kind varchar(100) NOT NULL,
+    payload jsonb NOT NULL DEFAULT '{}',
+    -- pending, running, succeeded or dead once its attempts ran out
+    status varchar(20) NOT NULL DEFAULT 'pending',
+    attempts int NOT NULL DEFAULT 0,
+    max_attempts int NOT NULL DEFAULT 5,
+    run_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    -- a running job whose lease expired is picked up again
+    locked_until timestamp(0) with time zone,
+    last_error TEXT,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    completed_at timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_pending_run_at ON jobs (run_at) WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS idx_jobs_running_locked_until ON jobs (locked_until) WHERE status = 'running';
+
+CREATE INDEX IF NOT EXISTS idx_jobs_status_created_at ON jobs (status, created_at DESC, id DESC);
\ No newline at end of file
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS scheduled_job_runs(
+    id bigserial PRIMARY KEY,
+    name varchar(100) NOT NULL,
+    -- the cron tick being run, NULL for runs triggered by an admin
+    scheduled_for timestamp(0) with time zone,
+    triggered_by bigint,
+    status varchar(20) NOT NULL DEFAULT 'running',
+    error text,
+    -- the host that ran the job
+    instance varchar(255) NOT NULL DEFAULT '',
+    started_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    finished_at timestamp(0) with time zone,
+    duration_ms bigint,
+
+    FOREIGN KEY (triggered_by) REFERENCES users (id) ON DELETE SET NULL,
+    CHECK (status IN ('running', 'succeeded', 'failed'))
+);
+
+-- each tick runs once, whichever instance gets to it first
+CREATE UNIQUE INDEX IF NOT EXISTS idx_scheduled_job_runs_tick ON scheduled_job_runs (name, scheduled_for);
+
+CREATE INDEX IF NOT EXISTS idx_scheduled_job_runs_started_at ON scheduled_job_runs (started_at DESC, id DESC);
\ No newline at end of file
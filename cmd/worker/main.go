@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/wesleybruno/golang-monolito/internal/db"
+	"github.com/wesleybruno/golang-monolito/internal/env"
+	"github.com/wesleybruno/golang-monolito/internal/jobs"
+	"github.com/wesleybruno/golang-monolito/internal/mailer"
+	"github.com/wesleybruno/golang-monolito/internal/store"
+)
+
+// The worker runs the background jobs queued by the API, such as emails.
+func main() {
+
+	env.LoadConfig()
+
+	logger := zap.Must(zap.NewProduction()).Sugar()
+	defer logger.Sync()
+
+	addr := fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable", env.Config.DbUser, env.Config.DbPassword, env.Config.DbAddress, env.Config.DbName)
+
+	conn, err := db.New(addr, env.Config.MaxOpenConns, env.Config.MaxIdleConns, env.Config.MaxIdleTime)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer conn.Close()
+	logger.Info("database connection pool established")
+
+	store := store.NewStorage(conn)
+	mailer := mailer.NewSendGrid(env.Config.SendGridApiKey, env.Config.FromEmail)
+
+	cfg := jobs.DefaultConfig
+	cfg.Workers = env.GetInt(env.Config.WorkerConcurrency, cfg.Workers)
+	retention := env.GetDuration(env.Config.JobRetention, time.Hour*24*7) // 7 days
+
+	runner := jobs.NewRunner(store.Jobs, logger, cfg)
+	runner.Handle(jobs.KindSendEmail, jobs.SendEmail(mailer, env.Config.Env != "production"))
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				n, err := store.Jobs.DeleteSucceeded(ctx, time.Now().Add(-retention))
+				if err != nil {
+					logger.Errorw("error deleting succeeded jobs", "error", err)
+					continue
+				}
+				logger.Infow("deleted succeeded jobs", "count", n)
+			}
+		}
+	}()
+
+	logger.Infow("worker has started", "workers", cfg.Workers)
+
+	if err := runner.Run(ctx); err != nil {
+		logger.Fatal(err)
+	}
+
+	logger.Info("worker stopped")
+}
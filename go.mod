@@ -5,6 +5,7 @@ go 1.22.2
 require (
 	github.com/go-chi/chi/v5 v5.1.0
 	github.com/spf13/viper v1.19.0
+	golang.org/x/net v0.30.0
 )
 
 require (
@@ -28,7 +29,6 @@ require (
 	github.com/swaggo/swag v1.16.3 // indirect
 	go.uber.org/zap v1.27.0 // indirect
 	golang.org/x/crypto v0.28.0 // indirect
-	golang.org/x/net v0.30.0 // indirect
 	golang.org/x/tools v0.26.0 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
@@ -0,0 +1,20 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Sign returns the hex encoded HMAC-SHA256 of message, used for links that
+// must work without a session such as downloads or unsubscribes.
+func Sign(secret, message string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature compares signature with the expected one in constant time.
+func VerifySignature(secret, message, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, message)), []byte(signature))
+}
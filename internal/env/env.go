@@ -1,6 +1,11 @@
 package env
 
-import "github.com/spf13/viper"
+import (
+	"strconv"
+	"time"
+
+	"github.com/spf13/viper"
+)
 
 type Enviroment struct {
 	ApiPort                 string `mapstructure:"PORT"`
@@ -25,6 +30,18 @@ type Enviroment struct {
 	RateLimiterRequestCount int    `mapstructure:"RATE_LIMITER_REQUEST_COUNT"`
 	RateLimiterEnabled      bool   `mapstructure:"RATE_LIMITER_ENABLED"`
 	CorsAllowedOrigin       string `mapstructure:"CORS_ALLOWED_ORIGIN"`
+	MediaDir                string `mapstructure:"MEDIA_DIR"`
+	MediaBaseURL            string `mapstructure:"MEDIA_BASE_URL"`
+	ExportsDir              string `mapstructure:"EXPORTS_DIR"`
+	DeletionGracePeriod     string `mapstructure:"ACCOUNT_DELETION_GRACE_PERIOD"`
+	DeletionPolicy          string `mapstructure:"ACCOUNT_DELETION_POLICY"`
+	FeedRankingHalfLife     string `mapstructure:"FEED_RANKING_HALF_LIFE"`
+	FeedWeightRecency       string `mapstructure:"FEED_WEIGHT_RECENCY"`
+	FeedWeightEngagement    string `mapstructure:"FEED_WEIGHT_ENGAGEMENT"`
+	FeedWeightAffinity      string `mapstructure:"FEED_WEIGHT_AFFINITY"`
+	FeedWeightTagAffinity   string `mapstructure:"FEED_WEIGHT_TAG_AFFINITY"`
+	WorkerConcurrency       string `mapstructure:"WORKER_CONCURRENCY"`
+	JobRetention            string `mapstructure:"JOB_RETENTION"`
 }
 
 var Config Enviroment
@@ -48,3 +65,45 @@ func LoadConfig() (*Enviroment, error) {
 	Config = *cfg
 	return cfg, err
 }
+
+// GetString returns value, or fallback when the variable wasn't set.
+func GetString(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+
+	return value
+}
+
+// GetDuration parses value as a duration such as "72h", or returns fallback
+// when the variable wasn't set or can't be parsed.
+func GetDuration(value string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return fallback
+	}
+
+	return d
+}
+
+// GetFloat parses value as a float, or returns fallback when the variable
+// wasn't set or can't be parsed.
+func GetFloat(value string, fallback float64) float64 {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fallback
+	}
+
+	return f
+}
+
+// GetInt parses value as an int, or returns fallback when the variable wasn't
+// set or can't be parsed.
+func GetInt(value string, fallback int) int {
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return fallback
+	}
+
+	return i
+}
@@ -0,0 +1,80 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// StreamLength is how many past events of a user are kept for clients
+	// resuming with Last-Event-ID.
+	StreamLength = 100
+	// StreamTTL drops the past events of users who stopped listening.
+	StreamTTL = time.Hour
+	// PresenceTTL is how long after their last stream closed users still get
+	// events published, so they can resume after a reconnect.
+	PresenceTTL = time.Minute
+	// subscriptionBuffer is how many events a subscriber may fall behind
+	// before it's dropped.
+	subscriptionBuffer = 64
+)
+
+var ErrInvalidID = errors.New("invalid event id")
+
+// Event is a message pushed to the streams of a user. IDs increase over time
+// and are "<unix milliseconds>-<sequence>", like Redis stream ids.
+type Event struct {
+	ID   string          `json:"id"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+type Broker interface {
+	// Publish sends an event to userIDs, skipping the users who don't have
+	// a stream open or closed one recently.
+	Publish(ctx context.Context, userIDs []int64, eventType string, data any) error
+	// Subscribe receives the events published to userID from now on.
+	Subscribe(ctx context.Context, userID int64) (*Subscription, error)
+	// Since returns the kept events of userID published after lastID, oldest first.
+	Since(ctx context.Context, userID int64, lastID string) ([]Event, error)
+	// Online lists the users Publish would reach right now.
+	Online(ctx context.Context) ([]int64, error)
+}
+
+// CompareIDs orders two event ids, returning -1, 0 or 1 like cmp.Compare.
+func CompareIDs(a, b string) int {
+	am, as, _ := parseID(a)
+	bm, bs, _ := parseID(b)
+
+	switch {
+	case am < bm, am == bm && as < bs:
+		return -1
+	case am == bm && as == bs:
+		return 0
+	default:
+		return 1
+	}
+}
+
+func parseID(id string) (int64, int64, error) {
+	ms, seq, ok := strings.Cut(id, "-")
+	if !ok {
+		return 0, 0, ErrInvalidID
+	}
+
+	m, err := strconv.ParseInt(ms, 10, 64)
+	if err != nil {
+		return 0, 0, ErrInvalidID
+	}
+
+	s, err := strconv.ParseInt(seq, 10, 64)
+	if err != nil {
+		return 0, 0, ErrInvalidID
+	}
+
+	return m, s, nil
+}
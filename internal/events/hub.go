@@ -0,0 +1,105 @@
+package events
+
+import "sync"
+
+// Subscription delivers the events of a user to one stream. C is closed
+// when the subscriber falls too far behind, it then has to resubscribe and
+// catch up with Since.
+type Subscription struct {
+	C <-chan Event
+
+	c      chan Event
+	userID int64
+	hub    *hub
+	once   sync.Once
+}
+
+// Close stops the subscription. It's safe to call more than once.
+func (s *Subscription) Close() {
+	s.hub.remove(s)
+}
+
+// hub tracks the subscriptions of this instance, calling onFirst and onLast
+// when a user gets their first subscriber and loses their last one.
+type hub struct {
+	mu   sync.Mutex
+	subs map[int64]map[*Subscription]struct{}
+
+	onFirst func(userID int64) error
+	onLast  func(userID int64)
+}
+
+func newHub() *hub {
+	return &hub{
+		subs:    make(map[int64]map[*Subscription]struct{}),
+		onFirst: func(int64) error { return nil },
+		onLast:  func(int64) {},
+	}
+}
+
+func (h *hub) add(userID int64) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.subs[userID]) == 0 {
+		if err := h.onFirst(userID); err != nil {
+			return nil, err
+		}
+		h.subs[userID] = make(map[*Subscription]struct{})
+	}
+
+	c := make(chan Event, subscriptionBuffer)
+	sub := &Subscription{C: c, c: c, userID: userID, hub: h}
+	h.subs[userID][sub] = struct{}{}
+
+	return sub, nil
+}
+
+func (h *hub) remove(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.drop(sub)
+}
+
+// drop must be called with mu held.
+func (h *hub) drop(sub *Subscription) {
+	sub.once.Do(func() {
+		close(sub.c)
+
+		subs := h.subs[sub.userID]
+		delete(subs, sub)
+
+		if len(subs) == 0 {
+			delete(h.subs, sub.userID)
+			h.onLast(sub.userID)
+		}
+	})
+}
+
+// dispatch hands ev to the subscribers of userID without blocking, dropping
+// the ones whose buffer is full.
+func (h *hub) dispatch(userID int64, ev Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subs[userID] {
+		select {
+		case sub.c <- ev:
+		default:
+			h.drop(sub)
+		}
+	}
+}
+
+// userIDs lists the users with at least one subscriber.
+func (h *hub) userIDs() []int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ids := make([]int64, 0, len(h.subs))
+	for id := range h.subs {
+		ids = append(ids, id)
+	}
+	return ids
+}
@@ -0,0 +1,140 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MemoryBroker keeps events within the instance, for running without Redis.
+type MemoryBroker struct {
+	hub *hub
+
+	mu       sync.Mutex
+	lastMs   int64
+	seq      int64
+	streams  map[int64][]Event
+	lastSeen map[int64]time.Time
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	b := &MemoryBroker{
+		hub:      newHub(),
+		streams:  make(map[int64][]Event),
+		lastSeen: make(map[int64]time.Time),
+	}
+
+	b.hub.onLast = func(userID int64) {
+		b.mu.Lock()
+		b.lastSeen[userID] = time.Now()
+		b.mu.Unlock()
+	}
+
+	return b
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, userIDs []int64, eventType string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	now := time.Now()
+	b.prune(now)
+
+	online := make(map[int64]bool)
+	for _, id := range b.hub.userIDs() {
+		online[id] = true
+	}
+
+	var published []Event
+	var targets []int64
+	for _, id := range userIDs {
+		if _, recent := b.lastSeen[id]; !online[id] && !recent {
+			continue
+		}
+
+		ev := Event{ID: b.nextID(now), Type: eventType, Data: payload}
+
+		stream := append(b.streams[id], ev)
+		if len(stream) > StreamLength {
+			stream = stream[len(stream)-StreamLength:]
+		}
+		b.streams[id] = stream
+
+		published = append(published, ev)
+		targets = append(targets, id)
+	}
+	b.mu.Unlock()
+
+	for i, id := range targets {
+		b.hub.dispatch(id, published[i])
+	}
+
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(ctx context.Context, userID int64) (*Subscription, error) {
+	b.mu.Lock()
+	delete(b.lastSeen, userID)
+	b.mu.Unlock()
+
+	return b.hub.add(userID)
+}
+
+func (b *MemoryBroker) Since(ctx context.Context, userID int64, lastID string) ([]Event, error) {
+	if _, _, err := parseID(lastID); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var events []Event
+	for _, ev := range b.streams[userID] {
+		if CompareIDs(ev.ID, lastID) > 0 {
+			events = append(events, ev)
+		}
+	}
+
+	return events, nil
+}
+
+func (b *MemoryBroker) Online(ctx context.Context) ([]int64, error) {
+	b.mu.Lock()
+	b.prune(time.Now())
+
+	ids := b.hub.userIDs()
+	for id := range b.lastSeen {
+		ids = append(ids, id)
+	}
+	b.mu.Unlock()
+
+	return ids, nil
+}
+
+// nextID must be called with mu held.
+func (b *MemoryBroker) nextID(now time.Time) string {
+	ms := now.UnixMilli()
+	if ms > b.lastMs {
+		b.lastMs, b.seq = ms, 0
+	} else {
+		b.seq++
+	}
+
+	return fmt.Sprintf("%d-%d", b.lastMs, b.seq)
+}
+
+// prune forgets the users gone for longer than PresenceTTL, it must be
+// called with mu held.
+func (b *MemoryBroker) prune(now time.Time) {
+	for id, seen := range b.lastSeen {
+		if now.Sub(seen) > PresenceTTL {
+			delete(b.lastSeen, id)
+			delete(b.streams, id)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	channelPrefix = "events-"
+	// onlineKey is a sorted set of the users with presence, scored by the
+	// time it expires, so they can be listed without scanning keys.
+	onlineKey = "events-online"
+)
+
+// RedisBroker shares events between instances. Every event is appended to a
+// capped stream of the user, for resuming, and published on their channel.
+// Each instance holds a single pub/sub connection, subscribed to the
+// channels of the users it has streams open for.
+type RedisBroker struct {
+	rdb    *redis.Client
+	pubsub *redis.PubSub
+	hub    *hub
+	logger *zap.SugaredLogger
+}
+
+func NewRedisBroker(rdb *redis.Client, logger *zap.SugaredLogger) *RedisBroker {
+	b := &RedisBroker{
+		rdb:    rdb,
+		pubsub: rdb.Subscribe(context.Background()),
+		hub:    newHub(),
+		logger: logger,
+	}
+
+	b.hub.onFirst = func(userID int64) error {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		return b.pubsub.Subscribe(ctx, channelKey(userID))
+	}
+	b.hub.onLast = func(userID int64) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		if err := b.pubsub.Unsubscribe(ctx, channelKey(userID)); err != nil {
+			b.logger.Errorw("error unsubscribing from events", "user", userID, "error", err)
+		}
+	}
+
+	go b.receive()
+	go b.keepPresence()
+
+	return b
+}
+
+func channelKey(userID int64) string {
+	return fmt.Sprintf("%s%d", channelPrefix, userID)
+}
+
+func streamKey(userID int64) string {
+	return fmt.Sprintf("events-stream-%d", userID)
+}
+
+func presenceKey(userID int64) string {
+	return fmt.Sprintf("events-online-%d", userID)
+}
+
+func (b *RedisBroker) Publish(ctx context.Context, userIDs []int64, eventType string, data any) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	pipe := b.rdb.Pipeline()
+	present := make([]*redis.IntCmd, len(userIDs))
+	for i, id := range userIDs {
+		present[i] = pipe.Exists(ctx, presenceKey(id))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	var targets []int64
+	for i, id := range userIDs {
+		if present[i].Val() > 0 {
+			targets = append(targets, id)
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil
+	}
+
+	pipe = b.rdb.Pipeline()
+	added := make([]*redis.StringCmd, len(targets))
+	for i, id := range targets {
+		added[i] = pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: streamKey(id),
+			MaxLen: StreamLength,
+			Approx: true,
+			Values: map[string]any{"type": eventType, "data": payload},
+		})
+		pipe.Expire(ctx, streamKey(id), StreamTTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	pipe = b.rdb.Pipeline()
+	for i, id := range targets {
+		msg, err := json.Marshal(Event{ID: added[i].Val(), Type: eventType, Data: payload})
+		if err != nil {
+			return err
+		}
+		pipe.Publish(ctx, channelKey(id), msg)
+	}
+	_, err = pipe.Exec(ctx)
+
+	return err
+}
+
+func (b *RedisBroker) Subscribe(ctx context.Context, userID int64) (*Subscription, error) {
+	pipe := b.rdb.Pipeline()
+	setPresence(ctx, pipe, userID, time.Now())
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	return b.hub.add(userID)
+}
+
+func (b *RedisBroker) Since(ctx context.Context, userID int64, lastID string) ([]Event, error) {
+	if _, _, err := parseID(lastID); err != nil {
+		return nil, err
+	}
+
+	msgs, err := b.rdb.XRangeN(ctx, streamKey(userID), "("+lastID, "+", StreamLength).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]Event, 0, len(msgs))
+	for _, msg := range msgs {
+		eventType, _ := msg.Values["type"].(string)
+		data, _ := msg.Values["data"].(string)
+
+		events = append(events, Event{ID: msg.ID, Type: eventType, Data: json.RawMessage(data)})
+	}
+
+	return events, nil
+}
+
+func (b *RedisBroker) Online(ctx context.Context) ([]int64, error) {
+	members, err := b.rdb.ZRangeByScore(ctx, onlineKey, &redis.ZRangeBy{
+		Min: strconv.FormatInt(time.Now().Unix(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, 0, len(members))
+	for _, member := range members {
+		id, err := strconv.ParseInt(member, 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// setPresence marks userID as listening for the next PresenceTTL.
+func setPresence(ctx context.Context, pipe redis.Pipeliner, userID int64, now time.Time) {
+	pipe.Set(ctx, presenceKey(userID), 1, PresenceTTL)
+	pipe.ZAdd(ctx, onlineKey, redis.Z{Score: float64(now.Add(PresenceTTL).Unix()), Member: userID})
+}
+
+// receive dispatches the messages of the pub/sub connection to the local
+// subscribers until it's closed.
+func (b *RedisBroker) receive() {
+	for msg := range b.pubsub.Channel() {
+		userID, err := strconv.ParseInt(strings.TrimPrefix(msg.Channel, channelPrefix), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		var ev Event
+		if err := json.Unmarshal([]byte(msg.Payload), &ev); err != nil {
+			b.logger.Errorw("error decoding event", "channel", msg.Channel, "error", err)
+			continue
+		}
+
+		b.hub.dispatch(userID, ev)
+	}
+}
+
+// keepPresence refreshes the presence of the users with open streams.
+func (b *RedisBroker) keepPresence() {
+	ticker := time.NewTicker(PresenceTTL / 3)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ids := b.hub.userIDs()
+		if len(ids) == 0 {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+
+		now := time.Now()
+		pipe := b.rdb.Pipeline()
+		for _, id := range ids {
+			setPresence(ctx, pipe, id, now)
+		}
+		pipe.ZRemRangeByScore(ctx, onlineKey, "-inf", strconv.FormatInt(now.Unix(), 10))
+		if _, err := pipe.Exec(ctx); err != nil {
+			b.logger.Errorw("error refreshing events presence", "error", err)
+		}
+
+		cancel()
+	}
+}
@@ -0,0 +1,51 @@
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+
+	"github.com/wesleybruno/golang-monolito/internal/store"
+)
+
+type Source interface {
+	Section(ctx context.Context, userID int64, section string) (json.RawMessage, error)
+}
+
+// WriteArchive writes a ZIP holding one indented JSON file per export section.
+func WriteArchive(ctx context.Context, w io.Writer, src Source, userID int64) error {
+	sections := make([]string, 0, len(store.ExportSections))
+	for name := range store.ExportSections {
+		sections = append(sections, name)
+	}
+	sort.Strings(sections)
+
+	zw := zip.NewWriter(w)
+
+	for _, name := range sections {
+		data, err := src.Section(ctx, userID, name)
+		if err != nil {
+			return err
+		}
+
+		f, err := zw.Create(name + ".json")
+		if err != nil {
+			return err
+		}
+
+		var v any
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
@@ -0,0 +1,91 @@
+package feed
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+// Weights tune how the ranked feed scores posts.
+type Weights struct {
+	// HalfLife is the age at which the score of a post is halved.
+	HalfLife    time.Duration
+	Recency     float64
+	Engagement  float64
+	Affinity    float64
+	TagAffinity float64
+}
+
+var DefaultWeights = Weights{
+	HalfLife:    time.Hour * 12,
+	Recency:     1,
+	Engagement:  1,
+	Affinity:    1.5,
+	TagAffinity: 0.5,
+}
+
+// Signals describe a post relative to the user reading the feed.
+type Signals struct {
+	Age            time.Duration `json:"-"`
+	Comments       int64         `json:"comments"`
+	Reactions      int64         `json:"reactions"`
+	AuthorAffinity int64         `json:"author_affinity"`
+	TagAffinity    int64         `json:"tag_affinity"`
+}
+
+// Explanation breaks a score down into its weighted parts, so it's visible
+// why a post ranked where it did.
+type Explanation struct {
+	Score       float64 `json:"score"`
+	Decay       float64 `json:"decay"`
+	Recency     float64 `json:"recency"`
+	Engagement  float64 `json:"engagement"`
+	Affinity    float64 `json:"affinity"`
+	TagAffinity float64 `json:"tag_affinity"`
+	AgeHours    float64 `json:"age_hours"`
+	Signals     Signals `json:"signals"`
+}
+
+// Score rates a post: the weighted recency, engagement and affinities are
+// summed, then decayed by age. Counts grow logarithmically so a viral post
+// doesn't bury everything else.
+func Score(w Weights, s Signals) Explanation {
+	e := Explanation{
+		Decay:       math.Exp2(-s.Age.Hours() / w.HalfLife.Hours()),
+		Recency:     w.Recency,
+		Engagement:  w.Engagement * math.Log1p(float64(2*s.Comments+s.Reactions)),
+		Affinity:    w.Affinity * math.Log1p(float64(s.AuthorAffinity)),
+		TagAffinity: w.TagAffinity * math.Log1p(float64(s.TagAffinity)),
+		AgeHours:    s.Age.Hours(),
+		Signals:     s,
+	}
+
+	e.Score = e.Decay * (e.Recency + e.Engagement + e.Affinity + e.TagAffinity)
+
+	return e
+}
+
+// Rank scores every post and returns their indexes from best to worst along
+// with the explanations, in input order. Ties keep the input order.
+func Rank(w Weights, signals []Signals) ([]int, []Explanation) {
+	explanations := make([]Explanation, len(signals))
+	order := make([]int, len(signals))
+
+	for i, s := range signals {
+		explanations[i] = Score(w, s)
+		order[i] = i
+	}
+
+	slices.SortStableFunc(order, func(a, b int) int {
+		switch sa, sb := explanations[a].Score, explanations[b].Score; {
+		case sa > sb:
+			return -1
+		case sa < sb:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	return order, explanations
+}
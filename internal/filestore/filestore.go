@@ -0,0 +1,18 @@
+package filestore
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var ErrInvalidKey = errors.New("invalid file key")
+
+// Storage keeps uploaded and generated files under slash separated keys such
+// as "avatars/12/3f2a_128.jpg".
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
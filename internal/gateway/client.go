@@ -0,0 +1,143 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// Client is a websocket connection of a user.
+type Client struct {
+	UserID int64
+
+	conn    *websocket.Conn
+	send    chan Message
+	ignored map[int64]bool
+	// topics is guarded by the mutex of the hub
+	topics map[string]struct{}
+
+	done      chan struct{}
+	closeOnce sync.Once
+	reason    string
+}
+
+func newClient(conn *websocket.Conn, userID int64) *Client {
+	conn.MaxPayloadBytes = MaxMessageBytes
+
+	return &Client{
+		UserID:  userID,
+		conn:    conn,
+		send:    make(chan Message, sendBuffer),
+		ignored: make(map[int64]bool),
+		topics:  make(map[string]struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Ignore hides the messages sent by userIDs, it must be called before Run.
+func (c *Client) Ignore(userIDs ...int64) {
+	for _, id := range userIDs {
+		c.ignored[id] = true
+	}
+}
+
+// Ignores reports whether messages sent by userID are hidden from c.
+func (c *Client) Ignores(userID int64) bool {
+	return c.ignored[userID]
+}
+
+// Send queues msg without blocking. A client whose queue is full can't keep
+// up and is disconnected, it's up to it to reconnect and catch up.
+func (c *Client) Send(msg Message) {
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+
+	select {
+	case c.send <- msg:
+	default:
+		c.Close("slow consumer")
+	}
+}
+
+// Close disconnects the client, telling it why when reason isn't empty.
+func (c *Client) Close(reason string) {
+	c.closeOnce.Do(func() {
+		c.reason = reason
+		close(c.done)
+	})
+}
+
+// Run reads the messages of the client, handing them to handle one at a
+// time, while writing the queued ones. It returns once the connection is
+// closed by either side.
+func (c *Client) Run(handle func(Message)) {
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		c.write()
+	}()
+
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(readTimeout))
+
+		var msg Message
+		err := websocket.JSON.Receive(c.conn, &msg)
+		if err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			switch {
+			case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+				c.Send(Message{Type: "error", Error: "malformed message"})
+				continue
+			case errors.Is(err, websocket.ErrFrameTooLarge):
+				c.Send(Message{Type: "error", Error: "message too large"})
+				continue
+			}
+			break
+		}
+
+		handle(msg)
+	}
+
+	c.Close("")
+	<-written
+}
+
+func (c *Client) write() {
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+
+	defer c.conn.Close()
+
+	for {
+		select {
+		case msg := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := websocket.JSON.Send(c.conn, msg); err != nil {
+				c.Close("")
+				return
+			}
+		case <-ping.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			c.conn.PayloadType = websocket.PingFrame
+			_, err := c.conn.Write(nil)
+			c.conn.PayloadType = websocket.TextFrame
+			if err != nil {
+				c.Close("")
+				return
+			}
+		case <-c.done:
+			if c.reason != "" {
+				c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+				websocket.JSON.Send(c.conn, Message{Type: "close", Error: c.reason})
+			}
+			return
+		}
+	}
+}
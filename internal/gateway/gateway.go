@@ -0,0 +1,63 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	// MaxMessageBytes bounds the messages clients send.
+	MaxMessageBytes = 4096
+	// MaxTopics bounds the topics a connection subscribes to.
+	MaxTopics = 50
+	// sendBuffer is how many messages a connection may fall behind before
+	// it's evicted as a slow consumer.
+	sendBuffer = 256
+	// writeTimeout bounds the time spent writing one message.
+	writeTimeout = time.Second * 10
+	// readTimeout closes connections that stay silent, clients send a ping
+	// message more often than that.
+	readTimeout = time.Second * 60
+	// pingInterval keeps proxies from closing idle connections.
+	pingInterval = time.Second * 25
+	// PresenceTTL is how long a member stays listed in a topic without its
+	// instance confirming it's still there.
+	PresenceTTL = time.Second * 90
+)
+
+var (
+	ErrClosed        = errors.New("gateway is shutting down")
+	ErrTooManyTopics = errors.New("too many subscriptions")
+)
+
+// Message is exchanged with clients as JSON and relayed between instances.
+// Sender is the user behind the message, zero for the server itself.
+type Message struct {
+	Type   string          `json:"type"`
+	Topic  string          `json:"topic,omitempty"`
+	ID     string          `json:"id,omitempty"`
+	Sender int64           `json:"sender,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// Envelope is a message relayed to the subscribers of a topic.
+type Envelope struct {
+	Topic   string
+	Message Message
+}
+
+// Relay carries topic messages and presence between the instances of the API.
+type Relay interface {
+	Publish(ctx context.Context, topic string, msg Message) error
+	// Subscribe starts receiving the messages of topic on Receive.
+	Subscribe(ctx context.Context, topic string) error
+	Unsubscribe(ctx context.Context, topic string) error
+	Receive() <-chan Envelope
+	// Join lists userID as a member of topic for PresenceTTL.
+	Join(ctx context.Context, topic string, userID int64) error
+	Leave(ctx context.Context, topic string, userID int64) error
+	Members(ctx context.Context, topic string) ([]int64, error)
+}
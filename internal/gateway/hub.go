@@ -0,0 +1,249 @@
+package gateway
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+)
+
+// Hub tracks the connections of this instance and the topics they
+// subscribe to, relaying topic messages to and from the other instances.
+type Hub struct {
+	relay  Relay
+	logger *zap.SugaredLogger
+	// deliver decides whether a topic message goes to a client
+	deliver func(c *Client, msg Message) bool
+
+	mu      sync.Mutex
+	topics  map[string]map[*Client]struct{}
+	clients map[*Client]struct{}
+	closing bool
+	wg      sync.WaitGroup
+}
+
+func NewHub(relay Relay, logger *zap.SugaredLogger, deliver func(c *Client, msg Message) bool) *Hub {
+	h := &Hub{
+		relay:   relay,
+		logger:  logger,
+		deliver: deliver,
+		topics:  make(map[string]map[*Client]struct{}),
+		clients: make(map[*Client]struct{}),
+	}
+
+	go h.receive()
+	go h.keepPresence()
+
+	return h
+}
+
+// Connect registers the connection of userID. Every client must be
+// disconnected once its Run returns.
+func (h *Hub) Connect(conn *websocket.Conn, userID int64) (*Client, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closing {
+		return nil, ErrClosed
+	}
+
+	c := newClient(conn, userID)
+	h.clients[c] = struct{}{}
+	h.wg.Add(1)
+
+	return c, nil
+}
+
+// Disconnect unsubscribes c from every topic, returning those its user
+// left, and unregisters it.
+func (h *Hub) Disconnect(ctx context.Context, c *Client) []string {
+	h.mu.Lock()
+	topics := make([]string, 0, len(c.topics))
+	for topic := range c.topics {
+		topics = append(topics, topic)
+	}
+	h.mu.Unlock()
+
+	var left []string
+	for _, topic := range topics {
+		if h.Unsubscribe(ctx, c, topic) {
+			left = append(left, topic)
+		}
+	}
+
+	h.mu.Lock()
+	delete(h.clients, c)
+	h.mu.Unlock()
+
+	h.wg.Done()
+
+	return left
+}
+
+// Subscribe adds c to topic. joined reports whether its user wasn't in the
+// topic through another connection of this instance.
+func (h *Hub) Subscribe(ctx context.Context, c *Client, topic string) (joined bool, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := c.topics[topic]; ok {
+		return false, nil
+	}
+
+	if len(c.topics) >= MaxTopics {
+		return false, ErrTooManyTopics
+	}
+
+	if len(h.topics[topic]) == 0 {
+		if err := h.relay.Subscribe(ctx, topic); err != nil {
+			return false, err
+		}
+		h.topics[topic] = make(map[*Client]struct{})
+	}
+
+	joined = !h.hasUser(topic, c.UserID)
+
+	h.topics[topic][c] = struct{}{}
+	c.topics[topic] = struct{}{}
+
+	if err := h.relay.Join(ctx, topic, c.UserID); err != nil {
+		h.logger.Errorw("error joining topic", "topic", topic, "user", c.UserID, "error", err)
+	}
+
+	return joined, nil
+}
+
+// Unsubscribe removes c from topic. left reports whether its user has no
+// other connection of this instance in the topic.
+func (h *Hub) Unsubscribe(ctx context.Context, c *Client, topic string) (left bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := c.topics[topic]; !ok {
+		return false
+	}
+
+	delete(c.topics, topic)
+	delete(h.topics[topic], c)
+
+	if len(h.topics[topic]) == 0 {
+		delete(h.topics, topic)
+		if err := h.relay.Unsubscribe(ctx, topic); err != nil {
+			h.logger.Errorw("error unsubscribing from topic", "topic", topic, "error", err)
+		}
+	}
+
+	if h.hasUser(topic, c.UserID) {
+		return false
+	}
+
+	if err := h.relay.Leave(ctx, topic, c.UserID); err != nil {
+		h.logger.Errorw("error leaving topic", "topic", topic, "user", c.UserID, "error", err)
+	}
+
+	return true
+}
+
+// Subscribed reports whether c is subscribed to topic.
+func (h *Hub) Subscribed(c *Client, topic string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, ok := c.topics[topic]
+	return ok
+}
+
+// Publish sends msg to the subscribers of topic on every instance.
+func (h *Hub) Publish(ctx context.Context, topic string, msg Message) error {
+	msg.Topic = topic
+	return h.relay.Publish(ctx, topic, msg)
+}
+
+// Members lists the users in topic across every instance.
+func (h *Hub) Members(ctx context.Context, topic string) ([]int64, error) {
+	return h.relay.Members(ctx, topic)
+}
+
+// Shutdown refuses new connections, closes the open ones and waits for them
+// to be disconnected or for ctx to end.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	h.closing = true
+	for c := range h.clients {
+		c.Close("server shutting down")
+	}
+	h.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// hasUser must be called with mu held.
+func (h *Hub) hasUser(topic string, userID int64) bool {
+	for c := range h.topics[topic] {
+		if c.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Hub) receive() {
+	for env := range h.relay.Receive() {
+		h.mu.Lock()
+		for c := range h.topics[env.Topic] {
+			if h.deliver(c, env.Message) {
+				c.Send(env.Message)
+			}
+		}
+		h.mu.Unlock()
+	}
+}
+
+// keepPresence renews the membership of the users connected to this
+// instance before it expires.
+func (h *Hub) keepPresence() {
+	ticker := time.NewTicker(PresenceTTL / 3)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		type member struct {
+			topic  string
+			userID int64
+		}
+
+		h.mu.Lock()
+		var members []member
+		for topic, clients := range h.topics {
+			seen := make(map[int64]bool)
+			for c := range clients {
+				if !seen[c.UserID] {
+					seen[c.UserID] = true
+					members = append(members, member{topic, c.UserID})
+				}
+			}
+		}
+		h.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		for _, m := range members {
+			if err := h.relay.Join(ctx, m.topic, m.userID); err != nil {
+				h.logger.Errorw("error renewing presence", "topic", m.topic, "error", err)
+				break
+			}
+		}
+		cancel()
+	}
+}
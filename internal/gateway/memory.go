@@ -0,0 +1,96 @@
+package gateway
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryRelay keeps topics within the instance, for running without Redis.
+type MemoryRelay struct {
+	messages chan Envelope
+
+	mu         sync.Mutex
+	subscribed map[string]bool
+	members    map[string]map[int64]bool
+}
+
+func NewMemoryRelay() *MemoryRelay {
+	return &MemoryRelay{
+		messages:   make(chan Envelope, sendBuffer),
+		subscribed: make(map[string]bool),
+		members:    make(map[string]map[int64]bool),
+	}
+}
+
+func (r *MemoryRelay) Publish(ctx context.Context, topic string, msg Message) error {
+	r.mu.Lock()
+	subscribed := r.subscribed[topic]
+	r.mu.Unlock()
+
+	if !subscribed {
+		return nil
+	}
+
+	select {
+	case r.messages <- Envelope{Topic: topic, Message: msg}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *MemoryRelay) Subscribe(ctx context.Context, topic string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.subscribed[topic] = true
+	return nil
+}
+
+func (r *MemoryRelay) Unsubscribe(ctx context.Context, topic string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.subscribed, topic)
+	return nil
+}
+
+func (r *MemoryRelay) Receive() <-chan Envelope {
+	return r.messages
+}
+
+func (r *MemoryRelay) Join(ctx context.Context, topic string, userID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.members[topic] == nil {
+		r.members[topic] = make(map[int64]bool)
+	}
+	r.members[topic][userID] = true
+
+	return nil
+}
+
+func (r *MemoryRelay) Leave(ctx context.Context, topic string, userID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.members[topic], userID)
+	if len(r.members[topic]) == 0 {
+		delete(r.members, topic)
+	}
+
+	return nil
+}
+
+func (r *MemoryRelay) Members(ctx context.Context, topic string) ([]int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make([]int64, 0, len(r.members[topic]))
+	for id := range r.members[topic] {
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
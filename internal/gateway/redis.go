@@ -0,0 +1,112 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const channelPrefix = "gateway-"
+
+// RedisRelay shares topics between instances over a single pub/sub
+// connection per instance. Members of a topic are kept in a sorted set
+// scored by the time their membership expires.
+type RedisRelay struct {
+	rdb      *redis.Client
+	pubsub   *redis.PubSub
+	messages chan Envelope
+	logger   *zap.SugaredLogger
+}
+
+func NewRedisRelay(rdb *redis.Client, logger *zap.SugaredLogger) *RedisRelay {
+	r := &RedisRelay{
+		rdb:      rdb,
+		pubsub:   rdb.Subscribe(context.Background()),
+		messages: make(chan Envelope, sendBuffer),
+		logger:   logger,
+	}
+
+	go r.receive()
+
+	return r
+}
+
+func presenceKey(topic string) string {
+	return "gateway-presence-" + topic
+}
+
+func (r *RedisRelay) Publish(ctx context.Context, topic string, msg Message) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	return r.rdb.Publish(ctx, channelPrefix+topic, payload).Err()
+}
+
+func (r *RedisRelay) Subscribe(ctx context.Context, topic string) error {
+	return r.pubsub.Subscribe(ctx, channelPrefix+topic)
+}
+
+func (r *RedisRelay) Unsubscribe(ctx context.Context, topic string) error {
+	return r.pubsub.Unsubscribe(ctx, channelPrefix+topic)
+}
+
+func (r *RedisRelay) Receive() <-chan Envelope {
+	return r.messages
+}
+
+func (r *RedisRelay) Join(ctx context.Context, topic string, userID int64) error {
+	now := time.Now()
+	key := presenceKey(topic)
+
+	pipe := r.rdb.Pipeline()
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.Add(PresenceTTL).Unix()), Member: userID})
+	pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(now.Unix(), 10))
+	pipe.Expire(ctx, key, PresenceTTL)
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+func (r *RedisRelay) Leave(ctx context.Context, topic string, userID int64) error {
+	return r.rdb.ZRem(ctx, presenceKey(topic), userID).Err()
+}
+
+func (r *RedisRelay) Members(ctx context.Context, topic string) ([]int64, error) {
+	members, err := r.rdb.ZRangeByScore(ctx, presenceKey(topic), &redis.ZRangeBy{
+		Min: "(" + strconv.FormatInt(time.Now().Unix(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, 0, len(members))
+	for _, m := range members {
+		id, err := strconv.ParseInt(m, 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func (r *RedisRelay) receive() {
+	for msg := range r.pubsub.Channel() {
+		var m Message
+		if err := json.Unmarshal([]byte(msg.Payload), &m); err != nil {
+			r.logger.Errorw("error decoding gateway message", "channel", msg.Channel, "error", err)
+			continue
+		}
+
+		r.messages <- Envelope{Topic: strings.TrimPrefix(msg.Channel, channelPrefix), Message: m}
+	}
+}
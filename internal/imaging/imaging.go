@@ -0,0 +1,126 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"io"
+
+	// registered decoders for the formats accepted on upload
+	_ "image/gif"
+	_ "image/png"
+)
+
+const (
+	// MaxPixels protects the decoder against decompression bombs.
+	MaxPixels   = 40_000_000
+	JpegQuality = 85
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format, use jpeg, png or gif")
+	ErrTooLarge          = errors.New("image dimensions are too large")
+)
+
+var allowedFormats = map[string]bool{
+	"jpeg": true,
+	"png":  true,
+	"gif":  true,
+}
+
+// Decode reads an uploaded image after checking its real format from the
+// file header, whatever extension or content type the client announced.
+// Only pixels are kept, so EXIF and other metadata never survive a re-encode.
+func Decode(r io.Reader) (*image.RGBA, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || !allowedFormats[format] {
+		return nil, ErrUnsupportedFormat
+	}
+
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	return rgba, nil
+}
+
+// Thumbnail crops the centre of src to the width/height ratio and scales it
+// to exactly width x height.
+func Thumbnail(src *image.RGBA, width, height int) *image.RGBA {
+	b := src.Bounds()
+
+	crop := b
+	if b.Dx()*height > b.Dy()*width {
+		w := b.Dy() * width / height
+		crop.Min.X = b.Min.X + (b.Dx()-w)/2
+		crop.Max.X = crop.Min.X + w
+	} else {
+		h := b.Dx() * height / width
+		crop.Min.Y = b.Min.Y + (b.Dy()-h)/2
+		crop.Max.Y = crop.Min.Y + h
+	}
+
+	return resize(src, crop, width, height)
+}
+
+// resize scales the area of src to width x height averaging every source
+// pixel covered by a destination pixel (box filter), falling back to the
+// nearest pixel when upscaling.
+func resize(src *image.RGBA, area image.Rectangle, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		sy0 := area.Min.Y + y*area.Dy()/height
+		sy1 := max(area.Min.Y+(y+1)*area.Dy()/height, sy0+1)
+
+		for x := 0; x < width; x++ {
+			sx0 := area.Min.X + x*area.Dx()/width
+			sx1 := max(area.Min.X+(x+1)*area.Dx()/width, sx0+1)
+
+			var r, g, bl, a, n uint32
+			for sy := sy0; sy < sy1; sy++ {
+				i := src.PixOffset(sx0, sy)
+				for sx := sx0; sx < sx1; sx++ {
+					r += uint32(src.Pix[i])
+					g += uint32(src.Pix[i+1])
+					bl += uint32(src.Pix[i+2])
+					a += uint32(src.Pix[i+3])
+					n++
+					i += 4
+				}
+			}
+
+			j := dst.PixOffset(x, y)
+			dst.Pix[j] = uint8(r / n)
+			dst.Pix[j+1] = uint8(g / n)
+			dst.Pix[j+2] = uint8(bl / n)
+			dst.Pix[j+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
+
+// EncodeJPEG flattens img on a white background, JPEG has no transparency.
+func EncodeJPEG(w io.Writer, img *image.RGBA) error {
+	flat := image.NewRGBA(img.Bounds())
+	draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+
+	return jpeg.Encode(w, flat, &jpeg.Options{Quality: JpegQuality})
+}
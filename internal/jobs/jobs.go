@@ -0,0 +1,56 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+
+	"github.com/wesleybruno/golang-monolito/internal/mailer"
+	"github.com/wesleybruno/golang-monolito/internal/store"
+)
+
+const (
+	KindSendEmail = "email.send"
+)
+
+// Email is the payload of KindSendEmail jobs, sending a mailer template.
+type Email struct {
+	Template string         `json:"template"`
+	Username string         `json:"username"`
+	Email    string         `json:"email"`
+	Data     map[string]any `json:"data"`
+}
+
+func NewEmail(template, username, email string, data map[string]any) (*store.Job, error) {
+	return store.NewJob(KindSendEmail, Email{Template: template, Username: username, Email: email, Data: data})
+}
+
+// SendEmail returns the handler of KindSendEmail jobs. Outside production the
+// mailer runs in sandbox mode.
+func SendEmail(client mailer.Client, isSandbox bool) HandlerFunc {
+	return func(ctx context.Context, job *store.Job) error {
+		var email Email
+		if err := Decode(job, &email); err != nil {
+			return err
+		}
+
+		_, err := client.Send(email.Template, email.Username, email.Email, email.Data, isSandbox)
+		return err
+	}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying, dead-lettering the job right away.
+func Permanent(err error) error {
+	return &permanentError{err}
+}
+
+func isPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
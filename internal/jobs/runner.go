@@ -0,0 +1,196 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/wesleybruno/golang-monolito/internal/store"
+)
+
+// HandlerFunc runs a job. An error schedules a retry, unless it's Permanent
+// or the job ran out of attempts: then the job is dead-lettered.
+type HandlerFunc func(ctx context.Context, job *store.Job) error
+
+// Queue is where the runner claims jobs and records their outcome.
+type Queue interface {
+	Claim(ctx context.Context, kinds []string, limit int, visibility time.Duration) ([]*store.Job, error)
+	Complete(ctx context.Context, job *store.Job) error
+	Fail(ctx context.Context, job *store.Job, reason string, retryAt *time.Time) error
+}
+
+type Config struct {
+	Workers int
+	// PollInterval is how long an idle runner waits before looking for jobs again
+	PollInterval time.Duration
+	// Visibility is how long a claimed job is hidden from other workers,
+	// bounding how long a handler can run
+	Visibility time.Duration
+	// retries wait Backoff, doubling after each failure up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+var DefaultConfig = Config{
+	Workers:      4,
+	PollInterval: time.Second,
+	Visibility:   time.Minute * 5,
+	Backoff:      time.Second * 10,
+	MaxBackoff:   time.Hour,
+}
+
+// Runner claims jobs from a queue and runs them on a pool of workers.
+type Runner struct {
+	queue    Queue
+	logger   *zap.SugaredLogger
+	cfg      Config
+	handlers map[string]HandlerFunc
+}
+
+func NewRunner(queue Queue, logger *zap.SugaredLogger, cfg Config) *Runner {
+	return &Runner{
+		queue:    queue,
+		logger:   logger,
+		cfg:      cfg,
+		handlers: make(map[string]HandlerFunc),
+	}
+}
+
+// Handle registers fn for the jobs of kind. Only registered kinds are claimed.
+func (r *Runner) Handle(kind string, fn HandlerFunc) {
+	r.handlers[kind] = fn
+}
+
+// Run works until ctx is done, then waits for the running jobs to finish.
+func (r *Runner) Run(ctx context.Context) error {
+	kinds := make([]string, 0, len(r.handlers))
+	for kind := range r.handlers {
+		kinds = append(kinds, kind)
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	sem := make(chan struct{}, r.cfg.Workers)
+	// freed wakes the runner up when a worker becomes available
+	freed := make(chan struct{}, 1)
+
+	for {
+		free := r.cfg.Workers - len(sem)
+
+		var claimed int
+		if free > 0 {
+			jobs, err := r.queue.Claim(ctx, kinds, free, r.cfg.Visibility)
+			if err != nil && ctx.Err() == nil {
+				r.logger.Errorw("error claiming jobs", "error", err)
+			}
+
+			claimed = len(jobs)
+			for _, job := range jobs {
+				sem <- struct{}{}
+				wg.Add(1)
+
+				go func(job *store.Job) {
+					defer wg.Done()
+					defer func() {
+						<-sem
+						select {
+						case freed <- struct{}{}:
+						default:
+						}
+					}()
+
+					r.run(job)
+				}(job)
+			}
+		}
+
+		// a full batch means more jobs may be waiting
+		if free > 0 && claimed == free {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-freed:
+			if claimed == 0 && free > 0 {
+				continue
+			}
+		case <-time.After(r.cfg.PollInterval):
+		}
+	}
+}
+
+// run runs job to completion, even when the runner is stopping: its lease
+// bounds how long that takes.
+func (r *Runner) run(job *store.Job) {
+	start := time.Now()
+	err := r.call(job)
+
+	// the outcome is recorded even when the handler used up its lease
+	ctx := context.Background()
+
+	if err == nil {
+		if err := r.queue.Complete(ctx, job); err != nil {
+			r.logger.Errorw("error completing job", "job", job.ID, "kind", job.Kind, "error", err)
+			return
+		}
+		r.logger.Infow("job completed", "job", job.ID, "kind", job.Kind, "attempt", job.Attempts, "duration", time.Since(start).String())
+		return
+	}
+
+	var retryAt *time.Time
+	if !isPermanent(err) && job.Attempts < job.MaxAttempts {
+		at := time.Now().Add(backoff(job.Attempts, r.cfg.Backoff, r.cfg.MaxBackoff))
+		retryAt = &at
+	}
+
+	if recordErr := r.queue.Fail(ctx, job, err.Error(), retryAt); recordErr != nil {
+		r.logger.Errorw("error recording job failure", "job", job.ID, "kind", job.Kind, "error", recordErr)
+		return
+	}
+
+	if retryAt == nil {
+		r.logger.Errorw("job dead-lettered", "job", job.ID, "kind", job.Kind, "attempts", job.Attempts, "error", err)
+		return
+	}
+
+	r.logger.Warnw("job failed, retrying", "job", job.ID, "kind", job.Kind, "attempt", job.Attempts, "retry_at", retryAt, "error", err)
+}
+
+// call runs the handler of job within its lease, turning panics into errors.
+func (r *Runner) call(job *store.Job) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.Visibility)
+	defer cancel()
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("job panicked: %v", rec)
+		}
+	}()
+
+	return r.handlers[job.Kind](ctx, job)
+}
+
+// Decode unmarshals the payload of job into v. A payload that can't be
+// decoded never will be, so the error is Permanent.
+func Decode(job *store.Job, v any) error {
+	if err := json.Unmarshal(job.Payload, v); err != nil {
+		return Permanent(fmt.Errorf("decoding %s payload: %w", job.Kind, err))
+	}
+	return nil
+}
+
+// backoff is the delay before retrying a job that failed attempt times.
+func backoff(attempt int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	return min(delay, max)
+}
@@ -3,13 +3,22 @@ package mailer
 import "embed"
 
 const (
-	FromName            = "GoApi"
-	MaxRetries          = 3
-	UserWelcomeTemplate = "user_invitation.tmpl"
+	FromName                  = "GoApi"
+	MaxRetries                = 3
+	UserWelcomeTemplate       = "user_invitation.tmpl"
+	EmailChangeTemplate       = "email_change_confirm.tmpl"
+	EmailChangeNoticeTemplate = "email_change_notice.tmpl"
+	DataExportTemplate        = "data_export.tmpl"
+	PasswordResetTemplate     = "password_reset.tmpl"
+	NotificationTemplate      = "notification.tmpl"
+	DigestTemplate            = "notification_digest.tmpl"
 )
 
+//go:embed "templates"
 var FS embed.FS
 
 type Client interface {
 	Send(templateFile, username, email string, data any, isSandbox bool) (int, error)
+	// SendWithHeaders sends like Send, adding headers such as List-Unsubscribe.
+	SendWithHeaders(templateFile, username, email string, data any, headers map[string]string, isSandbox bool) (int, error)
 }
@@ -29,6 +29,10 @@ func NewSendGrid(apiKey, fromEmail string) *SendGridMailer {
 }
 
 func (m SendGridMailer) Send(templateFile, username, email string, data any, isSandbox bool) (int, error) {
+	return m.SendWithHeaders(templateFile, username, email, data, nil, isSandbox)
+}
+
+func (m SendGridMailer) SendWithHeaders(templateFile, username, email string, data any, headers map[string]string, isSandbox bool) (int, error) {
 
 	if isSandbox {
 		return 0, nil
@@ -55,6 +59,9 @@ func (m SendGridMailer) Send(templateFile, username, email string, data any, isS
 	}
 
 	message := mail.NewSingleEmail(from, subject.String(), to, "", body.String())
+	for key, value := range headers {
+		message.SetHeader(key, value)
+	}
 
 	message.SetMailSettings(&mail.MailSettings{
 		SandboxMode: &mail.Setting{
@@ -0,0 +1,235 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/wesleybruno/golang-monolito/internal/store"
+)
+
+var (
+	ErrUnknownJob = errors.New("unknown scheduled job")
+	ErrJobRunning = errors.New("job is already running")
+)
+
+// Func is the work of a scheduled job.
+type Func func(ctx context.Context) error
+
+// Store holds the locks and the run history of scheduled jobs.
+type Store interface {
+	TryLock(ctx context.Context, name string) (func(), bool, error)
+	StartRun(ctx context.Context, run *store.ScheduledRun) (bool, error)
+	FinishRun(ctx context.Context, run *store.ScheduledRun) error
+}
+
+// Job describes a registered job.
+type Job struct {
+	Name     string    `json:"name"`
+	Schedule string    `json:"schedule"`
+	Timeout  string    `json:"timeout"`
+	NextRun  time.Time `json:"next_run"`
+}
+
+type entry struct {
+	name     string
+	schedule *Schedule
+	timeout  time.Duration
+	fn       Func
+}
+
+// Scheduler runs jobs on cron schedules. Every instance of the app runs one:
+// a job's advisory lock keeps its runs from overlapping and its run history
+// makes each tick run on a single instance.
+type Scheduler struct {
+	store    Store
+	logger   *zap.SugaredLogger
+	instance string
+	entries  map[string]*entry
+	wg       sync.WaitGroup
+}
+
+func New(store Store, logger *zap.SugaredLogger, instance string) *Scheduler {
+	return &Scheduler{
+		store:    store,
+		logger:   logger,
+		instance: instance,
+		entries:  make(map[string]*entry),
+	}
+}
+
+// Register adds the job name, run by fn on the cron spec for at most timeout.
+func (s *Scheduler) Register(name, spec string, timeout time.Duration, fn Func) error {
+	if _, ok := s.entries[name]; ok {
+		return fmt.Errorf("scheduled job %q registered twice", name)
+	}
+
+	schedule, err := Parse(spec)
+	if err != nil {
+		return err
+	}
+
+	s.entries[name] = &entry{name: name, schedule: schedule, timeout: timeout, fn: fn}
+	return nil
+}
+
+// Jobs lists the registered jobs by name.
+func (s *Scheduler) Jobs() []Job {
+	now := time.Now()
+
+	jobs := make([]Job, 0, len(s.entries))
+	for _, e := range s.entries {
+		jobs = append(jobs, Job{
+			Name:     e.name,
+			Schedule: e.schedule.String(),
+			Timeout:  e.timeout.String(),
+			NextRun:  e.schedule.Next(now),
+		})
+	}
+
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+	return jobs
+}
+
+// Run runs the jobs on their schedules until ctx is done, then waits for the
+// running ones to finish.
+func (s *Scheduler) Run(ctx context.Context) {
+	for _, e := range s.entries {
+		s.wg.Add(1)
+		go func(e *entry) {
+			defer s.wg.Done()
+			s.loop(ctx, e)
+		}(e)
+	}
+
+	<-ctx.Done()
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, e *entry) {
+	for {
+		next := e.schedule.Next(time.Now())
+		if next.IsZero() {
+			s.logger.Warnw("scheduled job never runs", "job", e.name, "schedule", e.schedule.String())
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		run, unlock, err := s.begin(ctx, e, &store.ScheduledRun{ScheduledFor: &next})
+		switch {
+		case errors.Is(err, ErrJobRunning):
+			s.logger.Infow("scheduled job skipped, still running", "job", e.name, "tick", next)
+			continue
+		case err != nil:
+			s.logger.Errorw("error starting scheduled job", "job", e.name, "error", err)
+			continue
+		case run == nil:
+			// another instance ran this tick
+			continue
+		}
+
+		s.execute(e, run, unlock)
+	}
+}
+
+// Trigger runs the job name now, out of its schedule, on behalf of an admin.
+// It returns once the run started, failing with ErrJobRunning when the job
+// is running somewhere.
+func (s *Scheduler) Trigger(ctx context.Context, name string, triggeredBy int64) (*store.ScheduledRun, error) {
+	e, ok := s.entries[name]
+	if !ok {
+		return nil, ErrUnknownJob
+	}
+
+	run, unlock, err := s.begin(ctx, e, &store.ScheduledRun{TriggeredBy: &triggeredBy})
+	if err != nil {
+		return nil, err
+	}
+
+	started := *run
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.execute(e, run, unlock)
+	}()
+
+	return &started, nil
+}
+
+// begin takes the lock of e and records the start of run. A nil run means
+// the tick already ran on another instance.
+func (s *Scheduler) begin(ctx context.Context, e *entry, run *store.ScheduledRun) (*store.ScheduledRun, func(), error) {
+	unlock, locked, err := s.store.TryLock(ctx, e.name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !locked {
+		return nil, nil, ErrJobRunning
+	}
+
+	run.Name = e.name
+	run.Instance = s.instance
+
+	started, err := s.store.StartRun(ctx, run)
+	if err != nil || !started {
+		unlock()
+		return nil, nil, err
+	}
+
+	return run, unlock, nil
+}
+
+// execute runs e to completion and records the outcome, even when the
+// scheduler is stopping: the timeout of e bounds how long that takes.
+func (s *Scheduler) execute(e *entry, run *store.ScheduledRun, unlock func()) {
+	defer unlock()
+
+	start := time.Now()
+	err := s.call(e)
+
+	duration := time.Since(start).Milliseconds()
+	run.DurationMs = &duration
+	run.Status = store.RunSucceeded
+	if err != nil {
+		run.Status = store.RunFailed
+		run.Error = err.Error()
+	}
+
+	if err := s.store.FinishRun(context.Background(), run); err != nil {
+		s.logger.Errorw("error recording scheduled job run", "job", e.name, "run", run.ID, "error", err)
+	}
+
+	if err != nil {
+		s.logger.Errorw("scheduled job failed", "job", e.name, "run", run.ID, "duration", time.Since(start).String(), "error", err)
+		return
+	}
+
+	s.logger.Infow("scheduled job completed", "job", e.name, "run", run.ID, "duration", time.Since(start).String())
+}
+
+// call runs the function of e within its timeout, turning panics into errors.
+func (s *Scheduler) call(e *entry) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("job panicked: %v", rec)
+		}
+	}()
+
+	return e.fn(ctx)
+}
@@ -0,0 +1,206 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PurgedAccount lists the files that belonged to a purged account, they live
+// outside of the database and are removed by the caller.
+type PurgedAccount struct {
+	UserID      int64
+	Avatar      ImageSet
+	Banner      ImageSet
+	ExportFiles []string
+}
+
+func (s *UserStore) ScheduleDeletion(ctx context.Context, id int64, at time.Time) error {
+	query := `UPDATE users SET deletion_scheduled_at = $1 WHERE id = $2 AND deleted_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, at, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *UserStore) CancelDeletion(ctx context.Context, id int64) error {
+	query := `UPDATE users SET deletion_scheduled_at = NULL WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// GetDueDeletions returns the accounts whose grace period ended before now.
+func (s *UserStore) GetDueDeletions(ctx context.Context, now time.Time, limit int) ([]int64, error) {
+	query := `
+		SELECT id
+		FROM users
+		WHERE deletion_scheduled_at <= $1 AND deleted_at IS NULL
+		ORDER BY deletion_scheduled_at
+		LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// Purge deletes an account whose deletion is due, all inside one
+// transaction. With anonymize the user's posts and comments are kept under a
+// placeholder identity, otherwise they are removed with the account.
+func (s *UserStore) Purge(ctx context.Context, id int64, anonymize bool) (*PurgedAccount, error) {
+	purged := &PurgedAccount{UserID: id}
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+
+		ctx, cancel := context.WithTimeout(ctx, TimeOutTime)
+		defer cancel()
+
+		// lock the row so a login cancelling the deletion waits for us, or wins
+		query := `
+			SELECT avatar, banner
+			FROM users
+			WHERE id = $1 AND deletion_scheduled_at IS NOT NULL AND deleted_at IS NULL
+			FOR UPDATE
+		`
+
+		err := tx.QueryRowContext(ctx, query, id).Scan(&purged.Avatar, &purged.Banner)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		rows, err := tx.QueryContext(ctx, `SELECT file_key FROM data_exports WHERE user_id = $1 AND file_key IS NOT NULL`, id)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var key string
+			if err := rows.Scan(&key); err != nil {
+				rows.Close()
+				return err
+			}
+			purged.ExportFiles = append(purged.ExportFiles, key)
+		}
+		rows.Close()
+
+		if !anonymize {
+			if err := s.deleteContent(ctx, tx, id); err != nil {
+				return err
+			}
+
+			if err := s.delete(ctx, tx, id); err != nil {
+				return err
+			}
+
+			return s.deleteUserInvitations(ctx, tx, id)
+		}
+
+		return s.anonymize(ctx, tx, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return purged, nil
+}
+
+// deleteContent removes the posts and comments of a user, including the
+// comments other users left on those posts.
+func (s *UserStore) deleteContent(ctx context.Context, tx *sql.Tx, id int64) error {
+	queries := []string{
+		`DELETE FROM comments WHERE user_id = $1 OR post_id IN (SELECT id FROM posts WHERE user_id = $1)`,
+		`DELETE FROM posts WHERE user_id = $1`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// anonymize keeps the user row, so content stays consistent, but wipes
+// everything that identifies the person and every relationship.
+func (s *UserStore) anonymize(ctx context.Context, tx *sql.Tx, id int64) error {
+	queries := []string{
+		`UPDATE users
+		SET
+			username = 'deleted-' || id,
+			email = 'deleted-' || id || '@deleted.invalid',
+			password = '',
+			display_name = '',
+			bio = '',
+			avatar = NULL,
+			banner = NULL,
+			is_active = false,
+			is_private = false,
+			deletion_scheduled_at = NULL,
+			deleted_at = NOW()
+		WHERE id = $1`,
+		`DELETE FROM followers WHERE user_id = $1 OR follower_id = $1`,
+		`DELETE FROM follow_requests WHERE requester_id = $1 OR target_id = $1`,
+		`DELETE FROM user_blocks WHERE blocker_id = $1 OR blocked_id = $1`,
+		`DELETE FROM user_mutes WHERE user_id = $1 OR muted_id = $1`,
+		`DELETE FROM post_reactions WHERE user_id = $1`,
+		`DELETE FROM tag_follows WHERE user_id = $1`,
+		`DELETE FROM notifications WHERE user_id = $1`,
+		`DELETE FROM notification_actors WHERE actor_id = $1`,
+		`DELETE FROM notification_preferences WHERE user_id = $1`,
+		`DELETE FROM conversation_participants WHERE user_id = $1`,
+		`DELETE FROM webhooks WHERE user_id = $1`,
+		`DELETE FROM user_password_resets WHERE user_id = $1`,
+		`DELETE FROM user_email_changes WHERE user_id = $1`,
+		`DELETE FROM data_exports WHERE user_id = $1`,
+		`DELETE FROM user_invitation WHERE user_id = $1`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
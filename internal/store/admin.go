@@ -0,0 +1,257 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	UserStatusActive          = "active"
+	UserStatusInactive        = "inactive"
+	UserStatusPendingDeletion = "pending_deletion"
+	UserStatusDeleted         = "deleted"
+)
+
+type AdminUserQuery struct {
+	Limit    int    `json:"limit" validate:"gte=1,lte=100"`
+	Offset   int    `json:"offset" validate:"gte=0"`
+	Email    string `json:"email" validate:"max=255"`
+	Username string `json:"username" validate:"max=100"`
+	Status   string `json:"status" validate:"omitempty,oneof=active inactive pending_deletion deleted"`
+	TimeRange
+}
+
+func (aq AdminUserQuery) Parse(r *http.Request) (AdminUserQuery, error) {
+
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return aq, err
+		}
+
+		aq.Limit = l
+	}
+
+	offset := qs.Get("offset")
+	if offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return aq, err
+		}
+
+		aq.Offset = o
+	}
+
+	aq.Email = qs.Get("email")
+	aq.Username = qs.Get("username")
+	aq.Status = qs.Get("status")
+
+	tr, err := ParseTimeRange(qs, time.Now())
+	if err != nil {
+		return aq, err
+	}
+	aq.TimeRange = tr
+
+	return aq, nil
+}
+
+var userStatusFilters = map[string]string{
+	UserStatusActive:          "u.is_active AND u.deleted_at IS NULL AND u.deletion_scheduled_at IS NULL",
+	UserStatusInactive:        "NOT u.is_active AND u.deleted_at IS NULL",
+	UserStatusPendingDeletion: "u.deletion_scheduled_at IS NOT NULL",
+	UserStatusDeleted:         "u.deleted_at IS NOT NULL",
+}
+
+// Search lists users for the admin tooling, newest first.
+func (s *UserStore) Search(ctx context.Context, aq AdminUserQuery) ([]*User, error) {
+
+	qb := newQueryBuilder().
+		WhereTimeRange("u.created_at", aq.TimeRange)
+
+	if aq.Email != "" {
+		qb.Where("u.email ILIKE '%' || ? || '%'", likeEscaper.Replace(aq.Email))
+	}
+	if aq.Username != "" {
+		qb.Where("u.username ILIKE '%' || ? || '%'", likeEscaper.Replace(aq.Username))
+	}
+	if filter, ok := userStatusFilters[aq.Status]; ok {
+		qb.Where(filter)
+	}
+
+	query := `
+		SELECT
+			u.id, u.username, u.display_name, u.email, u.created_at, u.is_active, u.is_private,
+			u.password_reset_required, u.deletion_scheduled_at, u.role_id, r.name, r.level
+		FROM users u
+		JOIN roles r ON r.id = u.role_id
+		WHERE
+			` + qb.Conditions() + `
+		ORDER BY u.id DESC
+		LIMIT ` + qb.Arg(aq.Limit) + ` OFFSET ` + qb.Arg(aq.Offset) + `
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, qb.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		var u User
+		err := rows.Scan(
+			&u.ID,
+			&u.Username,
+			&u.DisplayName,
+			&u.Email,
+			&u.CreatedAt,
+			&u.IsActive,
+			&u.IsPrivate,
+			&u.PasswordResetRequired,
+			&u.DeletionScheduledAt,
+			&u.RoleID,
+			&u.Role.Name,
+			&u.Role.Level,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		u.Role.ID = u.RoleID
+		users = append(users, &u)
+	}
+
+	return users, rows.Err()
+}
+
+func (s *UserStore) SetRole(ctx context.Context, id int64, roleID int64) error {
+	query := `UPDATE users SET role_id = $1 WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, roleID, id)
+	if err != nil {
+		// foreign key violation, the role doesn't exist
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ActivateByID activates an account without its invitation token.
+func (s *UserStore) ActivateByID(ctx context.Context, id int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+
+		ctx, cancel := context.WithTimeout(ctx, TimeOutTime)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, `UPDATE users SET is_active = true WHERE id = $1 AND deleted_at IS NULL`, id)
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		return s.deleteUserInvitations(ctx, tx, id)
+	})
+}
+
+// ForcePasswordReset locks the account until its password is reset with
+// the token.
+func (s *UserStore) ForcePasswordReset(ctx context.Context, id int64, token string, exp time.Duration) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+
+		ctx, cancel := context.WithTimeout(ctx, TimeOutTime)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, `UPDATE users SET password_reset_required = true WHERE id = $1 AND deleted_at IS NULL`, id)
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM user_password_resets WHERE user_id = $1`, id); err != nil {
+			return err
+		}
+
+		query := `INSERT INTO user_password_resets (token, user_id, expiry) VALUES ($1, $2, $3)`
+
+		_, err = tx.ExecContext(ctx, query, token, id, time.Now().Add(exp))
+		return err
+	})
+}
+
+// ResetPassword sets the password of the user the plain token was sent to.
+func (s *UserStore) ResetPassword(ctx context.Context, token string, user *User) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+
+		hash := sha256.Sum256([]byte(token))
+		hashToken := hex.EncodeToString(hash[:])
+
+		ctx, cancel := context.WithTimeout(ctx, TimeOutTime)
+		defer cancel()
+
+		query := `
+			UPDATE users u
+			SET password = $1, password_reset_required = false
+			FROM user_password_resets pr
+			WHERE pr.user_id = u.id AND pr.token = $2 AND pr.expiry > $3
+			RETURNING u.id
+		`
+
+		err := tx.QueryRowContext(ctx, query, user.Password.hash, hashToken, time.Now()).Scan(&user.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM user_password_resets WHERE user_id = $1`, user.ID)
+		return err
+	})
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+type AuditLogEntry struct {
+	ID           int64          `json:"id"`
+	ActorID      *int64         `json:"actor_id"`
+	Action       string         `json:"action"`
+	TargetUserID *int64         `json:"target_user_id,omitempty"`
+	Metadata     map[string]any `json:"metadata"`
+	CreatedAt    time.Time      `json:"created_at"`
+}
+
+type AuditStore struct {
+	db *sql.DB
+}
+
+func (s *AuditStore) Create(ctx context.Context, entry *AuditLogEntry) error {
+	query := `
+		INSERT INTO admin_audit_log (actor_id, action, target_user_id, metadata)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+
+	metadata, err := json.Marshal(entry.Metadata)
+	if err != nil {
+		return err
+	}
+
+	if entry.Metadata == nil {
+		metadata = []byte("{}")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	return s.db.QueryRowContext(ctx, query, entry.ActorID, entry.Action, entry.TargetUserID, metadata).Scan(&entry.ID, &entry.CreatedAt)
+}
+
+// List returns the audit log newest first, optionally limited to the
+// entries about one user.
+func (s *AuditStore) List(ctx context.Context, targetUserID int64, cq PaginationCursorQuery) ([]*AuditLogEntry, *Cursor, error) {
+
+	qb := newQueryBuilder().
+		WhereTimeRange("created_at", cq.TimeRange)
+
+	if targetUserID != 0 {
+		qb.Where("target_user_id = ?", targetUserID)
+	}
+
+	if cq.Cursor != "" {
+		cursor, err := DecodeCursor(cq.Cursor)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		qb.WhereAfter("created_at", "id", "<", cursor)
+	}
+
+	query := `
+		SELECT id, actor_id, action, target_user_id, metadata, created_at
+		FROM admin_audit_log
+		WHERE
+			` + qb.Conditions() + `
+		ORDER BY created_at DESC, id DESC
+		LIMIT ` + qb.Arg(cq.Limit+1) + `
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, qb.Args()...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var entries []*AuditLogEntry
+	for rows.Next() {
+		var e AuditLogEntry
+		var metadata []byte
+
+		if err := rows.Scan(&e.ID, &e.ActorID, &e.Action, &e.TargetUserID, &metadata, &e.CreatedAt); err != nil {
+			return nil, nil, err
+		}
+
+		if err := json.Unmarshal(metadata, &e.Metadata); err != nil {
+			return nil, nil, err
+		}
+
+		entries = append(entries, &e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var next *Cursor
+	if len(entries) > cq.Limit {
+		entries = entries[:cq.Limit]
+		last := entries[len(entries)-1]
+		next = &Cursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+
+	return entries, next, nil
+}
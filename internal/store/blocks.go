@@ -0,0 +1,187 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+type Block struct {
+	BlockerId int64  `json:"blocker_id"`
+	BlockedId int64  `json:"blocked_id"`
+	CreatedAt string `json:"created_at"`
+}
+
+type BlockStore struct {
+	db *sql.DB
+}
+
+func (s *BlockStore) Block(ctx context.Context, blockerId int64, blockedId int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+
+		query := `
+			INSERT INTO
+				user_blocks (blocker_id, blocked_id)
+			VALUES
+				($1, $2)
+		`
+
+		ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+		defer cancel()
+
+		if _, err := tx.ExecContext(ctxWTimeout, query, blockerId, blockedId); err != nil {
+			if pqErr, ok := err.(*pq.Error); ok {
+				switch pqErr.Code {
+				case "23505":
+					return ErrDuplicateKey
+				case "23503":
+					// the blocked user doesn't exist
+					return ErrNotFound
+				}
+			}
+			return err
+		}
+
+		// a block ends any follow relationship in both directions
+		query = `
+			DELETE FROM
+				followers
+			WHERE
+				(user_id = $1 AND follower_id = $2) OR (user_id = $2 AND follower_id = $1)
+		`
+
+		if _, err := tx.ExecContext(ctxWTimeout, query, blockerId, blockedId); err != nil {
+			return err
+		}
+
+		// and any follow request between them, pending or answered
+		query = `
+			DELETE FROM
+				follow_requests
+			WHERE
+				(requester_id = $1 AND target_id = $2) OR (requester_id = $2 AND target_id = $1)
+		`
+
+		if _, err := tx.ExecContext(ctxWTimeout, query, blockerId, blockedId); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (s *BlockStore) Unblock(ctx context.Context, blockerId int64, blockedId int64) error {
+	query := `
+		DELETE FROM
+			user_blocks
+		WHERE
+			blocker_id = $1 AND blocked_id = $2
+	`
+
+	return s.deleteRelation(ctx, query, blockerId, blockedId)
+}
+
+func (s *BlockStore) Mute(ctx context.Context, userId int64, mutedId int64) error {
+	query := `
+		INSERT INTO
+			user_mutes (user_id, muted_id)
+		VALUES
+			($1, $2)
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctxWTimeout, query, userId, mutedId)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			switch pqErr.Code {
+			case "23505":
+				return ErrDuplicateKey
+			case "23503":
+				// the muted user doesn't exist
+				return ErrNotFound
+			}
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (s *BlockStore) Unmute(ctx context.Context, userId int64, mutedId int64) error {
+	query := `
+		DELETE FROM
+			user_mutes
+		WHERE
+			user_id = $1 AND muted_id = $2
+	`
+
+	return s.deleteRelation(ctx, query, userId, mutedId)
+}
+
+// IsBlocked reports whether either user has blocked the other.
+func (s *BlockStore) IsBlocked(ctx context.Context, userId int64, otherId int64) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM user_blocks b WHERE ` + blockedBetween("$1", "$2") + `)`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	var blocked bool
+	if err := s.db.QueryRowContext(ctxWTimeout, query, userId, otherId).Scan(&blocked); err != nil {
+		return false, err
+	}
+
+	return blocked, nil
+}
+
+// GetBlockedIDs returns the users userId has blocked or is blocked by.
+func (s *BlockStore) GetBlockedIDs(ctx context.Context, userId int64) ([]int64, error) {
+	query := `
+		SELECT blocked_id FROM user_blocks WHERE blocker_id = $1
+		UNION
+		SELECT blocker_id FROM user_blocks WHERE blocked_id = $1
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctxWTimeout, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+func (s *BlockStore) deleteRelation(ctx context.Context, query string, userId int64, otherId int64) error {
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctxWTimeout, query, userId, otherId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/wesleybruno/golang-monolito/internal/store"
+)
+
+const popularPostsKey = "explore-popular-posts"
+
+// ExploreStore keeps the results of the explore refresh job, shared by
+// every instance of the API.
+type ExploreStore struct {
+	rdb *redis.Client
+}
+
+func (s ExploreStore) GetTrendingTags(ctx context.Context, window string) ([]*store.TrendingTag, error) {
+
+	cacheKey := fmt.Sprintf("explore-trending-tags-%s", window)
+
+	data, err := s.rdb.Get(ctx, cacheKey).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var tags []*store.TrendingTag
+	if err := json.Unmarshal([]byte(data), &tags); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+func (s ExploreStore) SetTrendingTags(ctx context.Context, window string, tags []*store.TrendingTag, exp time.Duration) error {
+
+	cacheKey := fmt.Sprintf("explore-trending-tags-%s", window)
+
+	json, err := json.Marshal(tags)
+	if err != nil {
+		return err
+	}
+
+	return s.rdb.SetEx(ctx, cacheKey, json, exp).Err()
+}
+
+func (s ExploreStore) GetPopularPostIDs(ctx context.Context) ([]int64, error) {
+
+	data, err := s.rdb.Get(ctx, popularPostsKey).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var ids []int64
+	if err := json.Unmarshal([]byte(data), &ids); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func (s ExploreStore) SetPopularPostIDs(ctx context.Context, ids []int64, exp time.Duration) error {
+
+	json, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+
+	return s.rdb.SetEx(ctx, popularPostsKey, json, exp).Err()
+}
@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/wesleybruno/golang-monolito/internal/store"
+)
+
+type RolesStore struct {
+	rdb *redis.Client
+}
+
+func (s RolesStore) Get(ctx context.Context, name string) (*store.Role, error) {
+
+	cacheKey := fmt.Sprintf("role-%s", name)
+
+	data, err := s.rdb.Get(ctx, cacheKey).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var role store.Role
+	if err := json.Unmarshal([]byte(data), &role); err != nil {
+		return nil, err
+	}
+
+	return &role, nil
+}
+
+func (s RolesStore) Set(ctx context.Context, role *store.Role) error {
+
+	cacheKey := fmt.Sprintf("role-%s", role.Name)
+
+	json, err := json.Marshal(role)
+	if err != nil {
+		return err
+	}
+
+	return s.rdb.SetEx(ctx, cacheKey, json, cacheExpTime).Err()
+}
+
+func (s RolesStore) Delete(ctx context.Context, name string) {
+	cacheKey := fmt.Sprintf("role-%s", name)
+	s.rdb.Del(ctx, cacheKey)
+}
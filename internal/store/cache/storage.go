@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/wesleybruno/golang-monolito/internal/store"
@@ -13,12 +14,33 @@ type Storage struct {
 		Set(context.Context, *store.User) error
 		Delete(context.Context, int64)
 	}
+	Roles interface {
+		Get(context.Context, string) (*store.Role, error)
+		Set(context.Context, *store.Role) error
+		Delete(context.Context, string)
+	}
+	Timelines interface {
+		Exists(ctx context.Context, userID int64) (bool, error)
+		Range(ctx context.Context, userID int64, beforeID int64, limit int) ([]int64, bool, error)
+		Fill(ctx context.Context, userID int64, postIDs []int64) error
+		Push(ctx context.Context, userIDs []int64, postID int64) error
+		Delete(ctx context.Context, userIDs ...int64)
+	}
+	Explore interface {
+		GetTrendingTags(ctx context.Context, window string) ([]*store.TrendingTag, error)
+		SetTrendingTags(ctx context.Context, window string, tags []*store.TrendingTag, exp time.Duration) error
+		GetPopularPostIDs(ctx context.Context) ([]int64, error)
+		SetPopularPostIDs(ctx context.Context, ids []int64, exp time.Duration) error
+	}
 }
 
 func NewRedisStorage(rdb *redis.Client) Storage {
 
 	return Storage{
-		Users: &UsersStore{rdb},
+		Users:     &UsersStore{rdb},
+		Roles:     &RolesStore{rdb},
+		Timelines: &TimelinesStore{rdb},
+		Explore:   &ExploreStore{rdb},
 	}
 
 }
@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// timelines keep the newest post ids only, older pages come from the database
+	timelineMaxLen = 800
+	// timelines of users who stop reading go cold and are rebuilt on demand
+	timelineExpTime = time.Hour * 24 * 7
+)
+
+// pushScript only adds to timelines that exist: a cold timeline holding just
+// the newest post would look complete and hide the older ones.
+var pushScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	redis.call('ZADD', KEYS[1], ARGV[1], ARGV[1])
+	redis.call('ZREMRANGEBYRANK', KEYS[1], 0, -(tonumber(ARGV[2]) + 1))
+end
+return 0
+`)
+
+// TimelinesStore keeps the home timeline of each user as a sorted set of
+// post ids scored by the id itself, so the newest posts come first.
+type TimelinesStore struct {
+	rdb *redis.Client
+}
+
+func timelineKey(userID int64) string {
+	return fmt.Sprintf("timeline-%d", userID)
+}
+
+func (s *TimelinesStore) Exists(ctx context.Context, userID int64) (bool, error) {
+	n, err := s.rdb.Exists(ctx, timelineKey(userID)).Result()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// Range returns up to limit post ids older than beforeID, newest first. A
+// zero beforeID starts from the newest post. complete is false when the
+// timeline was trimmed to timelineMaxLen: older posts may exist that it
+// no longer holds.
+func (s *TimelinesStore) Range(ctx context.Context, userID int64, beforeID int64, limit int) ([]int64, bool, error) {
+	max := "+inf"
+	if beforeID > 0 {
+		max = "(" + strconv.FormatInt(beforeID, 10)
+	}
+
+	key := timelineKey(userID)
+
+	var members *redis.StringSliceCmd
+	var size *redis.IntCmd
+	_, err := s.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		members = pipe.ZRevRangeByScore(ctx, key, &redis.ZRangeBy{
+			Max:   max,
+			Min:   "(0",
+			Count: int64(limit),
+		})
+		size = pipe.ZCard(ctx, key)
+		pipe.Expire(ctx, key, timelineExpTime)
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	ids := make([]int64, 0, len(members.Val()))
+	for _, m := range members.Val() {
+		id, err := strconv.ParseInt(m, 10, 64)
+		if err != nil {
+			return nil, false, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, size.Val() < timelineMaxLen, nil
+}
+
+// Fill replaces the timeline of userID with postIDs.
+func (s *TimelinesStore) Fill(ctx context.Context, userID int64, postIDs []int64) error {
+	key := timelineKey(userID)
+
+	members := make([]redis.Z, 0, len(postIDs))
+	for _, id := range postIDs {
+		members = append(members, redis.Z{Score: float64(id), Member: id})
+	}
+
+	_, err := s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		if len(members) > 0 {
+			pipe.ZAdd(ctx, key, members...)
+			pipe.ZRemRangeByRank(ctx, key, 0, -(timelineMaxLen + 1))
+		} else {
+			// an empty timeline is still warm, keep a placeholder that never shows up
+			pipe.ZAdd(ctx, key, redis.Z{Score: 0, Member: 0})
+		}
+		pipe.Expire(ctx, key, timelineExpTime)
+		return nil
+	})
+
+	return err
+}
+
+// Push adds postID to the warm timelines among userIDs.
+func (s *TimelinesStore) Push(ctx context.Context, userIDs []int64, postID int64) error {
+	_, err := s.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, userID := range userIDs {
+			pushScript.Eval(ctx, pipe, []string{timelineKey(userID)}, postID, timelineMaxLen)
+		}
+		return nil
+	})
+
+	return err
+}
+
+func (s *TimelinesStore) Delete(ctx context.Context, userIDs ...int64) {
+	keys := make([]string, 0, len(userIDs))
+	for _, id := range userIDs {
+		keys = append(keys, timelineKey(id))
+	}
+
+	s.rdb.Del(ctx, keys...)
+}
@@ -3,6 +3,7 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
 )
 
 type Comment struct {
@@ -18,19 +19,19 @@ type CommentStore struct {
 	db *sql.DB
 }
 
-func (c CommentStore) GetByPostId(ctx context.Context, postId int64) ([]Comment, error) {
+func (c CommentStore) GetByPostId(ctx context.Context, postId int64, viewerId int64) ([]Comment, error) {
 
 	query := `
-		SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, users.username, users.id  FROM comments c
+		SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, users.username, users.id, users.avatar  FROM comments c
 		JOIN users on users.id = c.user_id
-		WHERE c.post_id = $1
+		WHERE c.post_id = $1 AND ` + notBlocked("c.user_id", "$2") + `
 		ORDER BY c.created_at DESC;
 	`
 
 	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
 	defer cancel()
 
-	rows, err := c.db.QueryContext(ctxWTimeout, query, postId)
+	rows, err := c.db.QueryContext(ctxWTimeout, query, postId, viewerId)
 	if err != nil {
 		return nil, err
 	}
@@ -40,7 +41,7 @@ func (c CommentStore) GetByPostId(ctx context.Context, postId int64) ([]Comment,
 	for rows.Next() {
 		var c Comment
 		c.User = User{}
-		err := rows.Scan(&c.ID, &c.PostId, &c.UserId, &c.Content, &c.CreatedAt, &c.User.Username, &c.User.ID)
+		err := rows.Scan(&c.ID, &c.PostId, &c.UserId, &c.Content, &c.CreatedAt, &c.User.Username, &c.User.ID, &c.User.Avatar)
 		if err != nil {
 			return nil, err
 		}
@@ -54,9 +55,13 @@ func (c CommentStore) GetByPostId(ctx context.Context, postId int64) ([]Comment,
 
 func (c CommentStore) Create(ctx context.Context, comment *Comment) error {
 
+	// a post hidden by a block or a private account can't be commented on, it behaves as if it didn't exist
 	query := `
 		INSERT INTO comments (user_id, post_id, content)
-		VALUES ($1, $2, $3) RETURNING id, created_at
+		SELECT $1, p.id, $3
+		FROM posts p
+		WHERE p.id = $2 AND ` + notBlocked("p.user_id", "$1") + ` AND ` + canSeeAuthor("p.user_id", "$1") + `
+		RETURNING id, created_at
 	`
 
 	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
@@ -73,7 +78,12 @@ func (c CommentStore) Create(ctx context.Context, comment *Comment) error {
 		&comment.CreatedAt,
 	)
 	if err != nil {
-		return err
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		default:
+			return err
+		}
 	}
 
 	return nil
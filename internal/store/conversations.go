@@ -0,0 +1,454 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// MaxConversationParticipants bounds the size of group conversations,
+// counting their creator.
+const MaxConversationParticipants = 10
+
+var ErrTooManyParticipants = errors.New("too many participants")
+
+type ConversationParticipant struct {
+	User User `json:"user"`
+	// LastReadMessageID is the read receipt of the participant
+	LastReadMessageID *int64     `json:"last_read_message_id"`
+	LastReadAt        *time.Time `json:"last_read_at"`
+}
+
+type Message struct {
+	ID             int64     `json:"id"`
+	ConversationID int64     `json:"conversation_id"`
+	SenderID       int64     `json:"sender_id"`
+	Content        string    `json:"content"`
+	CreatedAt      time.Time `json:"created_at"`
+	Sender         User      `json:"sender"`
+}
+
+type Conversation struct {
+	ID           int64                     `json:"id"`
+	Title        string                    `json:"title,omitempty"`
+	IsGroup      bool                      `json:"is_group"`
+	CreatedBy    *int64                    `json:"created_by"`
+	CreatedAt    time.Time                 `json:"created_at"`
+	UpdatedAt    time.Time                 `json:"updated_at"`
+	Participants []ConversationParticipant `json:"participants"`
+	LastMessage  *Message                  `json:"last_message"`
+	// UnreadCount counts the messages of the others past the viewer's read receipt
+	UnreadCount int64 `json:"unread_count"`
+}
+
+// ParticipantIDs returns the ids of the participants other than userId.
+func (c *Conversation) ParticipantIDs(userId int64) []int64 {
+	var ids []int64
+	for _, p := range c.Participants {
+		if p.User.ID != userId {
+			ids = append(ids, p.User.ID)
+		}
+	}
+	return ids
+}
+
+// messageVisible holds when the sender of message m and the viewer bound to
+// $1 haven't blocked each other: in groups their messages are hidden.
+var messageVisible = notBlocked("m.sender_id", "$1")
+
+// conversationSelect lists the conversations of the viewer bound to $1, as
+// participant me.
+var conversationSelect = `
+		SELECT
+			c.id, COALESCE(c.title, ''), c.is_group, c.created_by, c.created_at, c.updated_at,
+			(
+				SELECT json_agg(json_build_object(
+					'user', json_build_object('id', u.id, 'username', u.username, 'avatar', u.avatar),
+					'last_read_message_id', cp.last_read_message_id,
+					'last_read_at', cp.last_read_at
+				) ORDER BY cp.joined_at, u.id)
+				FROM conversation_participants cp
+				JOIN users u ON u.id = cp.user_id
+				WHERE cp.conversation_id = c.id
+			),
+			(
+				SELECT json_build_object(
+					'id', m.id, 'conversation_id', m.conversation_id, 'sender_id', m.sender_id, 'content', m.content, 'created_at', m.created_at,
+					'sender', json_build_object('id', u.id, 'username', u.username, 'avatar', u.avatar)
+				)
+				FROM messages m
+				JOIN users u ON u.id = m.sender_id
+				WHERE m.conversation_id = c.id AND ` + messageVisible + `
+				ORDER BY m.id DESC
+				LIMIT 1
+			),
+			(
+				SELECT COUNT(*)
+				FROM messages m
+				WHERE
+					m.conversation_id = c.id
+					AND m.sender_id <> $1
+					AND m.id > COALESCE(me.last_read_message_id, 0)
+					AND ` + messageVisible + `
+			)
+		FROM conversations c
+		JOIN conversation_participants me ON me.conversation_id = c.id AND me.user_id = $1`
+
+type ConversationStore struct {
+	db *sql.DB
+}
+
+// Create starts a conversation of creatorId with participantIds, a group
+// one when there's more than one of them. A 1:1 conversation is only created
+// once per pair: its id is returned with created false afterwards. Users who
+// blocked or were blocked by the creator, and private accounts the creator
+// doesn't follow, can't be added.
+func (s *ConversationStore) Create(ctx context.Context, creatorId int64, participantIds []int64, title string) (int64, bool, error) {
+	if len(participantIds)+1 > MaxConversationParticipants {
+		return 0, false, ErrTooManyParticipants
+	}
+
+	var id int64
+	created := true
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+
+		query := `
+			SELECT
+				EXISTS (SELECT 1 FROM user_blocks b WHERE ` + blockedBetween("$1", "u.id") + `),
+				NOT ` + canSeeAuthor("u.id", "$1") + `
+			FROM users u
+			WHERE u.id = ANY($2) AND u.id <> $1 AND u.is_active AND u.deleted_at IS NULL
+		`
+
+		ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+		defer cancel()
+
+		rows, err := tx.QueryContext(ctxWTimeout, query, creatorId, pq.Array(participantIds))
+		if err != nil {
+			return err
+		}
+
+		found := 0
+		var isBlocked, isPrivate bool
+		for rows.Next() {
+			var blocked, private bool
+			if err := rows.Scan(&blocked, &private); err != nil {
+				rows.Close()
+				return err
+			}
+
+			found++
+			isBlocked = isBlocked || blocked
+			isPrivate = isPrivate || private
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		switch {
+		case found != len(participantIds):
+			return ErrNotFound
+		case isBlocked:
+			return ErrBlocked
+		case isPrivate:
+			return ErrPrivateAccount
+		}
+
+		isGroup := len(participantIds) > 1
+
+		var directKey *string
+		if !isGroup {
+			key := fmt.Sprintf("%d:%d", min(creatorId, participantIds[0]), max(creatorId, participantIds[0]))
+			directKey = &key
+			title = ""
+		}
+
+		query = `
+			INSERT INTO conversations (created_by, title, is_group, direct_key)
+			VALUES ($1, NULLIF($2, ''), $3, $4)
+			ON CONFLICT (direct_key) DO NOTHING
+			RETURNING id
+		`
+
+		err = tx.QueryRowContext(ctxWTimeout, query, creatorId, title, isGroup, directKey).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			created = false
+			err = tx.QueryRowContext(ctxWTimeout, `SELECT id FROM conversations WHERE direct_key = $1`, directKey).Scan(&id)
+		}
+		if err != nil {
+			return err
+		}
+
+		query = `
+			INSERT INTO conversation_participants (conversation_id, user_id)
+			SELECT $1, unnest($2::bigint[])
+			ON CONFLICT (conversation_id, user_id) DO NOTHING
+		`
+
+		_, err = tx.ExecContext(ctxWTimeout, query, id, pq.Array(append([]int64{creatorId}, participantIds...)))
+		return err
+	})
+	if err != nil {
+		return 0, false, err
+	}
+
+	return id, created, nil
+}
+
+// GetByID returns conversation id as seen by userId, ErrNotFound when they
+// aren't one of its participants.
+func (s *ConversationStore) GetByID(ctx context.Context, id int64, userId int64) (*Conversation, error) {
+	query := conversationSelect + `
+		WHERE c.id = $2
+	`
+
+	conversations, err := s.query(ctx, query, userId, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(conversations) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return conversations[0], nil
+}
+
+// List returns the conversations of userId, the most recently active first.
+func (s *ConversationStore) List(ctx context.Context, userId int64, cq PaginationCursorQuery) ([]*Conversation, *Cursor, error) {
+
+	qb := newQueryBuilder(userId).
+		WhereTimeRange("c.updated_at", cq.TimeRange)
+
+	if cq.Cursor != "" {
+		cursor, err := DecodeCursor(cq.Cursor)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		qb.WhereAfter("c.updated_at", "c.id", "<", cursor)
+	}
+
+	query := conversationSelect + `
+		WHERE
+			` + qb.Conditions() + `
+		ORDER BY c.updated_at DESC, c.id DESC
+		LIMIT ` + qb.Arg(cq.Limit+1) + `
+	`
+
+	conversations, err := s.query(ctx, query, qb.Args()...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var next *Cursor
+	if len(conversations) > cq.Limit {
+		conversations = conversations[:cq.Limit]
+		last := conversations[len(conversations)-1]
+		next = &Cursor{CreatedAt: last.UpdatedAt, ID: last.ID}
+	}
+
+	return conversations, next, nil
+}
+
+func (s *ConversationStore) query(ctx context.Context, query string, args ...any) ([]*Conversation, error) {
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctxWTimeout, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conversations := []*Conversation{}
+	for rows.Next() {
+		var c Conversation
+		var participants, lastMessage []byte
+
+		err := rows.Scan(&c.ID, &c.Title, &c.IsGroup, &c.CreatedBy, &c.CreatedAt, &c.UpdatedAt, &participants, &lastMessage, &c.UnreadCount)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(participants, &c.Participants); err != nil {
+			return nil, err
+		}
+
+		if lastMessage != nil {
+			if err := json.Unmarshal(lastMessage, &c.LastMessage); err != nil {
+				return nil, err
+			}
+		}
+
+		conversations = append(conversations, &c)
+	}
+
+	return conversations, rows.Err()
+}
+
+// GetMessages pages through the history of a conversation of userId, the
+// newest messages first.
+func (s *ConversationStore) GetMessages(ctx context.Context, conversationId int64, userId int64, cq PaginationCursorQuery) ([]*Message, *Cursor, error) {
+
+	qb := newQueryBuilder(userId, conversationId).
+		Where("m.conversation_id = $2").
+		Where(messageVisible).
+		WhereTimeRange("m.created_at", cq.TimeRange)
+
+	if cq.Cursor != "" {
+		cursor, err := DecodeCursor(cq.Cursor)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		qb.WhereAfter("m.created_at", "m.id", "<", cursor)
+	}
+
+	query := `
+		SELECT m.id, m.conversation_id, m.sender_id, m.content, m.created_at, u.id, u.username, u.avatar
+		FROM messages m
+		JOIN users u ON u.id = m.sender_id
+		WHERE
+			` + qb.Conditions() + `
+		ORDER BY m.created_at DESC, m.id DESC
+		LIMIT ` + qb.Arg(cq.Limit+1) + `
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctxWTimeout, query, qb.Args()...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	messages := []*Message{}
+	for rows.Next() {
+		var m Message
+		err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.Content, &m.CreatedAt, &m.Sender.ID, &m.Sender.Username, &m.Sender.Avatar)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		messages = append(messages, &m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var next *Cursor
+	if len(messages) > cq.Limit {
+		messages = messages[:cq.Limit]
+		last := messages[len(messages)-1]
+		next = &Cursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+
+	return messages, next, nil
+}
+
+// SendMessage adds msg to its conversation, which the sender has read up to
+// it. Blocks end 1:1 conversations with ErrBlocked.
+func (s *ConversationStore) SendMessage(ctx context.Context, msg *Message) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+
+		query := `
+			SELECT
+				c.is_group,
+				EXISTS (
+					SELECT 1
+					FROM conversation_participants o
+					JOIN user_blocks b ON ` + blockedBetween("$2", "o.user_id") + `
+					WHERE o.conversation_id = c.id AND o.user_id <> $2
+				)
+			FROM conversations c
+			JOIN conversation_participants me ON me.conversation_id = c.id AND me.user_id = $2
+			WHERE c.id = $1
+			FOR UPDATE OF c
+		`
+
+		ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+		defer cancel()
+
+		var isGroup, isBlocked bool
+		err := tx.QueryRowContext(ctxWTimeout, query, msg.ConversationID, msg.SenderID).Scan(&isGroup, &isBlocked)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if !isGroup && isBlocked {
+			return ErrBlocked
+		}
+
+		query = `
+			INSERT INTO messages (conversation_id, sender_id, content)
+			VALUES ($1, $2, $3)
+			RETURNING id, created_at
+		`
+
+		err = tx.QueryRowContext(ctxWTimeout, query, msg.ConversationID, msg.SenderID, msg.Content).Scan(&msg.ID, &msg.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctxWTimeout, `UPDATE conversations SET updated_at = $2 WHERE id = $1`, msg.ConversationID, msg.CreatedAt); err != nil {
+			return err
+		}
+
+		query = `
+			UPDATE conversation_participants
+			SET last_read_message_id = $3, last_read_at = NOW()
+			WHERE conversation_id = $1 AND user_id = $2
+		`
+
+		_, err = tx.ExecContext(ctxWTimeout, query, msg.ConversationID, msg.SenderID, msg.ID)
+		return err
+	})
+}
+
+// MarkRead moves the read receipt of userId up to messageId, or the latest
+// message when nil. Receipts never move back. It returns the receipt.
+func (s *ConversationStore) MarkRead(ctx context.Context, conversationId int64, userId int64, messageId *int64) (*ConversationParticipant, error) {
+	query := `
+		UPDATE conversation_participants cp
+		SET
+			last_read_message_id = GREATEST(cp.last_read_message_id, t.id),
+			last_read_at = CASE WHEN t.id > COALESCE(cp.last_read_message_id, 0) THEN NOW() ELSE cp.last_read_at END
+		FROM (
+			SELECT MAX(m.id) AS id
+			FROM messages m
+			WHERE m.conversation_id = $1 AND ($3::bigint IS NULL OR m.id = $3)
+		) t
+		WHERE cp.conversation_id = $1 AND cp.user_id = $2 AND t.id IS NOT NULL
+		RETURNING cp.last_read_message_id, cp.last_read_at
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	receipt := &ConversationParticipant{User: User{ID: userId}}
+	err := s.db.QueryRowContext(ctxWTimeout, query, conversationId, userId, messageId).Scan(&receipt.LastReadMessageID, &receipt.LastReadAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return receipt, nil
+}
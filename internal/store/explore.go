@@ -0,0 +1,225 @@
+package store
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// TrendingWindows are the sliding windows tags trend over.
+var TrendingWindows = map[string]time.Duration{
+	"1h":  time.Hour,
+	"24h": time.Hour * 24,
+	"7d":  time.Hour * 24 * 7,
+}
+
+// exploreAuthor holds when posts by the author aliased "u" may show up to
+// people who don't follow them.
+const exploreAuthor = `NOT u.is_private AND u.is_active AND u.deleted_at IS NULL`
+
+type TrendingTagsQuery struct {
+	Window string `json:"window" validate:"oneof=1h 24h 7d"`
+	Limit  int    `json:"limit" validate:"gte=1,lte=50"`
+}
+
+func (tq TrendingTagsQuery) Parse(r *http.Request) (TrendingTagsQuery, error) {
+
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return tq, err
+		}
+
+		tq.Limit = l
+	}
+
+	window := qs.Get("window")
+	if window != "" {
+		tq.Window = window
+	}
+
+	return tq, nil
+}
+
+type ExploreQuery struct {
+	Tag    string `json:"tag" validate:"max=100"`
+	Limit  int    `json:"limit" validate:"gte=1,lte=20"`
+	Offset int    `json:"offset" validate:"gte=0"`
+}
+
+func (eq ExploreQuery) Parse(r *http.Request) (ExploreQuery, error) {
+
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return eq, err
+		}
+
+		eq.Limit = l
+	}
+
+	offset := qs.Get("offset")
+	if offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return eq, err
+		}
+
+		eq.Offset = o
+	}
+
+	eq.Tag = strings.TrimSpace(qs.Get("tag"))
+
+	return eq, nil
+}
+
+// TrendingTag is a tag used in the window more than it usually is.
+type TrendingTag struct {
+	Tag string `json:"tag"`
+	// Posts is the number of posts tagged within the window.
+	Posts int64 `json:"posts"`
+	// Baseline is the average number of posts tagged per window before it.
+	Baseline float64 `json:"baseline"`
+	// Velocity is how much Posts grew over Baseline, smoothed so tags
+	// without history don't trend on a single post.
+	Velocity float64 `json:"velocity"`
+}
+
+// GetTrendingTags compares the use of each tag in the window ending now with
+// its average over the baselinePeriods windows before it. Only public posts
+// count, tags must be on at least minPosts posts of the window to trend.
+func (p PostStore) GetTrendingTags(ctx context.Context, window time.Duration, baselinePeriods int, minPosts int, limit int) ([]*TrendingTag, error) {
+
+	now := time.Now()
+	windowStart := now.Add(-window)
+	baselineStart := windowStart.Add(-window * time.Duration(baselinePeriods))
+
+	query := `
+		SELECT tag, posts, baseline, (posts - baseline) / (baseline + 1) AS velocity
+		FROM (
+			SELECT
+				tag,
+				COUNT(*) FILTER (WHERE p.created_at >= $1) AS posts,
+				COUNT(*) FILTER (WHERE p.created_at < $1)::float8 / $4 AS baseline
+			FROM posts p
+			JOIN users u ON u.id = p.user_id
+			CROSS JOIN unnest(p.tags) AS tag
+			WHERE
+				p.created_at >= $2 AND p.created_at < $3
+				AND ` + exploreAuthor + `
+			GROUP BY tag
+		) t
+		WHERE posts >= $5
+		ORDER BY velocity DESC, posts DESC, tag
+		LIMIT $6
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	rows, err := p.db.QueryContext(ctxWTimeout, query, windowStart, baselineStart, now, baselinePeriods, minPosts, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*TrendingTag{}
+	for rows.Next() {
+		var t TrendingTag
+		if err := rows.Scan(&t.Tag, &t.Posts, &t.Baseline, &t.Velocity); err != nil {
+			return nil, err
+		}
+		tags = append(tags, &t)
+	}
+
+	return tags, rows.Err()
+}
+
+// GetPopularPostIDs returns the public posts created since since with the
+// most engagement, decayed by age so newer posts can catch up.
+func (p PostStore) GetPopularPostIDs(ctx context.Context, since time.Time, limit int) ([]int64, error) {
+	query := `
+		SELECT p.id
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		WHERE
+			p.created_at >= $1
+			AND ` + exploreAuthor + `
+		ORDER BY
+			(
+				(SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = p.id)
+				+ 2 * (SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id)
+				+ 1
+			) / power(EXTRACT(EPOCH FROM NOW() - p.created_at) / 3600 + 2, 1.5) DESC,
+			p.id DESC
+		LIMIT $2
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	rows, err := p.db.QueryContext(ctxWTimeout, query, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// GetExplorePosts loads the posts of ids, in that order, leaving out the
+// ones by viewerId, by people they follow or that they can't see.
+func (p PostStore) GetExplorePosts(ctx context.Context, viewerId int64, ids []int64, eq ExploreQuery) ([]*PostWithMetadata, error) {
+	if len(ids) == 0 {
+		return []*PostWithMetadata{}, nil
+	}
+
+	qb := newQueryBuilder(viewerId, pq.Array(ids)).
+		Where("p.id = ANY($2)").
+		Where("p.user_id <> $1").
+		Where("NOT EXISTS (SELECT 1 FROM followers f WHERE f.user_id = $1 AND f.follower_id = p.user_id)").
+		Where(exploreAuthor).
+		Where(notBlocked("p.user_id", "$1")).
+		Where(notMuted("p.user_id", "$1"))
+
+	if eq.Tag != "" {
+		qb.Where("? = ANY(p.tags)", eq.Tag)
+	}
+
+	query := feedSelect + `
+		WHERE
+			` + qb.Conditions() + `
+		ORDER BY array_position($2, p.id)
+		LIMIT ` + qb.Arg(eq.Limit) + ` OFFSET ` + qb.Arg(eq.Offset) + `
+	`
+
+	posts, _, err := p.queryFeed(ctx, query, qb.Args()...)
+	if err != nil {
+		return nil, err
+	}
+
+	if posts == nil {
+		posts = []*PostWithMetadata{}
+	}
+
+	return posts, nil
+}
@@ -0,0 +1,236 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	ExportPending   = "pending"
+	ExportRunning   = "running"
+	ExportCompleted = "completed"
+	ExportFailed    = "failed"
+
+	// exports stuck in progress longer than this are considered crashed
+	exportStaleAfter = time.Hour
+)
+
+type DataExport struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	Status      string     `json:"status"`
+	FileKey     string     `json:"-"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// ExportSections lists the files of a personal data export, each one built
+// by a query aggregating the rows to JSON. Passwords are never exported.
+var ExportSections = map[string]string{
+	"profile": `
+		SELECT row_to_json(u) FROM (
+			SELECT id, username, display_name, bio, email, created_at, is_active, is_private, avatar, banner
+			FROM users WHERE id = $1
+		) u`,
+	"posts": `
+		SELECT COALESCE(json_agg(p ORDER BY p.created_at), '[]') FROM (
+			SELECT id, title, content, tags, version, created_at, updated_at
+			FROM posts WHERE user_id = $1
+		) p`,
+	"comments": `
+		SELECT COALESCE(json_agg(c ORDER BY c.created_at), '[]') FROM (
+			SELECT id, post_id, content, created_at
+			FROM comments WHERE user_id = $1
+		) c`,
+	"reactions": `
+		SELECT COALESCE(json_agg(r ORDER BY r.created_at), '[]') FROM (
+			SELECT post_id, kind, created_at
+			FROM post_reactions WHERE user_id = $1
+		) r`,
+	"followers": `
+		SELECT COALESCE(json_agg(f ORDER BY f.created_at), '[]') FROM (
+			SELECT u.id AS user_id, u.username, f.created_at
+			FROM followers f JOIN users u ON u.id = f.user_id
+			WHERE f.follower_id = $1
+		) f`,
+	"following": `
+		SELECT COALESCE(json_agg(f ORDER BY f.created_at), '[]') FROM (
+			SELECT u.id AS user_id, u.username, f.created_at
+			FROM followers f JOIN users u ON u.id = f.follower_id
+			WHERE f.user_id = $1
+		) f`,
+	"follow_requests": `
+		SELECT COALESCE(json_agg(r ORDER BY r.created_at), '[]') FROM (
+			SELECT requester_id, target_id, status, created_at, updated_at
+			FROM follow_requests WHERE requester_id = $1 OR target_id = $1
+		) r`,
+	"blocks": `
+		SELECT COALESCE(json_agg(b ORDER BY b.created_at), '[]') FROM (
+			SELECT blocked_id AS user_id, created_at FROM user_blocks WHERE blocker_id = $1
+		) b`,
+	"followed_tags": `
+		SELECT COALESCE(json_agg(t ORDER BY t.created_at), '[]') FROM (
+			SELECT tag, created_at FROM tag_follows WHERE user_id = $1
+		) t`,
+	"notifications": `
+		SELECT COALESCE(json_agg(n ORDER BY n.created_at), '[]') FROM (
+			SELECT id, kind, post_id, comment_id, created_at, updated_at, read_at
+			FROM notifications WHERE user_id = $1
+		) n`,
+	"notification_preferences": `
+		SELECT COALESCE(json_agg(p ORDER BY p.kind), '[]') FROM (
+			SELECT kind, delivery, updated_at FROM notification_preferences WHERE user_id = $1
+		) p`,
+	"messages": `
+		SELECT COALESCE(json_agg(m ORDER BY m.created_at), '[]') FROM (
+			SELECT id, conversation_id, content, created_at
+			FROM messages WHERE sender_id = $1
+		) m`,
+	"webhooks": `
+		SELECT COALESCE(json_agg(w ORDER BY w.created_at), '[]') FROM (
+			SELECT id, url, events, is_active, created_at FROM webhooks WHERE user_id = $1
+		) w`,
+	"mutes": `
+		SELECT COALESCE(json_agg(m ORDER BY m.created_at), '[]') FROM (
+			SELECT muted_id AS user_id, created_at FROM user_mutes WHERE user_id = $1
+		) m`,
+}
+
+type ExportStore struct {
+	db *sql.DB
+}
+
+// Create queues a new export, failing with ErrExportInProgress while
+// another one of the same user hasn't finished.
+func (s *ExportStore) Create(ctx context.Context, userID int64) (*DataExport, error) {
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	query := `
+		UPDATE data_exports
+		SET status = 'failed', error = 'export timed out'
+		WHERE user_id = $1 AND status IN ('pending', 'running') AND created_at < $2
+	`
+
+	if _, err := s.db.ExecContext(ctxWTimeout, query, userID, time.Now().Add(-exportStaleAfter)); err != nil {
+		return nil, err
+	}
+
+	query = `
+		INSERT INTO data_exports (user_id)
+		VALUES ($1)
+		RETURNING id, status, created_at
+	`
+
+	export := &DataExport{UserID: userID}
+	err := s.db.QueryRowContext(ctxWTimeout, query, userID).Scan(&export.ID, &export.Status, &export.CreatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return nil, ErrExportInProgress
+		}
+		return nil, err
+	}
+
+	return export, nil
+}
+
+func (s *ExportStore) GetByID(ctx context.Context, id int64) (*DataExport, error) {
+	query := `
+		SELECT id, user_id, status, COALESCE(file_key, ''), COALESCE(error, ''), created_at, completed_at, expires_at
+		FROM data_exports
+		WHERE id = $1
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	var export DataExport
+	err := s.db.QueryRowContext(ctxWTimeout, query, id).Scan(
+		&export.ID,
+		&export.UserID,
+		&export.Status,
+		&export.FileKey,
+		&export.Error,
+		&export.CreatedAt,
+		&export.CompletedAt,
+		&export.ExpiresAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &export, nil
+}
+
+func (s *ExportStore) MarkRunning(ctx context.Context, id int64) error {
+	query := `UPDATE data_exports SET status = 'running' WHERE id = $1 AND status = 'pending'`
+
+	return s.exec(ctx, query, id)
+}
+
+func (s *ExportStore) Complete(ctx context.Context, id int64, fileKey string, expiresAt time.Time) error {
+	query := `
+		UPDATE data_exports
+		SET status = 'completed', file_key = $2, completed_at = NOW(), expires_at = $3
+		WHERE id = $1
+	`
+
+	return s.exec(ctx, query, id, fileKey, expiresAt)
+}
+
+func (s *ExportStore) Fail(ctx context.Context, id int64, reason string) error {
+	query := `UPDATE data_exports SET status = 'failed', error = $2, completed_at = NOW() WHERE id = $1`
+
+	return s.exec(ctx, query, id, reason)
+}
+
+// Section returns one file of the export of userID as raw JSON.
+func (s *ExportStore) Section(ctx context.Context, userID int64, section string) (json.RawMessage, error) {
+	query, ok := ExportSections[section]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	var data []byte
+	if err := s.db.QueryRowContext(ctxWTimeout, query, userID).Scan(&data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (s *ExportStore) exec(ctx context.Context, query string, args ...any) error {
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctxWTimeout, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
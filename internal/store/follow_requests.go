@@ -0,0 +1,239 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	FollowRequestPending  = "pending"
+	FollowRequestAccepted = "accepted"
+	FollowRequestRejected = "rejected"
+)
+
+type FollowRequest struct {
+	Requester User      `json:"requester"`
+	TargetId  int64     `json:"target_id"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type FollowRequestStore struct {
+	db *sql.DB
+}
+
+// Create asks targetId, a private account, to accept requesterId as follower.
+// A previously answered request is sent again as pending, unless they still
+// follow each other.
+func (s *FollowRequestStore) Create(ctx context.Context, requesterId int64, targetId int64) (*FollowRequest, error) {
+	req := &FollowRequest{TargetId: targetId}
+	req.Requester.ID = requesterId
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `SELECT EXISTS (SELECT 1 FROM user_blocks b WHERE ` + blockedBetween("$1", "$2") + `)`
+
+		ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+		defer cancel()
+
+		var isBlocked bool
+		if err := tx.QueryRowContext(ctxWTimeout, query, requesterId, targetId).Scan(&isBlocked); err != nil {
+			return err
+		}
+
+		if isBlocked {
+			return ErrBlocked
+		}
+
+		query = `
+			INSERT INTO
+				follow_requests (requester_id, target_id)
+			SELECT
+				$1, $2
+			WHERE
+				NOT EXISTS (SELECT 1 FROM followers f WHERE f.user_id = $1 AND f.follower_id = $2)
+			ON CONFLICT (requester_id, target_id) DO UPDATE
+				SET status = 'pending', created_at = NOW(), updated_at = NOW()
+				WHERE follow_requests.status IN ('rejected', 'accepted')
+			RETURNING status, created_at, updated_at
+		`
+
+		err := tx.QueryRowContext(ctxWTimeout, query, requesterId, targetId).Scan(&req.Status, &req.CreatedAt, &req.UpdatedAt)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrDuplicateKey
+			default:
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+func (s *FollowRequestStore) Get(ctx context.Context, requesterId int64, targetId int64) (*FollowRequest, error) {
+	query := `
+		SELECT status, created_at, updated_at
+		FROM follow_requests
+		WHERE requester_id = $1 AND target_id = $2
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	req := &FollowRequest{TargetId: targetId}
+	req.Requester.ID = requesterId
+
+	err := s.db.QueryRowContext(ctxWTimeout, query, requesterId, targetId).Scan(&req.Status, &req.CreatedAt, &req.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return req, nil
+}
+
+// GetPending lists the requests waiting for targetId to answer, most recent first.
+func (s *FollowRequestStore) GetPending(ctx context.Context, targetId int64, cq PaginationCursorQuery) ([]*FollowRequest, *Cursor, error) {
+
+	qb := newQueryBuilder(targetId).
+		Where("fr.target_id = $1").
+		Where("fr.status = 'pending'").
+		Where(notBlocked("fr.requester_id", "$1")).
+		WhereTimeRange("fr.created_at", cq.TimeRange)
+
+	if cq.Cursor != "" {
+		cursor, err := DecodeCursor(cq.Cursor)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		qb.WhereAfter("fr.created_at", "fr.requester_id", "<", cursor)
+	}
+
+	query := `
+		SELECT fr.requester_id, u.username, fr.status, fr.created_at, fr.updated_at
+		FROM follow_requests fr
+		JOIN users u ON u.id = fr.requester_id
+		WHERE
+			` + qb.Conditions() + `
+		ORDER BY fr.created_at DESC, fr.requester_id DESC
+		LIMIT ` + qb.Arg(cq.Limit+1) + `
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctxWTimeout, query, qb.Args()...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var requests []*FollowRequest
+	for rows.Next() {
+		req := &FollowRequest{TargetId: targetId}
+		err := rows.Scan(&req.Requester.ID, &req.Requester.Username, &req.Status, &req.CreatedAt, &req.UpdatedAt)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		requests = append(requests, req)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var next *Cursor
+	if len(requests) > cq.Limit {
+		requests = requests[:cq.Limit]
+		last := requests[len(requests)-1]
+		next = &Cursor{CreatedAt: last.CreatedAt, ID: last.Requester.ID}
+	}
+
+	return requests, next, nil
+}
+
+// Accept turns a pending request into a follow relationship. Requests from
+// users blocked either way are hidden, accepting one fails with ErrNotFound.
+func (s *FollowRequestStore) Accept(ctx context.Context, targetId int64, requesterId int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+
+		query := `SELECT EXISTS (SELECT 1 FROM user_blocks b WHERE ` + blockedBetween("$1", "$2") + `)`
+
+		ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+		defer cancel()
+
+		var isBlocked bool
+		if err := tx.QueryRowContext(ctxWTimeout, query, requesterId, targetId).Scan(&isBlocked); err != nil {
+			return err
+		}
+
+		if isBlocked {
+			return ErrNotFound
+		}
+
+		if err := s.answer(ctx, tx, targetId, requesterId, FollowRequestAccepted); err != nil {
+			return err
+		}
+
+		query = `
+			INSERT INTO
+				followers (user_id, follower_id)
+			SELECT
+				$1, $2
+			WHERE
+				` + notBlocked("$1", "$2") + `
+			ON CONFLICT DO NOTHING
+		`
+
+		_, err := tx.ExecContext(ctxWTimeout, query, requesterId, targetId)
+		return err
+	})
+}
+
+func (s *FollowRequestStore) Reject(ctx context.Context, targetId int64, requesterId int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return s.answer(ctx, tx, targetId, requesterId, FollowRequestRejected)
+	})
+}
+
+func (s *FollowRequestStore) answer(ctx context.Context, tx *sql.Tx, targetId int64, requesterId int64, status string) error {
+	query := `
+		UPDATE follow_requests
+		SET status = $1, updated_at = NOW()
+		WHERE target_id = $2 AND requester_id = $3 AND status = 'pending'
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	res, err := tx.ExecContext(ctxWTimeout, query, status, targetId, requesterId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -3,6 +3,8 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"time"
 
 	"github.com/lib/pq"
 )
@@ -13,69 +15,185 @@ type Follower struct {
 	CreatedAt  string `json:"created_at"`
 }
 
+// FollowListEntry is a user listed as follower or followee, with the
+// relationship it has with the user viewing the list.
+type FollowListEntry struct {
+	User       User      `json:"user"`
+	FollowedAt time.Time `json:"followed_at"`
+	FollowsYou bool      `json:"follows_you"`
+	YouFollow  bool      `json:"you_follow"`
+}
+
 type FollowerStore struct {
 	db *sql.DB
 }
 
 func (p FollowerStore) Follow(ctx context.Context, currentId int64, followId int64) error {
-	query := `
-		INSERT INTO 
-			followers (user_id, follower_id ) 
-		VALUES 
-			($1, $2)
-	`
+	return withTx(p.db, ctx, func(tx *sql.Tx) error {
+
+		// private accounts are only followed through an accepted follow request
+		query := `
+			SELECT
+				u.is_private,
+				EXISTS (SELECT 1 FROM user_blocks b WHERE ` + blockedBetween("$1", "u.id") + `)
+			FROM users u
+			WHERE u.id = $2
+		`
 
-	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
-	defer cancel()
+		ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+		defer cancel()
+
+		var isPrivate, isBlocked bool
+		err := tx.QueryRowContext(ctxWTimeout, query, currentId, followId).Scan(&isPrivate, &isBlocked)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		switch {
+		case isBlocked:
+			return ErrBlocked
+		case isPrivate:
+			return ErrPrivateAccount
+		}
 
-	res, err := p.db.ExecContext(ctxWTimeout, query, currentId, followId)
+		query = `
+			INSERT INTO 
+				followers (user_id, follower_id ) 
+			VALUES 
+				($1, $2)
+		`
 
-	if err != nil {
+		_, err = tx.ExecContext(ctxWTimeout, query, currentId, followId)
+		if err != nil {
 
-		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
-			return ErrDuplicateKey
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrDuplicateKey
+			}
+
+			return err
 		}
 
-		return err
-	}
+		return nil
+	})
+}
 
-	rows, err := res.RowsAffected()
-	if err != nil {
+func (p FollowerStore) Unfollow(ctx context.Context, currentId int64, followId int64) error {
+	return withTx(p.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			DELETE FROM 
+				followers
+			WHERE 
+				user_id = $1 AND follower_id = $2
+			`
+
+		ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctxWTimeout, query, currentId, followId)
+
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		// the accepted request goes too, a private account can be asked again
+		query = `DELETE FROM follow_requests WHERE requester_id = $1 AND target_id = $2`
+
+		_, err = tx.ExecContext(ctxWTimeout, query, currentId, followId)
 		return err
-	}
+	})
+}
 
-	if rows == 0 {
-		return ErrNotFound
-	}
+// GetFollowers lists the users following userId, most recent first.
+func (p FollowerStore) GetFollowers(ctx context.Context, userId int64, viewerId int64, cq PaginationCursorQuery) ([]*FollowListEntry, *Cursor, error) {
+	// followers(user_id, follower_id) means user_id follows follower_id
+	return p.list(ctx, "f.follower_id", "f.user_id", userId, viewerId, cq)
+}
 
-	return nil
+// GetFollowing lists the users followed by userId, most recent first.
+func (p FollowerStore) GetFollowing(ctx context.Context, userId int64, viewerId int64, cq PaginationCursorQuery) ([]*FollowListEntry, *Cursor, error) {
+	return p.list(ctx, "f.user_id", "f.follower_id", userId, viewerId, cq)
 }
 
-func (p FollowerStore) Unfollow(ctx context.Context, currentId int64, followId int64) error {
+func (p FollowerStore) list(ctx context.Context, ownerCol string, listedCol string, userId int64, viewerId int64, cq PaginationCursorQuery) ([]*FollowListEntry, *Cursor, error) {
+
+	qb := newQueryBuilder(userId, viewerId).
+		Where(ownerCol+" = $1").
+		Where(canSeeAuthor("$1", "$2")).
+		Where(notBlocked("u.id", "$2")).
+		WhereTimeRange("f.created_at", cq.TimeRange)
+
+	if cq.Cursor != "" {
+		cursor, err := DecodeCursor(cq.Cursor)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		qb.WhereAfter("f.created_at", listedCol, "<", cursor)
+	}
+
 	query := `
-		DELETE FROM 
-			followers
-		WHERE 
-			user_id = $1 AND follower_id = $2
-		`
+		SELECT
+			u.id, u.username, f.created_at,
+			EXISTS (SELECT 1 FROM followers y WHERE y.user_id = u.id AND y.follower_id = $2) AS follows_you,
+			EXISTS (SELECT 1 FROM followers y WHERE y.user_id = $2 AND y.follower_id = u.id) AS you_follow
+		FROM followers f
+		JOIN users u ON u.id = ` + listedCol + `
+		WHERE
+			` + qb.Conditions() + `
+		ORDER BY f.created_at DESC, ` + listedCol + ` DESC
+		LIMIT ` + qb.Arg(cq.Limit+1) + `
+	`
 
 	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
 	defer cancel()
 
-	res, err := p.db.ExecContext(ctxWTimeout, query, currentId, followId)
-
+	rows, err := p.db.QueryContext(ctxWTimeout, query, qb.Args()...)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
+	defer rows.Close()
+
+	var entries []*FollowListEntry
+	for rows.Next() {
+		var e FollowListEntry
+		err := rows.Scan(
+			&e.User.ID,
+			&e.User.Username,
+			&e.FollowedAt,
+			&e.FollowsYou,
+			&e.YouFollow,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
 
-	rows, err := res.RowsAffected()
-	if err != nil {
-		return err
+		entries = append(entries, &e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
 	}
 
-	if rows == 0 {
-		return ErrNotFound
+	var next *Cursor
+	if len(entries) > cq.Limit {
+		entries = entries[:cq.Limit]
+		last := entries[len(entries)-1]
+		next = &Cursor{CreatedAt: last.FollowedAt, ID: last.User.ID}
 	}
 
-	return nil
+	return entries, next, nil
 }
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+)
+
+const (
+	ProfileAvatar = "avatar"
+	ProfileBanner = "banner"
+)
+
+// ImageSet maps the size label of a processed image (e.g. "48", "1500x500")
+// to the URL it is served from.
+type ImageSet map[string]string
+
+func (s ImageSet) Value() (driver.Value, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+
+	return json.Marshal(s)
+}
+
+func (s *ImageSet) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*s = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, s)
+	case string:
+		return json.Unmarshal([]byte(v), s)
+	default:
+		return errors.New("unsupported type for ImageSet")
+	}
+}
+
+// SetProfileImage replaces the avatar or banner of a user and returns the
+// previous one so its files can be removed.
+func (s *UserStore) SetProfileImage(ctx context.Context, userID int64, kind string, images ImageSet) (ImageSet, error) {
+	var column string
+	switch kind {
+	case ProfileAvatar:
+		column = "avatar"
+	case ProfileBanner:
+		column = "banner"
+	default:
+		return nil, errors.New("unknown profile image " + kind)
+	}
+
+	query := `
+		UPDATE users u
+		SET ` + column + ` = $1
+		FROM (SELECT id, ` + column + ` AS previous FROM users WHERE id = $2 FOR UPDATE) old
+		WHERE u.id = old.id
+		RETURNING old.previous
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	var previous ImageSet
+	if err := s.db.QueryRowContext(ctx, query, images, userID).Scan(&previous); err != nil {
+		return nil, err
+	}
+
+	return previous, nil
+}
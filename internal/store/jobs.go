@@ -0,0 +1,354 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	// JobDead is the dead letter state of jobs whose attempts ran out
+	JobDead = "dead"
+
+	defaultJobMaxAttempts = 5
+)
+
+// Job is a unit of background work, queued in the transaction of the change
+// that calls for it and run by cmd/worker. Its payload may carry secrets such
+// as activation links, so it's never serialized nor listed.
+type Job struct {
+	ID          int64           `json:"id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"-"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LastError   string          `json:"last_error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	CompletedAt *time.Time      `json:"completed_at"`
+}
+
+// NewJob returns a job of kind with payload encoded to JSON, to run now.
+func NewJob(kind string, payload any) (*Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Job{Kind: kind, Payload: data, MaxAttempts: defaultJobMaxAttempts}, nil
+}
+
+type JobQuery struct {
+	PaginationCursorQuery
+	Status string `json:"status" validate:"omitempty,oneof=pending running succeeded dead"`
+	Kind   string `json:"kind" validate:"max=100"`
+}
+
+func (jq JobQuery) Parse(r *http.Request) (JobQuery, error) {
+
+	cq, err := jq.PaginationCursorQuery.Parse(r)
+	if err != nil {
+		return jq, err
+	}
+	jq.PaginationCursorQuery = cq
+
+	qs := r.URL.Query()
+
+	if status := qs.Get("status"); status != "" {
+		jq.Status = status
+	}
+
+	if kind := qs.Get("kind"); kind != "" {
+		jq.Kind = kind
+	}
+
+	return jq, nil
+}
+
+type JobStore struct {
+	db *sql.DB
+}
+
+// Enqueue queues job on its own. Stores queue the jobs of their changes with
+// enqueueJob, inside the change's transaction.
+func (s *JobStore) Enqueue(ctx context.Context, job *Job) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return enqueueJob(ctx, tx, job)
+	})
+}
+
+func enqueueJob(ctx context.Context, tx *sql.Tx, job *Job) error {
+	query := `
+		INSERT INTO jobs (kind, payload, max_attempts, run_at)
+		VALUES ($1, $2, $3, COALESCE($4, NOW()))
+		RETURNING id, status, run_at, created_at
+	`
+
+	var runAt *time.Time
+	if !job.RunAt.IsZero() {
+		runAt = &job.RunAt
+	}
+
+	if job.MaxAttempts == 0 {
+		job.MaxAttempts = defaultJobMaxAttempts
+	}
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	return tx.QueryRowContext(ctxWTimeout, query, job.Kind, string(job.Payload), job.MaxAttempts, runAt).Scan(
+		&job.ID,
+		&job.Status,
+		&job.RunAt,
+		&job.CreatedAt,
+	)
+}
+
+// Claim leases up to limit jobs of kinds for visibility: pending jobs due to
+// run, and running ones whose worker let the lease expire, most likely by
+// crashing. Each claim counts as an attempt, so expired jobs that used them
+// all are dead-lettered instead of crashing workers forever.
+func (s *JobStore) Claim(ctx context.Context, kinds []string, limit int, visibility time.Duration) ([]*Job, error) {
+	var jobs []*Job
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			UPDATE jobs
+			SET status = 'dead', last_error = 'lease expired', locked_until = NULL, completed_at = NOW(), updated_at = NOW()
+			WHERE id IN (
+				SELECT id
+				FROM jobs
+				WHERE kind = ANY($1) AND status = 'running' AND locked_until <= NOW() AND attempts >= max_attempts
+				FOR UPDATE SKIP LOCKED
+			)
+		`
+
+		ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+		defer cancel()
+
+		if _, err := tx.ExecContext(ctxWTimeout, query, pq.Array(kinds)); err != nil {
+			return err
+		}
+
+		query = `
+			UPDATE jobs j
+			SET
+				status = 'running',
+				attempts = j.attempts + 1,
+				locked_until = NOW() + $3 * interval '1 millisecond',
+				updated_at = NOW()
+			WHERE j.id IN (
+				SELECT id
+				FROM jobs
+				WHERE
+					kind = ANY($1)
+					AND (
+						(status = 'pending' AND run_at <= NOW())
+						OR (status = 'running' AND locked_until <= NOW())
+					)
+				ORDER BY run_at, id
+				LIMIT $2
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING j.id, j.kind, j.payload, j.status, j.attempts, j.max_attempts, j.run_at, COALESCE(j.last_error, ''), j.created_at, j.completed_at
+		`
+
+		rows, err := tx.QueryContext(ctxWTimeout, query, pq.Array(kinds), limit, visibility.Milliseconds())
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		jobs, err = scanJobs(rows)
+		return err
+	})
+
+	return jobs, err
+}
+
+func scanJobs(rows *sql.Rows) ([]*Job, error) {
+	jobs := []*Job{}
+	for rows.Next() {
+		var job Job
+		err := rows.Scan(
+			&job.ID,
+			&job.Kind,
+			&job.Payload,
+			&job.Status,
+			&job.Attempts,
+			&job.MaxAttempts,
+			&job.RunAt,
+			&job.LastError,
+			&job.CreatedAt,
+			&job.CompletedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, &job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// Complete records the success of a claimed job. Outcomes are only recorded
+// for the latest attempt, ErrNotFound meaning another worker took it over.
+// The payload is cleared, it isn't needed anymore and may carry secrets.
+func (s *JobStore) Complete(ctx context.Context, job *Job) error {
+	query := `
+		UPDATE jobs
+		SET status = 'succeeded', payload = '{}', locked_until = NULL, completed_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND attempts = $2 AND status = 'running'
+	`
+
+	return s.exec(ctx, query, job.ID, job.Attempts)
+}
+
+// Fail records a failed attempt of a claimed job, running it again at retryAt
+// or dead-lettering it when nil.
+func (s *JobStore) Fail(ctx context.Context, job *Job, reason string, retryAt *time.Time) error {
+	query := `
+		UPDATE jobs
+		SET
+			status = CASE WHEN $3::timestamptz IS NULL THEN 'dead' ELSE 'pending' END,
+			run_at = COALESCE($3, run_at),
+			last_error = $2,
+			locked_until = NULL,
+			completed_at = CASE WHEN $3::timestamptz IS NULL THEN NOW() END,
+			updated_at = NOW()
+		WHERE id = $1 AND attempts = $4 AND status = 'running'
+	`
+
+	return s.exec(ctx, query, job.ID, reason, retryAt, job.Attempts)
+}
+
+// Retry gives a dead job a fresh set of attempts.
+func (s *JobStore) Retry(ctx context.Context, id int64) (*Job, error) {
+	query := `
+		UPDATE jobs
+		SET status = 'pending', attempts = 0, run_at = NOW(), completed_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = 'dead'
+		RETURNING id, kind, payload, status, attempts, max_attempts, run_at, COALESCE(last_error, ''), created_at, completed_at
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctxWTimeout, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs, err := scanJobs(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(jobs) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return jobs[0], nil
+}
+
+// List returns the jobs matching jq, the newest first.
+func (s *JobStore) List(ctx context.Context, jq JobQuery) ([]*Job, *Cursor, error) {
+
+	qb := newQueryBuilder().
+		WhereTimeRange("created_at", jq.TimeRange)
+
+	if jq.Status != "" {
+		qb.Where("status = ?", jq.Status)
+	}
+
+	if jq.Kind != "" {
+		qb.Where("kind = ?", jq.Kind)
+	}
+
+	if jq.Cursor != "" {
+		cursor, err := DecodeCursor(jq.Cursor)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		qb.WhereAfter("created_at", "id", "<", cursor)
+	}
+
+	query := `
+		SELECT id, kind, NULL, status, attempts, max_attempts, run_at, COALESCE(last_error, ''), created_at, completed_at
+		FROM jobs
+		WHERE
+			` + qb.Conditions() + `
+		ORDER BY created_at DESC, id DESC
+		LIMIT ` + qb.Arg(jq.Limit+1) + `
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctxWTimeout, query, qb.Args()...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	jobs, err := scanJobs(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var next *Cursor
+	if len(jobs) > jq.Limit {
+		jobs = jobs[:jq.Limit]
+		last := jobs[len(jobs)-1]
+		next = &Cursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+
+	return jobs, next, nil
+}
+
+// DeleteSucceeded removes the jobs that succeeded before, returning how many.
+// Dead jobs are kept until someone looks at them.
+func (s *JobStore) DeleteSucceeded(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM jobs WHERE status = 'succeeded' AND completed_at < $1`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctxWTimeout, query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (s *JobStore) exec(ctx context.Context, query string, args ...any) error {
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctxWTimeout, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PurgeExpiredTokens removes the invitation, email change and password reset
+// tokens that expired before, returning how many.
+func (s *UserStore) PurgeExpiredTokens(ctx context.Context, before time.Time) (int64, error) {
+	queries := []string{
+		`DELETE FROM user_invitation WHERE expiry < $1`,
+		`DELETE FROM user_email_changes WHERE expiry < $1`,
+		`DELETE FROM user_password_resets WHERE expiry < $1`,
+	}
+
+	var purged int64
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+		defer cancel()
+
+		for _, query := range queries {
+			res, err := tx.ExecContext(ctxWTimeout, query, before)
+			if err != nil {
+				return err
+			}
+
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			purged += n
+		}
+
+		return nil
+	})
+
+	return purged, err
+}
+
+// ExpireFiles detaches up to limit export files that expired before and
+// returns their keys, for the caller to delete them.
+func (s *ExportStore) ExpireFiles(ctx context.Context, before time.Time, limit int) ([]string, error) {
+	query := `
+		WITH expired AS (
+			SELECT id, file_key
+			FROM data_exports
+			WHERE status = 'completed' AND file_key IS NOT NULL AND expires_at < $1
+			ORDER BY expires_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE data_exports d
+		SET file_key = NULL
+		FROM expired e
+		WHERE d.id = e.id
+		RETURNING e.file_key
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctxWTimeout, query, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// RecomputeCounts fixes the follower and following counts of users that
+// drifted from the followers table, returning the users that were off. It
+// scans every user, so it's bound by ctx rather than the usual query timeout.
+func (p FollowerStore) RecomputeCounts(ctx context.Context) ([]int64, error) {
+	// followers(user_id, follower_id) means user_id follows follower_id
+	query := `
+		WITH counts AS (
+			SELECT
+				u.id,
+				(SELECT COUNT(*) FROM followers f WHERE f.follower_id = u.id) AS followers_count,
+				(SELECT COUNT(*) FROM followers f WHERE f.user_id = u.id) AS following_count
+			FROM users u
+		)
+		UPDATE users u
+		SET followers_count = c.followers_count, following_count = c.following_count
+		FROM counts c
+		WHERE u.id = c.id AND (u.followers_count <> c.followers_count OR u.following_count <> c.following_count)
+		RETURNING u.id
+	`
+
+	rows, err := p.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
@@ -0,0 +1,219 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	DeliveryInstant = "instant"
+	DeliveryDigest  = "digest"
+	DeliveryOff     = "off"
+)
+
+var ErrUnknownNotificationKind = errors.New("unknown notification kind")
+
+// DefaultDeliveries is how each kind of notification is emailed until the
+// user says otherwise. What needs an answer is sent right away.
+var DefaultDeliveries = map[string]string{
+	NotificationFollow:                DeliveryDigest,
+	NotificationFollowRequest:         DeliveryInstant,
+	NotificationFollowRequestAccepted: DeliveryDigest,
+	NotificationComment:               DeliveryDigest,
+	NotificationMention:               DeliveryInstant,
+	NotificationReaction:              DeliveryDigest,
+}
+
+// NotificationPreferences maps each kind of notification to its delivery.
+type NotificationPreferences map[string]string
+
+// deliveryOf selects the delivery of notification n to its user, falling
+// back to DefaultDeliveries when they never picked one.
+var deliveryOf = func() string {
+	kinds := make([]string, 0, len(DefaultDeliveries))
+	for kind := range DefaultDeliveries {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	var sb strings.Builder
+	sb.WriteString(`COALESCE(
+		(SELECT np.delivery FROM notification_preferences np WHERE np.user_id = n.user_id AND np.kind = n.kind),
+		CASE n.kind`)
+	for _, kind := range kinds {
+		sb.WriteString(` WHEN '` + kind + `' THEN '` + DefaultDeliveries[kind] + `'`)
+	}
+	sb.WriteString(` END)`)
+
+	return sb.String()
+}()
+
+// GetPreferences returns the delivery of every kind of notification for userId.
+func (s *NotificationStore) GetPreferences(ctx context.Context, userId int64) (NotificationPreferences, error) {
+	query := `SELECT kind, delivery FROM notification_preferences WHERE user_id = $1`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctxWTimeout, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prefs := NotificationPreferences{}
+	for kind, delivery := range DefaultDeliveries {
+		prefs[kind] = delivery
+	}
+
+	for rows.Next() {
+		var kind, delivery string
+		if err := rows.Scan(&kind, &delivery); err != nil {
+			return nil, err
+		}
+
+		if _, ok := DefaultDeliveries[kind]; ok {
+			prefs[kind] = delivery
+		}
+	}
+
+	return prefs, rows.Err()
+}
+
+// SetPreferences changes the delivery of the kinds in prefs, leaving the
+// others as they are. It fails with ErrNotFound once the user is gone.
+func (s *NotificationStore) SetPreferences(ctx context.Context, userId int64, prefs NotificationPreferences) error {
+	for kind := range prefs {
+		if _, ok := DefaultDeliveries[kind]; !ok {
+			return ErrUnknownNotificationKind
+		}
+	}
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO notification_preferences (user_id, kind, delivery)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (user_id, kind) DO UPDATE SET delivery = EXCLUDED.delivery, updated_at = NOW()
+		`
+
+		ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+		defer cancel()
+
+		for kind, delivery := range prefs {
+			if _, err := tx.ExecContext(ctxWTimeout, query, userId, kind, delivery); err != nil {
+				if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+					return ErrNotFound
+				}
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetDelivery returns how the notification id should be emailed to userId,
+// or DeliveryOff once it was emailed or read: a group is emailed only once.
+func (s *NotificationStore) GetDelivery(ctx context.Context, userId int64, id int64) (string, error) {
+	query := `
+		SELECT CASE WHEN n.read_at IS NULL AND n.emailed_at IS NULL THEN ` + deliveryOf + ` ELSE 'off' END
+		FROM notifications n
+		WHERE n.user_id = $1 AND n.id = $2
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	var delivery string
+	err := s.db.QueryRowContext(ctxWTimeout, query, userId, id).Scan(&delivery)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrNotFound
+		default:
+			return "", err
+		}
+	}
+
+	return delivery, nil
+}
+
+// GetDueDigests returns the active users with notifications waiting for a
+// digest and no digest sent after before.
+func (s *NotificationStore) GetDueDigests(ctx context.Context, before time.Time, limit int) ([]int64, error) {
+	query := `
+		SELECT u.id
+		FROM users u
+		WHERE
+			u.is_active
+			AND u.deleted_at IS NULL
+			AND (u.digest_sent_at IS NULL OR u.digest_sent_at <= $1)
+			AND EXISTS (
+				SELECT 1 FROM notifications n
+				WHERE n.user_id = u.id AND n.read_at IS NULL AND n.emailed_at IS NULL AND ` + deliveryOf + ` = 'digest'
+					AND ` + hasVisibleActor("u.id") + `
+			)
+		ORDER BY u.digest_sent_at NULLS FIRST, u.id
+		LIMIT $2
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctxWTimeout, query, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// GetDigest returns the unread notifications of userId waiting for a digest,
+// the most recently updated first.
+func (s *NotificationStore) GetDigest(ctx context.Context, userId int64, limit int) ([]*Notification, error) {
+	query := notificationSelect + `
+		WHERE n.user_id = $1 AND n.read_at IS NULL AND n.emailed_at IS NULL AND ` + deliveryOf + ` = 'digest'
+			AND ` + hasVisibleActor("$1") + `
+		ORDER BY n.updated_at DESC, n.id DESC
+		LIMIT $2
+	`
+
+	return s.query(ctx, query, userId, limit)
+}
+
+// MarkEmailed records that the notifications ids of userId were emailed, so
+// they aren't sent again, and with digest that their digest just went out.
+func (s *NotificationStore) MarkEmailed(ctx context.Context, userId int64, ids []int64, digest bool) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+		defer cancel()
+
+		query := `UPDATE notifications SET emailed_at = NOW() WHERE user_id = $1 AND id = ANY($2)`
+		if _, err := tx.ExecContext(ctxWTimeout, query, userId, pq.Array(ids)); err != nil {
+			return err
+		}
+
+		if !digest {
+			return nil
+		}
+
+		_, err := tx.ExecContext(ctxWTimeout, `UPDATE users SET digest_sent_at = NOW() WHERE id = $1`, userId)
+		return err
+	})
+}
@@ -0,0 +1,409 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	NotificationFollow                = "follow"
+	NotificationFollowRequest         = "follow_request"
+	NotificationFollowRequestAccepted = "follow_request_accepted"
+	NotificationComment               = "comment"
+	NotificationMention               = "mention"
+	NotificationReaction              = "reaction"
+)
+
+// notificationActorsShown is how many of the latest actors of a group are listed.
+const notificationActorsShown = 3
+
+var notificationVerbs = map[string]string{
+	NotificationFollow:                "followed you",
+	NotificationFollowRequest:         "asked to follow you",
+	NotificationFollowRequestAccepted: "accepted your follow request",
+	NotificationComment:               "commented on your post",
+	NotificationMention:               "mentioned you",
+	NotificationReaction:              "reacted to your post",
+}
+
+// NewNotification is something ActorID did that UserID should hear about.
+type NewNotification struct {
+	UserID    int64
+	ActorID   int64
+	Kind      string
+	PostID    *int64
+	CommentID *int64
+}
+
+// groupKey is shared by the notifications folded into one while unread:
+// every follower, or every comment or reaction on a post. Mentions stand alone.
+func (n NewNotification) groupKey() string {
+	switch n.Kind {
+	case NotificationComment, NotificationReaction:
+		return fmt.Sprintf("%s:post:%d", n.Kind, *n.PostID)
+	case NotificationMention:
+		if n.CommentID != nil {
+			return fmt.Sprintf("%s:comment:%d", n.Kind, *n.CommentID)
+		}
+		return fmt.Sprintf("%s:post:%d", n.Kind, *n.PostID)
+	default:
+		return n.Kind
+	}
+}
+
+type NotificationActor struct {
+	ID       int64    `json:"id"`
+	Username string   `json:"username"`
+	Avatar   ImageSet `json:"avatar,omitempty"`
+}
+
+// Notification groups the events of one kind about the same thing, e.g.
+// every reaction to a post since the user last read about them.
+type Notification struct {
+	ID        int64  `json:"id"`
+	Kind      string `json:"kind"`
+	PostID    *int64 `json:"post_id,omitempty"`
+	CommentID *int64 `json:"comment_id,omitempty"`
+	// Actors are the latest users behind the notification, ActorCount all of them.
+	Actors     []NotificationActor `json:"actors"`
+	ActorCount int64               `json:"actor_count"`
+	Summary    string              `json:"summary"`
+	CreatedAt  time.Time           `json:"created_at"`
+	UpdatedAt  time.Time           `json:"updated_at"`
+	ReadAt     *time.Time          `json:"read_at"`
+}
+
+// summarize describes the notification, e.g. "alice and 4 others reacted to your post".
+func (n *Notification) summarize() {
+	if len(n.Actors) == 0 {
+		return
+	}
+
+	who := n.Actors[0].Username
+	switch {
+	case n.ActorCount == 2 && len(n.Actors) > 1:
+		who += " and " + n.Actors[1].Username
+	case n.ActorCount == 2:
+		who += " and 1 other"
+	case n.ActorCount > 2:
+		who += fmt.Sprintf(" and %d others", n.ActorCount-1)
+	}
+
+	n.Summary = who + " " + notificationVerbs[n.Kind]
+}
+
+type NotificationQuery struct {
+	PaginationCursorQuery
+	Unread bool `json:"unread"`
+}
+
+func (nq NotificationQuery) Parse(r *http.Request) (NotificationQuery, error) {
+
+	cq, err := nq.PaginationCursorQuery.Parse(r)
+	if err != nil {
+		return nq, err
+	}
+	nq.PaginationCursorQuery = cq
+
+	unread := r.URL.Query().Get("unread")
+	if unread != "" {
+		u, err := strconv.ParseBool(unread)
+		if err != nil {
+			return nq, err
+		}
+
+		nq.Unread = u
+	}
+
+	return nq, nil
+}
+
+type NotificationStore struct {
+	db *sql.DB
+}
+
+// Add records n, folding it into the unread notification of its group when
+// there's one. It returns the id of the notification, or zero when the user
+// doesn't want to hear from the actor: themselves, blocked or muted.
+func (s *NotificationStore) Add(ctx context.Context, n NewNotification) (int64, error) {
+	var id int64
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+
+		query := `
+			INSERT INTO notifications (user_id, kind, post_id, comment_id, group_key)
+			SELECT $1::bigint, $3, $4::bigint, $5::bigint, $6
+			WHERE
+				$1::bigint <> $2::bigint
+				AND NOT EXISTS (SELECT 1 FROM user_blocks b WHERE ` + blockedBetween("$1", "$2") + `)
+				AND ` + notMuted("$2", "$1") + `
+			ON CONFLICT (user_id, group_key) WHERE read_at IS NULL
+			DO UPDATE SET updated_at = NOW()
+			RETURNING id
+		`
+
+		ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+		defer cancel()
+
+		err := tx.QueryRowContext(ctxWTimeout, query, n.UserID, n.ActorID, n.Kind, n.PostID, n.CommentID, n.groupKey()).Scan(&id)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return nil
+			default:
+				return err
+			}
+		}
+
+		query = `
+			INSERT INTO notification_actors (notification_id, actor_id)
+			VALUES ($1, $2)
+			ON CONFLICT (notification_id, actor_id) DO UPDATE SET created_at = NOW()
+		`
+
+		_, err = tx.ExecContext(ctxWTimeout, query, id, n.ActorID)
+		return err
+	})
+
+	return id, err
+}
+
+// notificationActorRows are the actors of notification n that user hasn't
+// blocked, muted or been blocked by.
+func notificationActorRows(user string) string {
+	return `
+	SELECT na.actor_id, na.created_at
+	FROM notification_actors na
+	WHERE na.notification_id = n.id AND ` + notBlocked("na.actor_id", user) + ` AND ` + notMuted("na.actor_id", user)
+}
+
+// hasVisibleActor holds for the notifications n that user can still see an
+// actor of. The others are hidden everywhere, counts included.
+func hasVisibleActor(user string) string {
+	return `EXISTS (` + notificationActorRows(user) + `)`
+}
+
+// notificationSelect lists the notifications of the user bound to $1, with
+// their actor count and latest actors.
+var notificationSelect = `
+		SELECT
+			n.id, n.kind, n.post_id, n.comment_id, n.created_at, n.updated_at, n.read_at,
+			(SELECT COUNT(*) FROM (` + notificationActorRows("$1") + `) a),
+			COALESCE((
+				SELECT json_agg(json_build_object('id', u.id, 'username', u.username, 'avatar', u.avatar) ORDER BY a.created_at DESC)
+				FROM (` + notificationActorRows("$1") + `
+					ORDER BY na.created_at DESC
+					LIMIT ` + strconv.Itoa(notificationActorsShown) + `
+				) a
+				JOIN users u ON u.id = a.actor_id
+			), '[]')
+		FROM notifications n`
+
+func (s *NotificationStore) GetByID(ctx context.Context, userId int64, id int64) (*Notification, error) {
+	query := notificationSelect + `
+		WHERE n.user_id = $1 AND n.id = $2 AND ` + hasVisibleActor("$1") + `
+	`
+
+	notifications, err := s.query(ctx, query, userId, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(notifications) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return notifications[0], nil
+}
+
+// List returns the notifications of userId, the most recently updated first.
+func (s *NotificationStore) List(ctx context.Context, userId int64, nq NotificationQuery) ([]*Notification, *Cursor, error) {
+
+	qb := newQueryBuilder(userId).
+		Where("n.user_id = $1").
+		Where(hasVisibleActor("$1")).
+		WhereTimeRange("n.updated_at", nq.TimeRange)
+
+	if nq.Unread {
+		qb.Where("n.read_at IS NULL")
+	}
+
+	if nq.Cursor != "" {
+		cursor, err := DecodeCursor(nq.Cursor)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		qb.WhereAfter("n.updated_at", "n.id", "<", cursor)
+	}
+
+	query := notificationSelect + `
+		WHERE
+			` + qb.Conditions() + `
+		ORDER BY n.updated_at DESC, n.id DESC
+		LIMIT ` + qb.Arg(nq.Limit+1) + `
+	`
+
+	notifications, err := s.query(ctx, query, qb.Args()...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var next *Cursor
+	if len(notifications) > nq.Limit {
+		notifications = notifications[:nq.Limit]
+		last := notifications[len(notifications)-1]
+		next = &Cursor{CreatedAt: last.UpdatedAt, ID: last.ID}
+	}
+
+	return notifications, next, nil
+}
+
+// query runs a query selecting notificationSelect.
+func (s *NotificationStore) query(ctx context.Context, query string, args ...any) ([]*Notification, error) {
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctxWTimeout, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []*Notification{}
+	for rows.Next() {
+		var n Notification
+		var actors []byte
+
+		err := rows.Scan(&n.ID, &n.Kind, &n.PostID, &n.CommentID, &n.CreatedAt, &n.UpdatedAt, &n.ReadAt, &n.ActorCount, &actors)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(actors, &n.Actors); err != nil {
+			return nil, err
+		}
+
+		n.summarize()
+		notifications = append(notifications, &n)
+	}
+
+	return notifications, rows.Err()
+}
+
+// UnreadCount counts the unread notifications of userId.
+func (s *NotificationStore) UnreadCount(ctx context.Context, userId int64) (int64, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM notifications n
+		WHERE n.user_id = $1 AND n.read_at IS NULL AND ` + hasVisibleActor("$1") + `
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	var count int64
+	if err := s.db.QueryRowContext(ctxWTimeout, query, userId).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (s *NotificationStore) MarkRead(ctx context.Context, userId int64, id int64) error {
+	query := `
+		UPDATE notifications
+		SET read_at = COALESCE(read_at, NOW())
+		WHERE user_id = $1 AND id = $2
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctxWTimeout, query, userId, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// MarkAllRead marks every unread notification of userId as read, returning
+// how many there were.
+func (s *NotificationStore) MarkAllRead(ctx context.Context, userId int64) (int64, error) {
+	query := `UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctxWTimeout, query, userId)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// ResolveMentions returns the users named in usernames who can see postId,
+// other than its author: they're the ones notified of being mentioned.
+func (s *NotificationStore) ResolveMentions(ctx context.Context, actorId int64, postId int64, usernames []string) ([]int64, error) {
+	if len(usernames) == 0 {
+		return nil, nil
+	}
+
+	lowered := make([]string, len(usernames))
+	for i, u := range usernames {
+		lowered[i] = strings.ToLower(u)
+	}
+
+	query := `
+		SELECT u.id
+		FROM users u
+		JOIN posts p ON p.id = $2
+		WHERE
+			lower(u.username) = ANY($3)
+			AND u.id <> $1
+			AND u.is_active
+			AND u.deleted_at IS NULL
+			AND ` + canSeeAuthor("p.user_id", "u.id") + `
+			AND ` + notBlocked("p.user_id", "u.id") + `
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctxWTimeout, query, actorId, postId, pq.Array(lowered))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
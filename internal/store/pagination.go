@@ -1,7 +1,12 @@
 package store
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -12,9 +17,14 @@ type PaginationFeedQuery struct {
 	Offset int      `json:"offset" validate:"gte=0"`
 	Sort   string   `json:"sort" validate:"oneof=asc desc"`
 	Tags   []string `json:"tags" validate:"max=5"`
-	Search string   `json:"search" validate:"max=100"`
-	Since  string   `json:"since"`
-	Until  string   `json:"util"`
+	// TagsMode is how Tags filter posts: having all of them, any of them or none.
+	TagsMode string `json:"tags_mode" validate:"oneof=any all none"`
+	Search   string `json:"search" validate:"max=100"`
+	Cursor   string `json:"cursor" validate:"max=200,excluded_with=Offset,excluded_if=Mode ranked"`
+	// Mode picks the chronological feed or the ranked "For You" one.
+	Mode    string `json:"mode" validate:"oneof=chronological ranked"`
+	Explain bool   `json:"explain"`
+	TimeRange
 }
 
 func (fq PaginationFeedQuery) Parse(r *http.Request) (PaginationFeedQuery, error) {
@@ -51,30 +61,192 @@ func (fq PaginationFeedQuery) Parse(r *http.Request) (PaginationFeedQuery, error
 		fq.Tags = strings.Split(tags, ",")
 	}
 
+	tagsMode := qs.Get("tags_mode")
+	if tagsMode != "" {
+		fq.TagsMode = tagsMode
+	}
+
 	search := qs.Get("search")
 	if search != "" {
 		fq.Search = search
 	}
 
-	since := qs.Get("since")
-	if since != "" {
-		fq.Since = parseTime(since)
+	cursor := qs.Get("cursor")
+	if cursor != "" {
+		if _, err := DecodeCursor(cursor); err != nil {
+			return fq, err
+		}
+
+		fq.Cursor = cursor
+	}
+
+	mode := qs.Get("mode")
+	if mode != "" {
+		fq.Mode = mode
+	}
+
+	explain := qs.Get("explain")
+	if explain != "" {
+		e, err := strconv.ParseBool(explain)
+		if err != nil {
+			return fq, err
+		}
+
+		fq.Explain = e
 	}
 
-	util := qs.Get("util")
-	if util != "" {
-		fq.Until = parseTime(util)
+	tr, err := ParseTimeRange(qs, time.Now())
+	if err != nil {
+		return fq, err
 	}
+	fq.TimeRange = tr
 
 	return fq, nil
 
 }
 
-func parseTime(s string) string {
-	t, err := time.Parse(time.DateTime, s)
+// TimeRange is the created_at window of a listing, [Since, Until).
+type TimeRange struct {
+	Since *time.Time `json:"since,omitempty"`
+	Until *time.Time `json:"until,omitempty"`
+}
+
+// ParseTimeRange reads the since and until parameters. Each one is either
+// an RFC 3339 timestamp or a signed offset from now such as -24h or -7d.
+// "util" is still accepted for until, it's what the feed used to read.
+func ParseTimeRange(qs url.Values, now time.Time) (TimeRange, error) {
+	var tr TimeRange
+
+	if since := qs.Get("since"); since != "" {
+		t, err := parseTimeValue(since, now)
+		if err != nil {
+			return tr, fmt.Errorf("invalid since: %w", err)
+		}
+		tr.Since = &t
+	}
+
+	until := qs.Get("until")
+	if until == "" {
+		until = qs.Get("util")
+	}
+
+	if until != "" {
+		t, err := parseTimeValue(until, now)
+		if err != nil {
+			return tr, fmt.Errorf("invalid until: %w", err)
+		}
+		tr.Until = &t
+	}
+
+	if tr.Since != nil && tr.Until != nil && !tr.Since.Before(*tr.Until) {
+		return tr, errors.New("since must be before until")
+	}
+
+	return tr, nil
+}
+
+func parseTimeValue(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	// the format the feed documented before RFC 3339, read as UTC
+	if t, err := time.Parse(time.DateTime, s); err == nil {
+		return t, nil
+	}
+
+	if s[0] != '-' && s[0] != '+' {
+		return time.Time{}, fmt.Errorf("%q is neither an RFC 3339 timestamp nor a relative time like -24h", s)
+	}
+
+	// time.ParseDuration has no days
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%q is not a valid number of days", s)
+		}
+		return now.AddDate(0, 0, n), nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not a valid relative time", s)
+	}
+
+	return now.Add(d), nil
+}
+
+type PaginationCursorQuery struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=50"`
+	Cursor string `json:"cursor" validate:"max=200"`
+	TimeRange
+}
+
+func (cq PaginationCursorQuery) Parse(r *http.Request) (PaginationCursorQuery, error) {
+
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return cq, err
+		}
+
+		cq.Limit = l
+	}
+
+	cursor := qs.Get("cursor")
+	if cursor != "" {
+		if _, err := DecodeCursor(cursor); err != nil {
+			return cq, err
+		}
+
+		cq.Cursor = cursor
+	}
+
+	tr, err := ParseTimeRange(qs, time.Now())
 	if err != nil {
-		return ""
+		return cq, err
+	}
+	cq.TimeRange = tr
+
+	return cq, nil
+
+}
+
+// Cursor is the position of the last item of a page in a keyset paginated
+// listing ordered by (created_at, id). It travels to clients as an opaque token.
+type Cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        int64     `json:"id"`
+	// Prev cursors page backwards, towards the items before this one.
+	Prev bool `json:"p,omitempty"`
+}
+
+// PageCursors point to the pages around the current one of a listing that
+// can be walked in both directions. A nil cursor means there's no such page.
+type PageCursors struct {
+	Next *Cursor
+	Prev *Cursor
+}
+
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeCursor(token string) (Cursor, error) {
+	var c Cursor
+
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	if err := json.Unmarshal(data, &c); err != nil || c.CreatedAt.IsZero() {
+		return c, ErrInvalidCursor
 	}
 
-	return t.UTC().Format(time.DateTime)
+	return c, nil
 }
@@ -0,0 +1,169 @@
+package store
+
+import (
+	"context"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type PostSearchQuery struct {
+	Q        string   `json:"q" validate:"required,min=1,max=200"`
+	Language string   `json:"lang" validate:"oneof=simple english portuguese spanish french german italian"`
+	AuthorID int64    `json:"author_id" validate:"gte=0"`
+	Tags     []string `json:"tags" validate:"max=5"`
+	Limit    int      `json:"limit" validate:"gte=1,lte=50"`
+	Offset   int      `json:"offset" validate:"gte=0"`
+	TimeRange
+}
+
+func (sq PostSearchQuery) Parse(r *http.Request) (PostSearchQuery, error) {
+
+	qs := r.URL.Query()
+
+	sq.Q = strings.TrimSpace(qs.Get("q"))
+
+	if lang := qs.Get("lang"); lang != "" {
+		sq.Language = lang
+	}
+
+	if author := qs.Get("author_id"); author != "" {
+		a, err := strconv.ParseInt(author, 10, 64)
+		if err != nil {
+			return sq, err
+		}
+
+		sq.AuthorID = a
+	}
+
+	if tags := qs.Get("tags"); tags != "" {
+		sq.Tags = strings.Split(tags, ",")
+	}
+
+	tr, err := ParseTimeRange(qs, time.Now())
+	if err != nil {
+		return sq, err
+	}
+	sq.TimeRange = tr
+
+	if limit := qs.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return sq, err
+		}
+
+		sq.Limit = l
+	}
+
+	if offset := qs.Get("offset"); offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return sq, err
+		}
+
+		sq.Offset = o
+	}
+
+	return sq, nil
+}
+
+type PostSearchResult struct {
+	Post           Post    `json:"post"`
+	User           User    `json:"user"`
+	Rank           float64 `json:"rank"`
+	TitleHighlight string  `json:"title_highlight"`
+	Snippet        string  `json:"snippet"`
+}
+
+// ts_headline marks matches with these control characters so the text can be
+// HTML escaped before they're turned into <mark> tags.
+const (
+	highlightStart = "\x01"
+	highlightStop  = "\x02"
+)
+
+var highlightReplacer = strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>")
+
+func highlight(headline string) string {
+	return highlightReplacer.Replace(html.EscapeString(headline))
+}
+
+// SearchPosts runs a web-search style query ("quoted phrases", or, -negation)
+// over the posts the viewer can see, best matches first.
+func (p PostStore) SearchPosts(ctx context.Context, viewerId int64, sq PostSearchQuery) ([]*PostSearchResult, error) {
+
+	qb := newQueryBuilder(viewerId, sq.Language, sq.Q).
+		Where("p.search_vector @@ q").
+		Where(notBlocked("p.user_id", "$1")).
+		Where(canSeeAuthor("p.user_id", "$1")).
+		WhereTimeRange("p.created_at", sq.TimeRange)
+
+	if sq.AuthorID != 0 {
+		qb.Where("p.user_id = ?", sq.AuthorID)
+	}
+	if len(sq.Tags) > 0 {
+		qb.Where("p.tags @> ?", pq.Array(sq.Tags))
+	}
+
+	headlineOpts := `'StartSel=` + highlightStart + `, StopSel=` + highlightStop
+
+	query := `
+		SELECT
+			p.id, p.user_id, p.title, p.content, p.created_at, p.tags, p.language, p.version,
+			u.username, u.avatar,
+			ts_rank_cd(p.search_vector, q) AS rank,
+			ts_headline($2::regconfig, p.title, q, ` + headlineOpts + `, HighlightAll=true'),
+			ts_headline($2::regconfig, p.content, q, ` + headlineOpts + `, MaxFragments=2, MaxWords=30, MinWords=10')
+		FROM posts p
+		JOIN users u ON u.id = p.user_id,
+			websearch_to_tsquery($2::regconfig, $3) q
+		WHERE
+			` + qb.Conditions() + `
+		ORDER BY rank DESC, p.created_at DESC, p.id DESC
+		LIMIT ` + qb.Arg(sq.Limit) + ` OFFSET ` + qb.Arg(sq.Offset) + `
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	rows, err := p.db.QueryContext(ctxWTimeout, query, qb.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*PostSearchResult
+	for rows.Next() {
+		var res PostSearchResult
+		err := rows.Scan(
+			&res.Post.ID,
+			&res.Post.UserId,
+			&res.Post.Title,
+			&res.Post.Content,
+			&res.Post.CreatedAt,
+			pq.Array(&res.Post.Tags),
+			&res.Post.Language,
+			&res.Post.Version,
+			&res.User.Username,
+			&res.User.Avatar,
+			&res.Rank,
+			&res.TitleHighlight,
+			&res.Snippet,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		res.User.ID = res.Post.UserId
+		res.TitleHighlight = highlight(res.TitleHighlight)
+		res.Snippet = highlight(res.Snippet)
+
+		results = append(results, &res)
+	}
+
+	return results, rows.Err()
+}
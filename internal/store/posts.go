@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"slices"
+	"time"
 
 	"github.com/lib/pq"
 )
@@ -14,6 +16,7 @@ type Post struct {
 	Title     string    `json:"title"`
 	UserId    int64     `json:"user_id"`
 	Tags      []string  `json:"tags"`
+	Language  string    `json:"language"`
 	CreatedAt string    `json:"created_at"`
 	UpdatedAt string    `json:"updated_at"`
 	Comment   []Comment `json:"comments,omitempty"`
@@ -21,9 +24,10 @@ type Post struct {
 }
 
 type PostWithMetadata struct {
-	Post          Post  `json:"post"`
-	User          User  `json:"user"`
-	CountComments int64 `json:"total_comments"`
+	Post           Post  `json:"post"`
+	User           User  `json:"user"`
+	CountComments  int64 `json:"total_comments"`
+	CountReactions int64 `json:"total_reactions"`
 }
 
 type PostStore struct {
@@ -33,8 +37,9 @@ type PostStore struct {
 func (p PostStore) Create(ctx context.Context, post *Post) error {
 
 	query := `
-		INSERT INTO posts (content, title, user_id, tags)
-		VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at
+		INSERT INTO posts (content, title, user_id, tags, language)
+		VALUES ($1, $2, $3, $4, COALESCE(NULLIF($5, ''), 'english')::regconfig)
+		RETURNING id, language, created_at, updated_at
 	`
 
 	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
@@ -47,8 +52,10 @@ func (p PostStore) Create(ctx context.Context, post *Post) error {
 		post.Title,
 		post.UserId,
 		pq.Array(post.Tags),
+		post.Language,
 	).Scan(
 		&post.ID,
+		&post.Language,
 		&post.CreatedAt,
 		&post.UpdatedAt,
 	)
@@ -59,19 +66,19 @@ func (p PostStore) Create(ctx context.Context, post *Post) error {
 	return nil
 }
 
-func (p PostStore) GetByID(ctx context.Context, id int64) (*Post, error) {
+func (p PostStore) GetByID(ctx context.Context, id int64, viewerId int64) (*Post, error) {
 
 	query := `
-		SELECT id, user_id, title, content, created_at,  updated_at, tags, version
-		FROM posts
-		WHERE id = $1
+		SELECT id, user_id, title, content, created_at,  updated_at, tags, language, version
+		FROM posts p
+		WHERE id = $1 AND ` + notBlocked("p.user_id", "$2") + ` AND ` + canSeeAuthor("p.user_id", "$2") + `
 	`
 
 	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
 	defer cancel()
 
 	var post Post
-	err := p.db.QueryRowContext(ctxWTimeout, query, id).Scan(
+	err := p.db.QueryRowContext(ctxWTimeout, query, id, viewerId).Scan(
 		&post.ID,
 		&post.UserId,
 		&post.Title,
@@ -79,6 +86,7 @@ func (p PostStore) GetByID(ctx context.Context, id int64) (*Post, error) {
 		&post.CreatedAt,
 		&post.UpdatedAt,
 		pq.Array(&post.Tags),
+		&post.Language,
 		&post.Version,
 	)
 
@@ -94,75 +102,334 @@ func (p PostStore) GetByID(ctx context.Context, id int64) (*Post, error) {
 	return &post, nil
 }
 
-func (p PostStore) GetUserFeed(ctx context.Context, id int64, pagination PaginationFeedQuery) ([]*PostWithMetadata, error) {
+// GetUserFeed lists the posts of the users and tags id follows. Pages are
+// walked with the Offset or, when given, the Cursor of the query; the cursors
+// around the returned page are always filled in.
+func (p PostStore) GetUserFeed(ctx context.Context, id int64, pagination PaginationFeedQuery) ([]*PostWithMetadata, PageCursors, error) {
+
+	var cursors PageCursors
 
-	whereTags := ""
-	if len(pagination.Tags) > 0 {
-		whereTags = "and (p.tags @> $5)"
+	qb := newFeedQueryBuilder(id)
+	whereFeedFilters(qb, pagination)
+
+	// walking backwards reverses the order, the page is flipped back below
+	sort, cmp := pagination.Sort, ">"
+	if sort == "desc" {
+		cmp = "<"
+	}
+
+	var cursor Cursor
+	if pagination.Cursor != "" {
+		c, err := DecodeCursor(pagination.Cursor)
+		if err != nil {
+			return nil, cursors, err
+		}
+		cursor = c
+
+		if cursor.Prev {
+			sort, cmp = reverseSort(sort), reverseCmp(cmp)
+		}
+
+		qb.WhereAfter("p.created_at", "p.id", cmp, cursor)
+	}
+
+	query := feedSelect + `
+		WHERE
+			` + qb.Conditions() + `
+		ORDER BY p.created_at ` + sort + `, p.id ` + sort + `
+		LIMIT ` + qb.Arg(pagination.Limit+1) + ` OFFSET ` + qb.Arg(pagination.Offset) + `
+	`
+
+	feed, createdAt, err := p.queryFeed(ctx, query, qb.Args()...)
+	if err != nil {
+		return nil, cursors, err
+	}
+
+	hasMore := len(feed) > pagination.Limit
+	if hasMore {
+		feed = feed[:pagination.Limit]
+		createdAt = createdAt[:pagination.Limit]
+	}
+
+	if cursor.Prev {
+		slices.Reverse(feed)
+		slices.Reverse(createdAt)
+	}
+
+	if len(feed) == 0 {
+		// an empty page past the end can still go back to where it came from
+		if pagination.Cursor != "" {
+			back := cursor
+			back.Prev = !cursor.Prev
+			if back.Prev {
+				cursors.Prev = &back
+			} else {
+				cursors.Next = &back
+			}
+		}
+		return feed, cursors, nil
+	}
+
+	first, last := feed[0], feed[len(feed)-1]
+
+	// there's always a way back towards newer items, they may not exist yet
+	if !cursor.Prev || hasMore {
+		cursors.Prev = &Cursor{CreatedAt: createdAt[0], ID: first.Post.ID, Prev: true}
+	}
+	if cursor.Prev || hasMore {
+		cursors.Next = &Cursor{CreatedAt: createdAt[len(createdAt)-1], ID: last.Post.ID}
+	}
+
+	return feed, cursors, nil
+}
+
+// GetFeedByIDs hydrates the posts of a cached timeline, newest first. Posts
+// the viewer can no longer see in the feed are left out. Their exact creation
+// times come along, for cursors.
+func (p PostStore) GetFeedByIDs(ctx context.Context, viewerId int64, ids []int64) ([]*PostWithMetadata, []time.Time, error) {
+	if len(ids) == 0 {
+		return nil, nil, nil
+	}
+
+	qb := newFeedQueryBuilder(viewerId)
+	qb.Where("p.id = ANY(?)", pq.Array(ids))
+
+	query := feedSelect + `
+		WHERE
+			` + qb.Conditions() + `
+		ORDER BY p.id DESC
+	`
+
+	return p.queryFeed(ctx, query, qb.Args()...)
+}
+
+// GetTimelineIDs lists the ids of the newest feed posts of viewerId older than
+// beforeID (zero for no bound). celebrities picks the authors: those with at
+// least minFollowers followers, or the others, whose posts are fanned out.
+func (p PostStore) GetTimelineIDs(ctx context.Context, viewerId int64, minFollowers int64, celebrities bool, beforeID int64, limit int) ([]int64, error) {
+	qb := newFeedQueryBuilder(viewerId)
+
+	if celebrities {
+		qb.Where("p.user_id <> $1").Where("u.followers_count >= ?", minFollowers)
+	} else {
+		qb.Where("(p.user_id = $1 OR u.followers_count < ?)", minFollowers)
+	}
+
+	if beforeID > 0 {
+		qb.Where("p.id < ?", beforeID)
 	}
 
 	query := `
-	SELECT 
-			p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags,
-			u.username,
-			COUNT(c.id) AS comments_count
+		SELECT p.id
 		FROM posts p
-		LEFT JOIN comments c ON c.post_id = p.id
-		LEFT JOIN users u ON p.user_id = u.id
-		JOIN followers f ON f.follower_id = p.user_id OR p.user_id = $1
-		WHERE 
-			1=1
-			AND f.user_id = $1 
-			AND (p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%')
-			` + whereTags + `
-		GROUP BY p.id, u.username
-		ORDER BY p.created_at ` + pagination.Sort + `
-		LIMIT $2 OFFSET $3
-`
+		JOIN users u ON u.id = p.user_id
+		WHERE
+			` + qb.Conditions() + `
+		ORDER BY p.id DESC
+		LIMIT ` + qb.Arg(limit) + `
+	`
 
 	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
 	defer cancel()
 
-	arr := pq.Array(pagination.Tags)
-	var rows *sql.Rows
-	var err error
+	rows, err := p.db.QueryContext(ctxWTimeout, query, qb.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	if len(pagination.Tags) > 0 {
-		rows, err = p.db.QueryContext(ctxWTimeout, query, id, pagination.Limit, pagination.Offset, pagination.Search, arr)
-	} else {
-		rows, err = p.db.QueryContext(ctxWTimeout, query, id, pagination.Limit, pagination.Offset, pagination.Search)
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// GetAudienceIDs returns the users other than its author whose feed shows
+// postId: the followers of the author and, for public accounts, of its tags.
+func (p PostStore) GetAudienceIDs(ctx context.Context, postId int64) ([]int64, error) {
+	query := `
+		SELECT a.user_id
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		CROSS JOIN LATERAL (
+			SELECT f.user_id FROM followers f WHERE f.follower_id = p.user_id
+			UNION
+			SELECT tf.user_id FROM tag_follows tf WHERE tf.tag = ANY(p.tags) AND NOT u.is_private
+		) a
+		WHERE
+			p.id = $1
+			AND a.user_id <> p.user_id
+			AND ` + notBlocked("p.user_id", "a.user_id") + `
+			AND ` + notMuted("p.user_id", "a.user_id") + `
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
 
+	rows, err := p.db.QueryContext(ctxWTimeout, query, postId)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// FilterAudienceIDs returns the users among userIds who are in the
+// audience of postId, without listing the whole audience.
+func (p PostStore) FilterAudienceIDs(ctx context.Context, postId int64, userIds []int64) ([]int64, error) {
+	query := `
+		SELECT c.id
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		CROSS JOIN unnest($2::bigint[]) AS c(id)
+		WHERE
+			p.id = $1
+			AND c.id <> p.user_id
+			AND (
+				EXISTS (SELECT 1 FROM followers f WHERE f.user_id = c.id AND f.follower_id = p.user_id)
+				OR (NOT u.is_private AND EXISTS (SELECT 1 FROM tag_follows tf WHERE tf.user_id = c.id AND tf.tag = ANY(p.tags)))
+			)
+			AND ` + notBlocked("p.user_id", "c.id") + `
+			AND ` + notMuted("p.user_id", "c.id") + `
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	rows, err := p.db.QueryContext(ctxWTimeout, query, postId, pq.Array(userIds))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+const feedSelect = `
+		SELECT
+			p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags,
+			u.username, u.avatar,
+			(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count,
+			(SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = p.id) AS reactions_count
+		FROM posts p
+		JOIN users u ON u.id = p.user_id`
+
+// newFeedQueryBuilder starts a query over the posts in the feed of viewerId,
+// bound to $1: their own, those of the users they follow and those with a
+// tag they follow.
+func newFeedQueryBuilder(viewerId int64) *queryBuilder {
+	return newQueryBuilder(viewerId).
+		Where(`(p.user_id = $1
+			OR EXISTS (SELECT 1 FROM followers f WHERE f.user_id = $1 AND f.follower_id = p.user_id)
+			OR EXISTS (SELECT 1 FROM tag_follows tf WHERE tf.user_id = $1 AND tf.tag = ANY(p.tags)))`).
+		Where(notBlocked("p.user_id", "$1")).
+		Where(notMuted("p.user_id", "$1")).
+		Where(canSeeAuthor("p.user_id", "$1"))
+}
+
+// whereFeedFilters applies the time range, search and tags of fq.
+func whereFeedFilters(qb *queryBuilder, fq PaginationFeedQuery) {
+	qb.WhereTimeRange("p.created_at", fq.TimeRange)
+
+	if fq.Search != "" {
+		qb.Where(`(p.title ILIKE '%' || ? || '%' OR p.content ILIKE '%' || ? || '%')`, fq.Search, fq.Search)
+	}
+
+	if len(fq.Tags) > 0 {
+		switch fq.TagsMode {
+		case "any":
+			qb.Where("p.tags && ?", pq.Array(fq.Tags))
+		case "none":
+			qb.Where("NOT COALESCE(p.tags && ?, false)", pq.Array(fq.Tags))
+		default:
+			qb.Where("p.tags @> ?", pq.Array(fq.Tags))
+		}
+	}
+}
+
+// queryFeed runs a query selecting feedSelect, returning the creation time of
+// each post next to it for cursors.
+func (p PostStore) queryFeed(ctx context.Context, query string, args ...any) ([]*PostWithMetadata, []time.Time, error) {
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	rows, err := p.db.QueryContext(ctxWTimeout, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
 	var feed []*PostWithMetadata
+	var createdAt []time.Time
 	for rows.Next() {
 
 		var p PostWithMetadata
+		var t time.Time
 		err := rows.Scan(
 			&p.Post.ID,
 			&p.Post.UserId,
 			&p.Post.Title,
 			&p.Post.Content,
-			&p.Post.CreatedAt,
+			&t,
 			&p.Post.Version,
 			pq.Array(&p.Post.Tags),
 			&p.User.Username,
+			&p.User.Avatar,
 			&p.CountComments,
+			&p.CountReactions,
 		)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
+		p.Post.CreatedAt = t.Format(time.RFC3339)
+		p.User.ID = p.Post.UserId
+
 		feed = append(feed, &p)
+		createdAt = append(createdAt, t)
 
 	}
 
-	return feed, nil
+	return feed, createdAt, rows.Err()
+}
+
+func reverseSort(sort string) string {
+	if sort == "desc" {
+		return "asc"
+	}
+	return "desc"
+}
+
+func reverseCmp(cmp string) string {
+	if cmp == "<" {
+		return ">"
+	}
+	return "<"
 }
 
 func (p PostStore) Delete(ctx context.Context, id int64) error {
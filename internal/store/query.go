@@ -0,0 +1,74 @@
+package store
+
+import (
+	"strconv"
+	"strings"
+)
+
+// queryBuilder collects the WHERE conditions of a listing query and numbers
+// their bind placeholders, so optional filters can be added in any order.
+// Conditions use "?" for their arguments; the fixed arguments given to
+// newQueryBuilder keep $1..$n and can be written literally in the query.
+type queryBuilder struct {
+	args  []any
+	conds []string
+}
+
+func newQueryBuilder(args ...any) *queryBuilder {
+	return &queryBuilder{args: args}
+}
+
+// Arg binds v and returns its placeholder.
+func (b *queryBuilder) Arg(v any) string {
+	b.args = append(b.args, v)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+// Where adds a condition, binding args to its "?" in order.
+func (b *queryBuilder) Where(cond string, args ...any) *queryBuilder {
+	var sb strings.Builder
+
+	for _, arg := range args {
+		i := strings.IndexByte(cond, '?')
+		if i < 0 {
+			break
+		}
+
+		sb.WriteString(cond[:i])
+		sb.WriteString(b.Arg(arg))
+		cond = cond[i+1:]
+	}
+	sb.WriteString(cond)
+
+	b.conds = append(b.conds, sb.String())
+	return b
+}
+
+// WhereTimeRange limits col to the window of tr, leaving open ends unbounded.
+func (b *queryBuilder) WhereTimeRange(col string, tr TimeRange) *queryBuilder {
+	if tr.Since != nil {
+		b.Where(col+" >= ?", *tr.Since)
+	}
+	if tr.Until != nil {
+		b.Where(col+" < ?", *tr.Until)
+	}
+	return b
+}
+
+// WhereAfter keeps the rows past cursor in keyset order, cmp being "<" for
+// descending listings and ">" for ascending ones.
+func (b *queryBuilder) WhereAfter(timeCol string, idCol string, cmp string, cursor Cursor) *queryBuilder {
+	return b.Where("("+timeCol+", "+idCol+") "+cmp+" (?, ?)", cursor.CreatedAt, cursor.ID)
+}
+
+// Conditions returns the conditions joined with AND, or TRUE when there are none.
+func (b *queryBuilder) Conditions() string {
+	if len(b.conds) == 0 {
+		return "TRUE"
+	}
+	return strings.Join(b.conds, "\n\t\t\tAND ")
+}
+
+func (b *queryBuilder) Args() []any {
+	return b.args
+}
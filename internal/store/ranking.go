@@ -0,0 +1,108 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// rankingAffinityWindow is how far back the interactions of the viewer count
+// towards their affinity with authors and tags.
+const rankingAffinityWindow = "30 days"
+
+// RankingCandidate is a feed post with the signals the ranked feed scores.
+type RankingCandidate struct {
+	PostWithMetadata
+	CreatedAt time.Time
+	// AuthorAffinity counts the recent comments and reactions of the viewer
+	// on posts of the same author.
+	AuthorAffinity int64
+	// TagAffinity counts the recent comments and reactions of the viewer on
+	// posts sharing a tag with this one.
+	TagAffinity int64
+}
+
+// GetRankingCandidates returns the newest posts of the feed of viewerId
+// matching the filters of fq, with their ranking signals.
+func (p PostStore) GetRankingCandidates(ctx context.Context, viewerId int64, fq PaginationFeedQuery, limit int) ([]*RankingCandidate, error) {
+
+	qb := newFeedQueryBuilder(viewerId)
+	whereFeedFilters(qb, fq)
+
+	query := `
+		WITH interactions AS (
+			SELECT post_id FROM comments
+			WHERE user_id = $1 AND created_at > NOW() - INTERVAL '` + rankingAffinityWindow + `'
+			UNION ALL
+			SELECT post_id FROM post_reactions
+			WHERE user_id = $1 AND created_at > NOW() - INTERVAL '` + rankingAffinityWindow + `'
+		),
+		author_affinity AS (
+			SELECT ip.user_id AS author_id, COUNT(*) AS n
+			FROM interactions i
+			JOIN posts ip ON ip.id = i.post_id
+			WHERE ip.user_id <> $1
+			GROUP BY ip.user_id
+		),
+		tag_affinity AS (
+			SELECT tag, COUNT(*) AS n
+			FROM interactions i
+			JOIN posts ip ON ip.id = i.post_id,
+				unnest(ip.tags) AS tag
+			GROUP BY tag
+		)
+		SELECT
+			p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags,
+			u.username, u.avatar,
+			(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count,
+			(SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = p.id) AS reactions_count,
+			COALESCE((SELECT aa.n FROM author_affinity aa WHERE aa.author_id = p.user_id), 0),
+			COALESCE((SELECT SUM(ta.n) FROM tag_affinity ta WHERE ta.tag = ANY(p.tags)), 0)
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		WHERE
+			` + qb.Conditions() + `
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT ` + qb.Arg(limit) + `
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	rows, err := p.db.QueryContext(ctxWTimeout, query, qb.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []*RankingCandidate
+	for rows.Next() {
+		var c RankingCandidate
+		err := rows.Scan(
+			&c.Post.ID,
+			&c.Post.UserId,
+			&c.Post.Title,
+			&c.Post.Content,
+			&c.CreatedAt,
+			&c.Post.Version,
+			pq.Array(&c.Post.Tags),
+			&c.User.Username,
+			&c.User.Avatar,
+			&c.CountComments,
+			&c.CountReactions,
+			&c.AuthorAffinity,
+			&c.TagAffinity,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		c.Post.CreatedAt = c.CreatedAt.Format(time.RFC3339)
+		c.User.ID = c.Post.UserId
+
+		candidates = append(candidates, &c)
+	}
+
+	return candidates, rows.Err()
+}
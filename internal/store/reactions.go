@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type Reaction struct {
+	PostId    int64     `json:"post_id"`
+	UserId    int64     `json:"user_id"`
+	Kind      string    `json:"kind"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ReactionStore struct {
+	db *sql.DB
+}
+
+// React sets the reaction of a user to a post, replacing any previous one.
+func (s *ReactionStore) React(ctx context.Context, reaction *Reaction) error {
+
+	// like comments, posts hidden by a block or a private account behave as if they didn't exist
+	query := `
+		INSERT INTO post_reactions (post_id, user_id, kind)
+		SELECT p.id, $2, $3
+		FROM posts p
+		WHERE p.id = $1 AND ` + notBlocked("p.user_id", "$2") + ` AND ` + canSeeAuthor("p.user_id", "$2") + `
+		ON CONFLICT (post_id, user_id) DO UPDATE
+			SET kind = EXCLUDED.kind, created_at = NOW()
+		RETURNING created_at
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctxWTimeout, query, reaction.PostId, reaction.UserId, reaction.Kind).Scan(&reaction.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *ReactionStore) Unreact(ctx context.Context, postId int64, userId int64) error {
+	query := `DELETE FROM post_reactions WHERE post_id = $1 AND user_id = $2`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctxWTimeout, query, postId, userId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -3,8 +3,19 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
 )
 
+// BuiltinRoles are referenced by name in the code and can't be renamed,
+// moved to another level or deleted.
+var BuiltinRoles = map[string]bool{
+	"user":      true,
+	"moderator": true,
+	"admin":     true,
+}
+
 type Role struct {
 	ID          int64  `json:"id"`
 	Name        string `json:"name"`
@@ -19,11 +30,169 @@ type RoleStore struct {
 func (s *RoleStore) GetByName(ctx context.Context, slug string) (*Role, error) {
 	query := `SELECT id, name, description, level FROM roles WHERE name = $1`
 
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
 	role := &Role{}
-	err := s.db.QueryRowContext(ctx, query, slug).Scan(&role.ID, &role.Name, &role.Description, &role.Level)
+	err := s.db.QueryRowContext(ctxWTimeout, query, slug).Scan(&role.ID, &role.Name, &role.Description, &role.Level)
 	if err != nil {
-		return nil, err
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
 	}
 
 	return role, nil
 }
+
+func (s *RoleStore) GetByID(ctx context.Context, id int64) (*Role, error) {
+	query := `SELECT id, name, description, level FROM roles WHERE id = $1`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	role := &Role{}
+	err := s.db.QueryRowContext(ctxWTimeout, query, id).Scan(&role.ID, &role.Name, &role.Description, &role.Level)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return role, nil
+}
+
+func (s *RoleStore) List(ctx context.Context) ([]*Role, error) {
+	query := `SELECT id, name, description, level FROM roles ORDER BY level, name`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctxWTimeout, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []*Role
+	for rows.Next() {
+		role := &Role{}
+		if err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.Level); err != nil {
+			return nil, err
+		}
+
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+func (s *RoleStore) Create(ctx context.Context, role *Role) error {
+	query := `
+		INSERT INTO roles (name, description, level)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctxWTimeout, query, role.Name, role.Description, role.Level).Scan(&role.ID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrDuplicateKey
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (s *RoleStore) Update(ctx context.Context, role *Role) error {
+	query := `
+		UPDATE roles
+		SET name = $1, description = $2, level = $3
+		WHERE id = $4
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctxWTimeout, query, role.Name, role.Description, role.Level, role.ID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrDuplicateKey
+		}
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetHolderIDs lists the users who have the role.
+func (s *RoleStore) GetHolderIDs(ctx context.Context, id int64) ([]int64, error) {
+	query := `SELECT id FROM users WHERE role_id = $1`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctxWTimeout, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// Delete removes a role, failing with ErrRoleInUse while users still have it.
+func (s *RoleStore) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM roles WHERE id = $1`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctxWTimeout, query, id)
+	if err != nil {
+		// users.role_id still references it
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return ErrRoleInUse
+		}
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
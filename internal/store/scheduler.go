@@ -0,0 +1,280 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"time"
+)
+
+const (
+	RunRunning   = "running"
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+
+	// schedulerLockSpace namespaces the advisory locks of scheduled jobs,
+	// keyed by the hash of their name
+	schedulerLockSpace = 7050
+)
+
+// ScheduledRun is one run of a scheduled job, by its cron schedule or
+// triggered by an admin.
+type ScheduledRun struct {
+	ID           int64      `json:"id"`
+	Name         string     `json:"name"`
+	ScheduledFor *time.Time `json:"scheduled_for"`
+	TriggeredBy  *int64     `json:"triggered_by,omitempty"`
+	Status       string     `json:"status"`
+	Error        string     `json:"error,omitempty"`
+	Instance     string     `json:"instance"`
+	StartedAt    time.Time  `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at"`
+	DurationMs   *int64     `json:"duration_ms"`
+}
+
+type ScheduledRunQuery struct {
+	PaginationCursorQuery
+	Name   string `json:"name" validate:"max=100"`
+	Status string `json:"status" validate:"omitempty,oneof=running succeeded failed"`
+}
+
+func (rq ScheduledRunQuery) Parse(r *http.Request) (ScheduledRunQuery, error) {
+
+	cq, err := rq.PaginationCursorQuery.Parse(r)
+	if err != nil {
+		return rq, err
+	}
+	rq.PaginationCursorQuery = cq
+
+	qs := r.URL.Query()
+
+	if name := qs.Get("name"); name != "" {
+		rq.Name = name
+	}
+
+	if status := qs.Get("status"); status != "" {
+		rq.Status = status
+	}
+
+	return rq, nil
+}
+
+type SchedulerStore struct {
+	db *sql.DB
+}
+
+// TryLock takes the advisory lock of the job name without waiting. The lock
+// lives on a connection held until unlock, and goes away with it if the
+// instance dies.
+func (s *SchedulerStore) TryLock(ctx context.Context, name string) (func(), bool, error) {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	var locked bool
+	err = conn.QueryRowContext(ctxWTimeout, `SELECT pg_try_advisory_lock($1, hashtext($2))`, schedulerLockSpace, name).Scan(&locked)
+	if err != nil || !locked {
+		conn.Close()
+		return nil, false, err
+	}
+
+	unlock := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), TimeOutTime)
+		defer cancel()
+
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1, hashtext($2))`, schedulerLockSpace, name); err != nil {
+			// the connection would go back to the pool still holding the
+			// lock, it's discarded instead
+			_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}
+
+	return unlock, true, nil
+}
+
+// StartRun records the start of run, under the lock of its job. Scheduled
+// runs start once per tick: false means another instance already ran it.
+// Runs still marked as running are leftovers of crashed instances, as
+// nobody else holds the lock.
+func (s *SchedulerStore) StartRun(ctx context.Context, run *ScheduledRun) (bool, error) {
+	started := false
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+		defer cancel()
+
+		query := `
+			UPDATE scheduled_job_runs
+			SET status = 'failed', error = 'interrupted', finished_at = NOW()
+			WHERE name = $1 AND status = 'running'
+		`
+
+		if _, err := tx.ExecContext(ctxWTimeout, query, run.Name); err != nil {
+			return err
+		}
+
+		query = `
+			INSERT INTO scheduled_job_runs (name, scheduled_for, triggered_by, instance)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (name, scheduled_for) DO NOTHING
+			RETURNING id, status, started_at
+		`
+
+		err := tx.QueryRowContext(ctxWTimeout, query, run.Name, run.ScheduledFor, run.TriggeredBy, run.Instance).Scan(
+			&run.ID,
+			&run.Status,
+			&run.StartedAt,
+		)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil
+		case err != nil:
+			return err
+		}
+
+		started = true
+		return nil
+	})
+
+	return started, err
+}
+
+// FinishRun records the outcome of run.
+func (s *SchedulerStore) FinishRun(ctx context.Context, run *ScheduledRun) error {
+	query := `
+		UPDATE scheduled_job_runs
+		SET status = $2, error = NULLIF($3, ''), finished_at = NOW(), duration_ms = $4
+		WHERE id = $1
+		RETURNING finished_at
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctxWTimeout, query, run.ID, run.Status, run.Error, run.DurationMs).Scan(&run.FinishedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+const scheduledRunColumns = `id, name, scheduled_for, triggered_by, status, COALESCE(error, ''), instance, started_at, finished_at, duration_ms`
+
+// ListRuns returns the run history matching rq, the most recent first.
+func (s *SchedulerStore) ListRuns(ctx context.Context, rq ScheduledRunQuery) ([]*ScheduledRun, *Cursor, error) {
+
+	qb := newQueryBuilder().
+		WhereTimeRange("started_at", rq.TimeRange)
+
+	if rq.Name != "" {
+		qb.Where("name = ?", rq.Name)
+	}
+
+	if rq.Status != "" {
+		qb.Where("status = ?", rq.Status)
+	}
+
+	if rq.Cursor != "" {
+		cursor, err := DecodeCursor(rq.Cursor)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		qb.WhereAfter("started_at", "id", "<", cursor)
+	}
+
+	query := `
+		SELECT ` + scheduledRunColumns + `
+		FROM scheduled_job_runs
+		WHERE
+			` + qb.Conditions() + `
+		ORDER BY started_at DESC, id DESC
+		LIMIT ` + qb.Arg(rq.Limit+1) + `
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctxWTimeout, query, qb.Args()...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	runs, err := scanScheduledRuns(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var next *Cursor
+	if len(runs) > rq.Limit {
+		runs = runs[:rq.Limit]
+		last := runs[len(runs)-1]
+		next = &Cursor{CreatedAt: last.StartedAt, ID: last.ID}
+	}
+
+	return runs, next, nil
+}
+
+// LastRuns returns the latest run of every job that ran, by name.
+func (s *SchedulerStore) LastRuns(ctx context.Context) (map[string]*ScheduledRun, error) {
+	query := `
+		SELECT DISTINCT ON (name) ` + scheduledRunColumns + `
+		FROM scheduled_job_runs
+		ORDER BY name, started_at DESC, id DESC
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctxWTimeout, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs, err := scanScheduledRuns(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	last := make(map[string]*ScheduledRun, len(runs))
+	for _, run := range runs {
+		last[run.Name] = run
+	}
+
+	return last, nil
+}
+
+func scanScheduledRuns(rows *sql.Rows) ([]*ScheduledRun, error) {
+	runs := []*ScheduledRun{}
+	for rows.Next() {
+		var run ScheduledRun
+		err := rows.Scan(
+			&run.ID,
+			&run.Name,
+			&run.ScheduledFor,
+			&run.TriggeredBy,
+			&run.Status,
+			&run.Error,
+			&run.Instance,
+			&run.StartedAt,
+			&run.FinishedAt,
+			&run.DurationMs,
+		)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, &run)
+	}
+
+	return runs, rows.Err()
+}
@@ -3,6 +3,7 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"time"
 )
@@ -13,44 +14,184 @@ var (
 	TimeOutTime          = time.Second * 5
 	ErrDuplicateEmail    = errors.New("email already exists")
 	ErrDuplicateUsername = errors.New("username already exists")
+	ErrBlocked           = errors.New("user is blocked")
+	ErrInvalidCursor     = errors.New("invalid cursor")
+	ErrPrivateAccount    = errors.New("account is private")
+	ErrExportInProgress  = errors.New("an export is already in progress")
+	ErrRoleInUse         = errors.New("role is still assigned to users")
 )
 
 type Storage struct {
 	Posts interface {
 		Create(context.Context, *Post) error
-		GetByID(context.Context, int64) (*Post, error)
+		GetByID(ctx context.Context, id int64, viewerId int64) (*Post, error)
 		Delete(context.Context, int64) error
 		Update(context.Context, *Post) error
-		GetUserFeed(context.Context, int64, PaginationFeedQuery) ([]*PostWithMetadata, error)
+		GetUserFeed(context.Context, int64, PaginationFeedQuery) ([]*PostWithMetadata, PageCursors, error)
+		SearchPosts(ctx context.Context, viewerId int64, sq PostSearchQuery) ([]*PostSearchResult, error)
+		GetFeedByIDs(ctx context.Context, viewerId int64, ids []int64) ([]*PostWithMetadata, []time.Time, error)
+		GetTimelineIDs(ctx context.Context, viewerId int64, minFollowers int64, celebrities bool, beforeID int64, limit int) ([]int64, error)
+		GetAudienceIDs(ctx context.Context, postId int64) ([]int64, error)
+		FilterAudienceIDs(ctx context.Context, postId int64, userIds []int64) ([]int64, error)
+		GetRankingCandidates(ctx context.Context, viewerId int64, fq PaginationFeedQuery, limit int) ([]*RankingCandidate, error)
+		GetTrendingTags(ctx context.Context, window time.Duration, baselinePeriods int, minPosts int, limit int) ([]*TrendingTag, error)
+		GetPopularPostIDs(ctx context.Context, since time.Time, limit int) ([]int64, error)
+		GetExplorePosts(ctx context.Context, viewerId int64, ids []int64, eq ExploreQuery) ([]*PostWithMetadata, error)
 	}
 	Users interface {
 		Create(context.Context, *sql.Tx, *User) error
 		GetUserByEmail(context.Context, string) (*User, error)
 		GetById(ctx context.Context, id int64) (*User, error)
-		CreateAndInvite(context.Context, *User, string, time.Duration) error
+		CreateAndInvite(context.Context, *User, string, time.Duration, ...*Job) error
 		Activate(context.Context, string) error
 		Delete(ctx context.Context, id int64) error
+		SetPrivacy(ctx context.Context, id int64, isPrivate bool) error
+		UpdateProfile(ctx context.Context, user *User) error
+		UpdatePassword(ctx context.Context, user *User) error
+		CreateEmailChange(ctx context.Context, userID int64, newEmail string, token string, exp time.Duration) error
+		ConfirmEmailChange(ctx context.Context, token string) (*User, error)
+		SetProfileImage(ctx context.Context, userID int64, kind string, images ImageSet) (ImageSet, error)
+		ScheduleDeletion(ctx context.Context, id int64, at time.Time) error
+		CancelDeletion(ctx context.Context, id int64) error
+		GetDueDeletions(ctx context.Context, now time.Time, limit int) ([]int64, error)
+		Purge(ctx context.Context, id int64, anonymize bool) (*PurgedAccount, error)
+		Search(ctx context.Context, aq AdminUserQuery) ([]*User, error)
+		SearchByName(ctx context.Context, viewerId int64, uq UserSearchQuery) ([]*UserSearchResult, error)
+		Suggestions(ctx context.Context, viewerId int64, limit int) ([]*UserSearchResult, error)
+		SetRole(ctx context.Context, id int64, roleID int64) error
+		ActivateByID(ctx context.Context, id int64) error
+		ForcePasswordReset(ctx context.Context, id int64, token string, exp time.Duration) error
+		ResetPassword(ctx context.Context, token string, user *User) error
+		PurgeExpiredTokens(ctx context.Context, before time.Time) (int64, error)
 	}
 	Comments interface {
-		GetByPostId(ctx context.Context, postId int64) ([]Comment, error)
+		GetByPostId(ctx context.Context, postId int64, viewerId int64) ([]Comment, error)
 		Create(context.Context, *Comment) error
 	}
 	Follower interface {
 		Follow(ctx context.Context, currentId int64, followId int64) error
 		Unfollow(ctx context.Context, currentId int64, followId int64) error
+		GetFollowers(ctx context.Context, userId int64, viewerId int64, cq PaginationCursorQuery) ([]*FollowListEntry, *Cursor, error)
+		GetFollowing(ctx context.Context, userId int64, viewerId int64, cq PaginationCursorQuery) ([]*FollowListEntry, *Cursor, error)
+		RecomputeCounts(ctx context.Context) ([]int64, error)
+	}
+	FollowRequests interface {
+		Create(ctx context.Context, requesterId int64, targetId int64) (*FollowRequest, error)
+		Get(ctx context.Context, requesterId int64, targetId int64) (*FollowRequest, error)
+		GetPending(ctx context.Context, targetId int64, cq PaginationCursorQuery) ([]*FollowRequest, *Cursor, error)
+		Accept(ctx context.Context, targetId int64, requesterId int64) error
+		Reject(ctx context.Context, targetId int64, requesterId int64) error
+	}
+	Blocks interface {
+		Block(ctx context.Context, blockerId int64, blockedId int64) error
+		Unblock(ctx context.Context, blockerId int64, blockedId int64) error
+		Mute(ctx context.Context, userId int64, mutedId int64) error
+		Unmute(ctx context.Context, userId int64, mutedId int64) error
+		IsBlocked(ctx context.Context, userId int64, otherId int64) (bool, error)
+		GetBlockedIDs(ctx context.Context, userId int64) ([]int64, error)
+	}
+	Exports interface {
+		Create(ctx context.Context, userID int64) (*DataExport, error)
+		GetByID(ctx context.Context, id int64) (*DataExport, error)
+		MarkRunning(ctx context.Context, id int64) error
+		Complete(ctx context.Context, id int64, fileKey string, expiresAt time.Time) error
+		Fail(ctx context.Context, id int64, reason string) error
+		Section(ctx context.Context, userID int64, section string) (json.RawMessage, error)
+		ExpireFiles(ctx context.Context, before time.Time, limit int) ([]string, error)
+	}
+	Reactions interface {
+		React(ctx context.Context, reaction *Reaction) error
+		Unreact(ctx context.Context, postId int64, userId int64) error
+	}
+	TagFollows interface {
+		Follow(ctx context.Context, userId int64, tag string) error
+		Unfollow(ctx context.Context, userId int64, tag string) error
+		List(ctx context.Context, userId int64) ([]*TagFollow, error)
+	}
+	Notifications interface {
+		Add(ctx context.Context, n NewNotification) (int64, error)
+		GetByID(ctx context.Context, userId int64, id int64) (*Notification, error)
+		List(ctx context.Context, userId int64, nq NotificationQuery) ([]*Notification, *Cursor, error)
+		UnreadCount(ctx context.Context, userId int64) (int64, error)
+		MarkRead(ctx context.Context, userId int64, id int64) error
+		MarkAllRead(ctx context.Context, userId int64) (int64, error)
+		ResolveMentions(ctx context.Context, actorId int64, postId int64, usernames []string) ([]int64, error)
+		GetPreferences(ctx context.Context, userId int64) (NotificationPreferences, error)
+		SetPreferences(ctx context.Context, userId int64, prefs NotificationPreferences) error
+		GetDelivery(ctx context.Context, userId int64, id int64) (string, error)
+		GetDueDigests(ctx context.Context, before time.Time, limit int) ([]int64, error)
+		GetDigest(ctx context.Context, userId int64, limit int) ([]*Notification, error)
+		MarkEmailed(ctx context.Context, userId int64, ids []int64, digest bool) error
+	}
+	Conversations interface {
+		Create(ctx context.Context, creatorId int64, participantIds []int64, title string) (int64, bool, error)
+		GetByID(ctx context.Context, id int64, userId int64) (*Conversation, error)
+		List(ctx context.Context, userId int64, cq PaginationCursorQuery) ([]*Conversation, *Cursor, error)
+		GetMessages(ctx context.Context, conversationId int64, userId int64, cq PaginationCursorQuery) ([]*Message, *Cursor, error)
+		SendMessage(ctx context.Context, msg *Message) error
+		MarkRead(ctx context.Context, conversationId int64, userId int64, messageId *int64) (*ConversationParticipant, error)
+	}
+	Webhooks interface {
+		Create(ctx context.Context, webhook *Webhook) error
+		GetByID(ctx context.Context, id int64, userId int64) (*Webhook, error)
+		List(ctx context.Context, userId int64) ([]*Webhook, error)
+		Update(ctx context.Context, webhook *Webhook) error
+		Delete(ctx context.Context, id int64, userId int64) error
+		GetDeliveries(ctx context.Context, webhookId int64, cq PaginationCursorQuery) ([]*WebhookDelivery, *Cursor, error)
+		Enqueue(ctx context.Context, userId int64, event string, payload []byte, leaseUntil time.Time) ([]*WebhookDelivery, error)
+		ClaimDue(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]*WebhookDelivery, error)
+		RecordSuccess(ctx context.Context, d *WebhookDelivery, responseStatus int) error
+		RecordFailure(ctx context.Context, d *WebhookDelivery, responseStatus int, reason string, retryAt *time.Time, maxFailures int) (bool, error)
+	}
+	Jobs interface {
+		Enqueue(ctx context.Context, job *Job) error
+		Claim(ctx context.Context, kinds []string, limit int, visibility time.Duration) ([]*Job, error)
+		Complete(ctx context.Context, job *Job) error
+		Fail(ctx context.Context, job *Job, reason string, retryAt *time.Time) error
+		Retry(ctx context.Context, id int64) (*Job, error)
+		List(ctx context.Context, jq JobQuery) ([]*Job, *Cursor, error)
+		DeleteSucceeded(ctx context.Context, before time.Time) (int64, error)
+	}
+	Scheduler interface {
+		TryLock(ctx context.Context, name string) (func(), bool, error)
+		StartRun(ctx context.Context, run *ScheduledRun) (bool, error)
+		FinishRun(ctx context.Context, run *ScheduledRun) error
+		ListRuns(ctx context.Context, rq ScheduledRunQuery) ([]*ScheduledRun, *Cursor, error)
+		LastRuns(ctx context.Context) (map[string]*ScheduledRun, error)
+	}
+	Audit interface {
+		Create(ctx context.Context, entry *AuditLogEntry) error
+		List(ctx context.Context, targetUserID int64, cq PaginationCursorQuery) ([]*AuditLogEntry, *Cursor, error)
 	}
 	Role interface {
 		GetByName(ctx context.Context, slug string) (*Role, error)
+		GetByID(ctx context.Context, id int64) (*Role, error)
+		List(ctx context.Context) ([]*Role, error)
+		Create(ctx context.Context, role *Role) error
+		Update(ctx context.Context, role *Role) error
+		GetHolderIDs(ctx context.Context, id int64) ([]int64, error)
+		Delete(ctx context.Context, id int64) error
 	}
 }
 
 func NewStorage(db *sql.DB) Storage {
 	return Storage{
-		Posts:    &PostStore{db},
-		Users:    &UserStore{db},
-		Comments: &CommentStore{db},
-		Follower: &FollowerStore{db},
-		Role:     &RoleStore{db},
+		Posts:          &PostStore{db},
+		Users:          &UserStore{db},
+		Comments:       &CommentStore{db},
+		Follower:       &FollowerStore{db},
+		FollowRequests: &FollowRequestStore{db},
+		Blocks:         &BlockStore{db},
+		Exports:        &ExportStore{db},
+		Audit:          &AuditStore{db},
+		Reactions:      &ReactionStore{db},
+		TagFollows:     &TagFollowStore{db},
+		Notifications:  &NotificationStore{db},
+		Conversations:  &ConversationStore{db},
+		Webhooks:       &WebhookStore{db},
+		Jobs:           &JobStore{db},
+		Scheduler:      &SchedulerStore{db},
+		Role:           &RoleStore{db},
 	}
 }
 
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrTooManyTags is returned when following one more tag would go over
+// MaxFollowedTags.
+var ErrTooManyTags = errors.New("too many followed tags")
+
+// MaxFollowedTags bounds the tags a user follows, each one widens their feed.
+const MaxFollowedTags = 100
+
+// TagFollow is a tag whose posts show up in the feed of the user following it.
+type TagFollow struct {
+	Tag       string    `json:"tag"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type TagFollowStore struct {
+	db *sql.DB
+}
+
+func (s *TagFollowStore) Follow(ctx context.Context, userId int64, tag string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+
+		ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+		defer cancel()
+
+		// serializes concurrent follows of the same user for the count below
+		query := `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`
+		if _, err := tx.ExecContext(ctxWTimeout, query, userId); err != nil {
+			return err
+		}
+
+		query = `SELECT COUNT(*) FROM tag_follows WHERE user_id = $1`
+
+		var count int
+		if err := tx.QueryRowContext(ctxWTimeout, query, userId).Scan(&count); err != nil {
+			return err
+		}
+
+		if count >= MaxFollowedTags {
+			return ErrTooManyTags
+		}
+
+		query = `
+			INSERT INTO
+				tag_follows (user_id, tag)
+			VALUES
+				($1, $2)
+		`
+
+		if _, err := tx.ExecContext(ctxWTimeout, query, userId, tag); err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrDuplicateKey
+			}
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (s *TagFollowStore) Unfollow(ctx context.Context, userId int64, tag string) error {
+	query := `
+		DELETE FROM
+			tag_follows
+		WHERE
+			user_id = $1 AND tag = $2
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctxWTimeout, query, userId, tag)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// List returns the tags userId follows, most recent first.
+func (s *TagFollowStore) List(ctx context.Context, userId int64) ([]*TagFollow, error) {
+	query := `
+		SELECT tag, created_at
+		FROM tag_follows
+		WHERE user_id = $1
+		ORDER BY created_at DESC, tag
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctxWTimeout, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*TagFollow{}
+	for rows.Next() {
+		var t TagFollow
+		if err := rows.Scan(&t.Tag, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		tags = append(tags, &t)
+	}
+
+	return tags, rows.Err()
+}
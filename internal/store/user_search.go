@@ -0,0 +1,169 @@
+package store
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type UserSearchQuery struct {
+	Q      string `json:"q" validate:"required,min=1,max=100"`
+	Limit  int    `json:"limit" validate:"gte=1,lte=50"`
+	Offset int    `json:"offset" validate:"gte=0"`
+}
+
+func (uq UserSearchQuery) Parse(r *http.Request) (UserSearchQuery, error) {
+
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return uq, err
+		}
+
+		uq.Limit = l
+	}
+
+	offset := qs.Get("offset")
+	if offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return uq, err
+		}
+
+		uq.Offset = o
+	}
+
+	uq.Q = strings.TrimSpace(qs.Get("q"))
+
+	return uq, nil
+}
+
+// UserSearchResult is a user found by a search or suggested to the viewer.
+type UserSearchResult struct {
+	User        User    `json:"user"`
+	Score       float64 `json:"score,omitempty"`
+	MutualCount int     `json:"mutual_count,omitempty"`
+	YouFollow   bool    `json:"you_follow"`
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchByName finds users whose username or display name starts with or looks
+// like the query. Exact and prefix matches rank first, then trigram similarity.
+func (s *UserStore) SearchByName(ctx context.Context, viewerId int64, uq UserSearchQuery) ([]*UserSearchResult, error) {
+	query := `
+		SELECT
+			u.id, u.username, u.display_name, u.avatar, u.is_private, u.followers_count,
+			EXISTS (SELECT 1 FROM followers f WHERE f.user_id = $2 AND f.follower_id = u.id) AS you_follow,
+			(CASE
+				WHEN lower(u.username) = lower($1) THEN 3
+				WHEN u.username ILIKE $5 || '%' THEN 2
+				WHEN u.display_name ILIKE $5 || '%' THEN 1
+				ELSE 0
+			END) + GREATEST(similarity(u.username, $1), similarity(u.display_name, $1)) AS score
+		FROM users u
+		WHERE
+			u.is_active
+			AND u.deleted_at IS NULL
+			AND u.id <> $2
+			AND ` + notBlocked("u.id", "$2") + `
+			AND (
+				u.username ILIKE $5 || '%'
+				OR u.display_name ILIKE $5 || '%'
+				OR u.username % $1
+				OR u.display_name % $1
+			)
+		ORDER BY score DESC, u.followers_count DESC, u.id
+		LIMIT $3 OFFSET $4
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctxWTimeout, query, uq.Q, viewerId, uq.Limit, uq.Offset, likeEscaper.Replace(uq.Q))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*UserSearchResult
+	for rows.Next() {
+		var res UserSearchResult
+		err := rows.Scan(
+			&res.User.ID,
+			&res.User.Username,
+			&res.User.DisplayName,
+			&res.User.Avatar,
+			&res.User.IsPrivate,
+			&res.User.FollowersCount,
+			&res.YouFollow,
+			&res.Score,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, &res)
+	}
+
+	return results, rows.Err()
+}
+
+// Suggestions lists the users followed by the people viewerId follows,
+// ranked by how many of them follow each one.
+func (s *UserStore) Suggestions(ctx context.Context, viewerId int64, limit int) ([]*UserSearchResult, error) {
+	query := `
+		SELECT
+			u.id, u.username, u.display_name, u.avatar, u.is_private, u.followers_count,
+			COUNT(*) AS mutual_count
+		FROM followers f1
+		JOIN followers f2 ON f2.user_id = f1.follower_id
+		JOIN users u ON u.id = f2.follower_id
+		WHERE
+			f1.user_id = $1
+			AND u.id <> $1
+			AND u.is_active
+			AND u.deleted_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM followers f WHERE f.user_id = $1 AND f.follower_id = u.id)
+			AND NOT EXISTS (SELECT 1 FROM follow_requests fr WHERE fr.requester_id = $1 AND fr.target_id = u.id AND fr.status = 'pending')
+			AND ` + notBlocked("u.id", "$1") + `
+			AND ` + notMuted("u.id", "$1") + `
+		GROUP BY u.id
+		ORDER BY mutual_count DESC, u.followers_count DESC, u.id
+		LIMIT $2
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctxWTimeout, query, viewerId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*UserSearchResult
+	for rows.Next() {
+		var res UserSearchResult
+		err := rows.Scan(
+			&res.User.ID,
+			&res.User.Username,
+			&res.User.DisplayName,
+			&res.User.Avatar,
+			&res.User.IsPrivate,
+			&res.User.FollowersCount,
+			&res.MutualCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, &res)
+	}
+
+	return results, rows.Err()
+}
@@ -5,20 +5,34 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
+	"errors"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
 type User struct {
-	ID        int64    `json:"id"`
-	Username  string   `json:"username"`
-	Password  password `json:"-"`
-	Email     string   `json:"email"`
-	CreatedAt string   `json:"created_at"`
-	IsActive  bool     `json:"is_active"`
-	RoleID    int64    `json:"role_id"`
-	Role      Role     `json:"role"`
+	ID          int64    `json:"id"`
+	Username    string   `json:"username"`
+	DisplayName string   `json:"display_name"`
+	Bio         string   `json:"bio"`
+	Password    password `json:"-"`
+	Email       string   `json:"email"`
+	CreatedAt   string   `json:"created_at"`
+	IsActive    bool     `json:"is_active"`
+	IsPrivate   bool     `json:"is_private"`
+	RoleID      int64    `json:"role_id"`
+	Role        Role     `json:"role"`
+
+	Avatar ImageSet `json:"avatar,omitempty"`
+	Banner ImageSet `json:"banner,omitempty"`
+
+	DeletionScheduledAt   *time.Time `json:"deletion_scheduled_at,omitempty"`
+	DeletedAt             *time.Time `json:"deleted_at,omitempty"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+
+	FollowersCount int64 `json:"followers_count"`
+	FollowingCount int64 `json:"following_count"`
 }
 
 type password struct {
@@ -38,6 +52,11 @@ func (p *password) Set(text string) error {
 	return nil
 }
 
+// Matches reports whether text is the plain password behind the stored hash.
+func (p *password) Matches(text string) bool {
+	return bcrypt.CompareHashAndPassword(p.hash, []byte(text)) == nil
+}
+
 type UserStore struct {
 	db *sql.DB
 }
@@ -71,7 +90,7 @@ func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
 }
 
 func (s *UserStore) GetById(ctx context.Context, id int64) (*User, error) {
-	query := `SELECT users.id, username, email, password, created_at, roles.*
+	query := `SELECT users.id, username, display_name, bio, email, password, created_at, avatar, banner, is_active, is_private, deletion_scheduled_at, deleted_at, password_reset_required, followers_count, following_count, roles.*
 		FROM users
 		JOIN roles ON (users.role_id = roles.id)
 		WHERE users.id = $1`
@@ -88,9 +107,20 @@ func (s *UserStore) GetById(ctx context.Context, id int64) (*User, error) {
 	).Scan(
 		&user.ID,
 		&user.Username,
+		&user.DisplayName,
+		&user.Bio,
 		&user.Email,
 		&user.Password.hash,
 		&user.CreatedAt,
+		&user.Avatar,
+		&user.Banner,
+		&user.IsActive,
+		&user.IsPrivate,
+		&user.DeletionScheduledAt,
+		&user.DeletedAt,
+		&user.PasswordResetRequired,
+		&user.FollowersCount,
+		&user.FollowingCount,
 		&user.Role.ID,
 		&user.Role.Name,
 		&user.Role.Level,
@@ -119,7 +149,9 @@ func (s *UserStore) createUserInvitation(ctx context.Context, tx *sql.Tx, token
 	return nil
 }
 
-func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token string, invitationExp time.Duration) error {
+// CreateAndInvite creates user with an invitation, queueing the jobs that
+// deliver it in the same transaction.
+func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token string, invitationExp time.Duration, jobs ...*Job) error {
 	return withTx(s.db, ctx, func(tx *sql.Tx) error {
 
 		if err := s.Create(ctx, tx, user); err != nil {
@@ -130,6 +162,12 @@ func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token strin
 			return err
 		}
 
+		for _, job := range jobs {
+			if err := enqueueJob(ctx, tx, job); err != nil {
+				return err
+			}
+		}
+
 		return nil
 
 	})
@@ -238,6 +276,10 @@ func (s *UserStore) delete(ctx context.Context, tx *sql.Tx, id int64) error {
 func (s *UserStore) Delete(ctx context.Context, id int64) error {
 	return withTx(s.db, ctx, func(tx *sql.Tx) error {
 
+		if err := s.deleteContent(ctx, tx, id); err != nil {
+			return err
+		}
+
 		if err := s.delete(ctx, tx, id); err != nil {
 			return err
 		}
@@ -252,7 +294,7 @@ func (s *UserStore) Delete(ctx context.Context, id int64) error {
 }
 
 func (s *UserStore) GetUserByEmail(ctx context.Context, email string) (*User, error) {
-	query := `SELECT id, username, email, created_at
+	query := `SELECT id, username, email, password, created_at, deletion_scheduled_at, password_reset_required
 		FROM users
 		WHERE email = $1 AND is_active = true`
 
@@ -261,7 +303,7 @@ func (s *UserStore) GetUserByEmail(ctx context.Context, email string) (*User, er
 
 	var user User
 
-	err := s.db.QueryRowContext(ctxWTimeout, query, email).Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt)
+	err := s.db.QueryRowContext(ctxWTimeout, query, email).Scan(&user.ID, &user.Username, &user.Email, &user.Password.hash, &user.CreatedAt, &user.DeletionScheduledAt, &user.PasswordResetRequired)
 
 	if err != nil {
 		switch err {
@@ -274,3 +316,158 @@ func (s *UserStore) GetUserByEmail(ctx context.Context, email string) (*User, er
 
 	return &user, nil
 }
+
+// SetPrivacy switches an account between public and private. Going public
+// accepts every pending follow request.
+func (s *UserStore) SetPrivacy(ctx context.Context, id int64, isPrivate bool) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+
+		ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctxWTimeout, `UPDATE users SET is_private = $1 WHERE id = $2`, isPrivate, id)
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		if isPrivate {
+			return nil
+		}
+
+		// requests from blocked users stay hidden instead of becoming follows
+		query := `
+			INSERT INTO followers (user_id, follower_id)
+			SELECT requester_id, target_id
+			FROM follow_requests
+			WHERE target_id = $1 AND status = 'pending' AND ` + notBlocked("requester_id", "target_id") + `
+			ON CONFLICT DO NOTHING
+		`
+
+		if _, err := tx.ExecContext(ctxWTimeout, query, id); err != nil {
+			return err
+		}
+
+		query = `
+			UPDATE follow_requests
+			SET status = 'accepted', updated_at = NOW()
+			WHERE target_id = $1 AND status = 'pending' AND ` + notBlocked("requester_id", "target_id") + `
+		`
+
+		_, err = tx.ExecContext(ctxWTimeout, query, id)
+		return err
+	})
+}
+
+func (s *UserStore) UpdateProfile(ctx context.Context, user *User) error {
+	query := `UPDATE users SET username = $1, display_name = $2, bio = $3 WHERE id = $4`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, user.Username, user.DisplayName, user.Bio, user.ID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_username_key"`:
+			return ErrDuplicateUsername
+		default:
+			return err
+		}
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *UserStore) UpdatePassword(ctx context.Context, user *User) error {
+	query := `UPDATE users SET password = $1 WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, user.Password.hash, user.ID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CreateEmailChange stores a pending change to newEmail, confirmed later with
+// the token sent to that address. Only the latest request of a user is kept.
+func (s *UserStore) CreateEmailChange(ctx context.Context, userID int64, newEmail string, token string, exp time.Duration) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+
+		ctx, cancel := context.WithTimeout(ctx, TimeOutTime)
+		defer cancel()
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM user_email_changes WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+
+		query := `INSERT INTO user_email_changes (token, user_id, new_email, expiry) VALUES ($1, $2, $3, $4)`
+
+		_, err := tx.ExecContext(ctx, query, token, userID, newEmail, time.Now().Add(exp))
+		return err
+	})
+}
+
+// ConfirmEmailChange applies the email change the plain token belongs to and
+// returns the updated user.
+func (s *UserStore) ConfirmEmailChange(ctx context.Context, token string) (*User, error) {
+	var user *User
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+
+		hash := sha256.Sum256([]byte(token))
+		hashToken := hex.EncodeToString(hash[:])
+
+		ctx, cancel := context.WithTimeout(ctx, TimeOutTime)
+		defer cancel()
+
+		query := `
+			UPDATE users u
+			SET email = ec.new_email
+			FROM user_email_changes ec
+			WHERE ec.user_id = u.id AND ec.token = $1 AND ec.expiry > $2
+			RETURNING u.id, u.username, u.email
+		`
+
+		user = &User{}
+		err := tx.QueryRowContext(ctx, query, hashToken, time.Now()).Scan(&user.ID, &user.Username, &user.Email)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+				return ErrDuplicateEmail
+			default:
+				return err
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM user_email_changes WHERE user_id = $1`, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
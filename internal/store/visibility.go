@@ -0,0 +1,30 @@
+package store
+
+// The helpers below build the SQL predicates shared by every query that
+// returns user-generated content. Arguments are column names or bind
+// placeholders (e.g. "p.user_id", "$1") and are concatenated as-is, so they
+// must never come from user input.
+
+// blockedBetween matches a user_blocks row aliased as "b" linking both users
+// in either direction.
+func blockedBetween(a, b string) string {
+	return `((b.blocker_id = ` + a + ` AND b.blocked_id = ` + b + `) OR (b.blocker_id = ` + b + ` AND b.blocked_id = ` + a + `))`
+}
+
+// notBlocked holds when neither the author nor the viewer has blocked the other.
+func notBlocked(authorCol, viewer string) string {
+	return `NOT EXISTS (SELECT 1 FROM user_blocks b WHERE ` + blockedBetween(authorCol, viewer) + `)`
+}
+
+// notMuted holds when the viewer has not muted the author.
+func notMuted(authorCol, viewer string) string {
+	return `NOT EXISTS (SELECT 1 FROM user_mutes m WHERE m.user_id = ` + viewer + ` AND m.muted_id = ` + authorCol + `)`
+}
+
+// canSeeAuthor holds when the author's account is public, is the viewer, or
+// is followed by the viewer. Private accounts only show up to accepted followers.
+func canSeeAuthor(authorCol, viewer string) string {
+	return `(` + authorCol + ` = ` + viewer + `
+		OR NOT EXISTS (SELECT 1 FROM users pu WHERE pu.id = ` + authorCol + ` AND pu.is_private)
+		OR EXISTS (SELECT 1 FROM followers pf WHERE pf.user_id = ` + viewer + ` AND pf.follower_id = ` + authorCol + `))`
+}
@@ -0,0 +1,403 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+
+	MaxWebhooksPerUser = 10
+)
+
+var ErrTooManyWebhooks = errors.New("too many webhooks")
+
+type Webhook struct {
+	ID     int64  `json:"id"`
+	UserID int64  `json:"user_id"`
+	URL    string `json:"url"`
+	// Secret is only shown when the webhook is created
+	Secret       string     `json:"secret,omitempty"`
+	Events       []string   `json:"events"`
+	IsActive     bool       `json:"is_active"`
+	FailureCount int        `json:"failure_count"`
+	DisabledAt   *time.Time `json:"disabled_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	WebhookID      int64           `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at"`
+	ResponseStatus *int            `json:"response_status"`
+	Error          string          `json:"error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+
+	// where a claimed delivery goes
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+type WebhookStore struct {
+	db *sql.DB
+}
+
+func (s *WebhookStore) Create(ctx context.Context, webhook *Webhook) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+
+		ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+		defer cancel()
+
+		// lock the user so concurrent creations can't exceed the limit
+		var count int
+		query := `SELECT (SELECT COUNT(*) FROM webhooks WHERE user_id = u.id) FROM users u WHERE u.id = $1 FOR UPDATE`
+		if err := tx.QueryRowContext(ctxWTimeout, query, webhook.UserID).Scan(&count); err != nil {
+			return err
+		}
+
+		if count >= MaxWebhooksPerUser {
+			return ErrTooManyWebhooks
+		}
+
+		query = `
+			INSERT INTO webhooks (user_id, url, secret, events)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id, is_active, failure_count, created_at, updated_at
+		`
+
+		return tx.QueryRowContext(ctxWTimeout, query, webhook.UserID, webhook.URL, webhook.Secret, pq.Array(webhook.Events)).Scan(
+			&webhook.ID,
+			&webhook.IsActive,
+			&webhook.FailureCount,
+			&webhook.CreatedAt,
+			&webhook.UpdatedAt,
+		)
+	})
+}
+
+const webhookColumns = `id, user_id, url, events, is_active, failure_count, disabled_at, created_at, updated_at`
+
+func scanWebhook(row interface{ Scan(...any) error }, webhook *Webhook) error {
+	return row.Scan(
+		&webhook.ID,
+		&webhook.UserID,
+		&webhook.URL,
+		pq.Array(&webhook.Events),
+		&webhook.IsActive,
+		&webhook.FailureCount,
+		&webhook.DisabledAt,
+		&webhook.CreatedAt,
+		&webhook.UpdatedAt,
+	)
+}
+
+// GetByID returns webhook id of userId, ErrNotFound when it belongs to
+// someone else.
+func (s *WebhookStore) GetByID(ctx context.Context, id int64, userId int64) (*Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE id = $1 AND user_id = $2`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	var webhook Webhook
+	if err := scanWebhook(s.db.QueryRowContext(ctxWTimeout, query, id, userId), &webhook); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &webhook, nil
+}
+
+func (s *WebhookStore) List(ctx context.Context, userId int64) ([]*Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE user_id = $1 ORDER BY created_at, id`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctxWTimeout, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []*Webhook{}
+	for rows.Next() {
+		var webhook Webhook
+		if err := scanWebhook(rows, &webhook); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, &webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+// Update saves the url, events and state of webhook. Turning a webhook back
+// on clears its failures.
+func (s *WebhookStore) Update(ctx context.Context, webhook *Webhook) error {
+	query := `
+		UPDATE webhooks
+		SET
+			url = $3,
+			events = $4,
+			is_active = $5,
+			failure_count = CASE WHEN $5 AND NOT is_active THEN 0 ELSE failure_count END,
+			disabled_at = CASE WHEN $5 THEN NULL ELSE COALESCE(disabled_at, NOW()) END,
+			updated_at = NOW()
+		WHERE id = $1 AND user_id = $2
+		RETURNING ` + webhookColumns
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	row := s.db.QueryRowContext(ctxWTimeout, query, webhook.ID, webhook.UserID, webhook.URL, pq.Array(webhook.Events), webhook.IsActive)
+	if err := scanWebhook(row, webhook); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *WebhookStore) Delete(ctx context.Context, id int64, userId int64) error {
+	query := `DELETE FROM webhooks WHERE id = $1 AND user_id = $2`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctxWTimeout, query, id, userId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetDeliveries pages through the delivery log of a webhook, the newest first.
+func (s *WebhookStore) GetDeliveries(ctx context.Context, webhookId int64, cq PaginationCursorQuery) ([]*WebhookDelivery, *Cursor, error) {
+
+	qb := newQueryBuilder(webhookId).
+		Where("webhook_id = $1").
+		WhereTimeRange("created_at", cq.TimeRange)
+
+	if cq.Cursor != "" {
+		cursor, err := DecodeCursor(cq.Cursor)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		qb.WhereAfter("created_at", "id", "<", cursor)
+	}
+
+	query := `
+		SELECT id, webhook_id, event, payload, status, attempts, next_attempt_at, response_status, COALESCE(error, ''), created_at, delivered_at
+		FROM webhook_deliveries
+		WHERE
+			` + qb.Conditions() + `
+		ORDER BY created_at DESC, id DESC
+		LIMIT ` + qb.Arg(cq.Limit+1) + `
+	`
+
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctxWTimeout, query, qb.Args()...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt, &d.ResponseStatus, &d.Error, &d.CreatedAt, &d.DeliveredAt)
+		if err != nil {
+			return nil, nil, err
+		}
+		deliveries = append(deliveries, &d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var next *Cursor
+	if len(deliveries) > cq.Limit {
+		deliveries = deliveries[:cq.Limit]
+		last := deliveries[len(deliveries)-1]
+		next = &Cursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+
+	return deliveries, next, nil
+}
+
+// Enqueue logs a delivery of payload to every active webhook of userId
+// subscribed to event. The deliveries are returned claimed until leaseUntil,
+// so they can be attempted right away without the dispatcher racing for them.
+func (s *WebhookStore) Enqueue(ctx context.Context, userId int64, event string, payload []byte, leaseUntil time.Time) ([]*WebhookDelivery, error) {
+	query := `
+		WITH inserted AS (
+			INSERT INTO webhook_deliveries (webhook_id, event, payload, next_attempt_at)
+			SELECT w.id, $2, $3, $4
+			FROM webhooks w
+			WHERE w.user_id = $1 AND w.is_active AND $2 = ANY(w.events)
+			RETURNING id, webhook_id, event, payload, attempts
+		)
+		SELECT i.id, i.webhook_id, i.event, i.payload, i.attempts, w.url, w.secret
+		FROM inserted i
+		JOIN webhooks w ON w.id = i.webhook_id
+	`
+
+	return s.queryClaimed(ctx, query, userId, event, string(payload), leaseUntil)
+}
+
+// ClaimDue claims the pending deliveries due at now, of active webhooks,
+// until leaseUntil: a dispatcher crashing mid-attempt only delays them.
+func (s *WebhookStore) ClaimDue(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]*WebhookDelivery, error) {
+	query := `
+		WITH claimed AS (
+			UPDATE webhook_deliveries d
+			SET next_attempt_at = $2
+			WHERE d.id IN (
+				SELECT d.id
+				FROM webhook_deliveries d
+				JOIN webhooks w ON w.id = d.webhook_id
+				WHERE d.status = 'pending' AND d.next_attempt_at <= $1 AND w.is_active
+				ORDER BY d.next_attempt_at
+				LIMIT $3
+				FOR UPDATE OF d SKIP LOCKED
+			)
+			RETURNING d.id, d.webhook_id, d.event, d.payload, d.attempts
+		)
+		SELECT c.id, c.webhook_id, c.event, c.payload, c.attempts, w.url, w.secret
+		FROM claimed c
+		JOIN webhooks w ON w.id = c.webhook_id
+	`
+
+	return s.queryClaimed(ctx, query, now, leaseUntil, limit)
+}
+
+func (s *WebhookStore) queryClaimed(ctx context.Context, query string, args ...any) ([]*WebhookDelivery, error) {
+	ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctxWTimeout, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*WebhookDelivery
+	for rows.Next() {
+		d := &WebhookDelivery{Status: DeliveryPending}
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Attempts, &d.URL, &d.Secret); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// RecordSuccess closes a delivery and clears the failures of its webhook.
+func (s *WebhookStore) RecordSuccess(ctx context.Context, d *WebhookDelivery, responseStatus int) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+		defer cancel()
+
+		query := `
+			UPDATE webhook_deliveries
+			SET status = 'succeeded', attempts = attempts + 1, response_status = $2, error = NULL, next_attempt_at = NULL, delivered_at = NOW()
+			WHERE id = $1
+		`
+
+		if _, err := tx.ExecContext(ctxWTimeout, query, d.ID, responseStatus); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctxWTimeout, `UPDATE webhooks SET failure_count = 0 WHERE id = $1 AND failure_count > 0`, d.WebhookID)
+		return err
+	})
+}
+
+// RecordFailure logs a failed attempt of a delivery, retried at retryAt or
+// given up on when nil. The webhook is disabled once it failed maxFailures
+// times in a row, which is reported by the returned bool.
+func (s *WebhookStore) RecordFailure(ctx context.Context, d *WebhookDelivery, responseStatus int, reason string, retryAt *time.Time, maxFailures int) (bool, error) {
+	var disabled bool
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctxWTimeout, cancel := context.WithTimeout(ctx, TimeOutTime)
+		defer cancel()
+
+		query := `
+			UPDATE webhook_deliveries
+			SET
+				status = CASE WHEN $4::timestamptz IS NULL THEN 'failed' ELSE 'pending' END,
+				attempts = attempts + 1,
+				response_status = NULLIF($2, 0),
+				error = $3,
+				next_attempt_at = $4
+			WHERE id = $1
+		`
+
+		if _, err := tx.ExecContext(ctxWTimeout, query, d.ID, responseStatus, reason, retryAt); err != nil {
+			return err
+		}
+
+		var wasActive bool
+		if err := tx.QueryRowContext(ctxWTimeout, `SELECT is_active FROM webhooks WHERE id = $1 FOR UPDATE`, d.WebhookID).Scan(&wasActive); err != nil {
+			return err
+		}
+
+		query = `
+			UPDATE webhooks
+			SET
+				failure_count = failure_count + 1,
+				is_active = is_active AND failure_count + 1 < $2,
+				disabled_at = CASE WHEN is_active AND failure_count + 1 >= $2 THEN NOW() ELSE disabled_at END
+			WHERE id = $1
+			RETURNING is_active
+		`
+
+		var isActive bool
+		if err := tx.QueryRowContext(ctxWTimeout, query, d.WebhookID, maxFailures).Scan(&isActive); err != nil {
+			return err
+		}
+
+		disabled = wasActive && !isActive
+		return nil
+	})
+
+	return disabled, err
+}
@@ -0,0 +1,191 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/wesleybruno/golang-monolito/internal/auth"
+)
+
+const (
+	EventPostCreated     = "post.created"
+	EventCommentCreated  = "comment.created"
+	EventReactionCreated = "reaction.created"
+	EventUserFollowed    = "user.followed"
+
+	// SignatureHeader carries "t=<unix seconds>,v1=<hex HMAC-SHA256>", the
+	// HMAC being of "<t>.<body>" keyed with the webhook secret.
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// ErrForbiddenTarget is returned for endpoints inside our own network, which
+// webhooks must not be able to reach.
+var ErrForbiddenTarget = errors.New("webhook URL must point to a public address")
+
+// Events lists what webhooks can subscribe to.
+var Events = []string{EventPostCreated, EventCommentCreated, EventReactionCreated, EventUserFollowed}
+
+// Payload is the body of every delivery.
+type Payload struct {
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// NewSecret generates a random signing secret.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature header of body sent at t.
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + auth.Sign(secret, ts+"."+string(body))
+}
+
+// Backoff is the delay before retrying a delivery that failed attempt times,
+// doubling from base up to max.
+func Backoff(attempt int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	return min(delay, max)
+}
+
+// Sender posts deliveries to the subscribers' endpoints.
+type Sender struct {
+	client *http.Client
+}
+
+func NewSender(timeout time.Duration) *Sender {
+	// the address is checked once resolved, when dialing, so a host can't
+	// pass CheckURL and then resolve to an internal address
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addr, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !isPublic(addr.Addr()) {
+				return ErrForbiddenTarget
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// a proxy would be dialed instead of the endpoint, bypassing the check
+	transport.Proxy = nil
+
+	return &Sender{
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+			// a redirect is an answer like any other non 2xx status
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Send posts body to url, signed with secret. It returns the response status,
+// zero when no response came back, and an error unless the status is 2xx.
+func (s *Sender) Send(ctx context.Context, url, secret, event string, deliveryID int64, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GoApi-Webhooks/1.0")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(deliveryID, 10))
+	req.Header.Set(SignatureHeader, Sign(secret, time.Now(), body))
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	// drain a little so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(res.Body, 4096))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+
+	return res.StatusCode, nil
+}
+
+// CheckURL fails with ErrForbiddenTarget when rawURL is not http(s) or its
+// host resolves to a loopback, private, link-local or otherwise internal
+// address.
+func CheckURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ErrForbiddenTarget
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return fmt.Errorf("resolving webhook host: %w", err)
+	}
+
+	for _, addr := range addrs {
+		if !isPublic(addr) {
+			return ErrForbiddenTarget
+		}
+	}
+
+	return nil
+}
+
+// internalRanges are not covered by the netip predicates: "this network"
+// and the carrier-grade NAT range, private in all but name.
+var internalRanges = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+}
+
+func isPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+
+	for _, prefix := range internalRanges {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+
+	return true
+}